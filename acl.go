@@ -0,0 +1,501 @@
+package pot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+var (
+	ErrForbidden  = errors.New("forbidden")
+	ErrInvalidACL = errors.New("invalid acl")
+)
+
+// Permission is an operation a principal can be granted on pot paths.
+type Permission string
+
+const (
+	PermissionRead   Permission = "read"
+	PermissionWrite  Permission = "write"
+	PermissionDelete Permission = "delete"
+	PermissionList   Permission = "list"
+
+	// PermissionAdmin grants the snapshots and viewing the permissions of
+	// other principals, it is checked on the root path
+	PermissionAdmin Permission = "admin"
+)
+
+// permissions are all known permissions.
+var permissions = []Permission{PermissionRead, PermissionWrite, PermissionDelete, PermissionList, PermissionAdmin}
+
+// ACLRule grants the permissions on the paths matching the glob to the
+// principals and members of the groups.
+//
+// Path globs are made of segments separated by a slash. A * segment matches
+// any single segment, ** matches any number of segments including none, and
+// {name} matches a single segment and binds it to the variable name. Variables
+// bound by the path can be used in principals and groups, so the rule
+// teams/{team}/** granted to the group {team} lets members of each team access
+// only the paths of their team. A * principal matches every caller.
+type ACLRule struct {
+	Path        string       `json:"path" yaml:"path" toml:"path"`
+	Principals  []string     `json:"principals,omitempty" yaml:"principals,omitempty" toml:"principals,omitempty"`
+	Groups      []string     `json:"groups,omitempty" yaml:"groups,omitempty" toml:"groups,omitempty"`
+	Permissions []Permission `json:"permissions" yaml:"permissions" toml:"permissions"`
+}
+
+// ACL decides which principals are allowed to access which paths. Everything
+// that is not granted by a rule is denied.
+type ACL struct {
+	rules []*aclRule
+}
+
+// aclRule is the compiled ACLRule.
+type aclRule struct {
+	ACLRule
+
+	path       []*pattern
+	principals []*pattern
+	groups     []*pattern
+}
+
+// NewACL compiles the rules.
+func NewACL(rules ...ACLRule) (*ACL, error) {
+	acl := &ACL{}
+	for i, rule := range rules {
+		compiled, err := compileRule(rule)
+		if err != nil {
+			return nil, fmt.Errorf("%w: rule %d: %w", ErrInvalidACL, i, err)
+		}
+
+		acl.rules = append(acl.rules, compiled)
+	}
+
+	return acl, nil
+}
+
+func compileRule(rule ACLRule) (*aclRule, error) {
+	if len(rule.Principals) == 0 && len(rule.Groups) == 0 {
+		return nil, errors.New("rule requires principals or groups")
+	}
+
+	if len(rule.Permissions) == 0 {
+		return nil, errors.New("rule requires permissions")
+	}
+	for _, perm := range rule.Permissions {
+		if !slices.Contains(permissions, perm) {
+			return nil, fmt.Errorf("unknown permission %s", perm)
+		}
+	}
+
+	compiled := &aclRule{ACLRule: rule}
+	for _, segment := range splitPath(rule.Path) {
+		p, err := compilePattern(segment)
+		if err != nil {
+			return nil, err
+		}
+		compiled.path = append(compiled.path, p)
+	}
+
+	for _, principal := range rule.Principals {
+		p, err := compilePattern(principal)
+		if err != nil {
+			return nil, err
+		}
+		compiled.principals = append(compiled.principals, p)
+	}
+
+	for _, group := range rule.Groups {
+		p, err := compilePattern(group)
+		if err != nil {
+			return nil, err
+		}
+		compiled.groups = append(compiled.groups, p)
+	}
+
+	return compiled, nil
+}
+
+// Allowed reports whether the principal has the permission on the path. A nil
+// principal is an anonymous caller, who is matched only by * principals.
+func (a *ACL) Allowed(p *Principal, perm Permission, dir string) bool {
+	segments := splitPath(dir)
+	for _, rule := range a.rules {
+		if !slices.Contains(rule.Permissions, perm) {
+			continue
+		}
+
+		for _, vars := range matchPath(rule.path, segments, map[string]string{}) {
+			if rule.matchesPrincipal(p, vars) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// matchesPrincipal reports whether the principal or one of its groups matches
+// the rule, given the variables bound by the path.
+func (r *aclRule) matchesPrincipal(p *Principal, vars map[string]string) bool {
+	for _, principal := range r.principals {
+		if principal.raw == "*" {
+			return true
+		}
+		if p != nil {
+			if _, ok := principal.match(p.Name, vars); ok {
+				return true
+			}
+		}
+	}
+
+	if p == nil {
+		return false
+	}
+
+	for _, group := range r.groups {
+		for _, g := range p.Groups {
+			if _, ok := group.match(g, vars); ok {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// Grant is a set of permissions on the paths matching the glob.
+type Grant struct {
+	Path        string       `json:"path"`
+	Permissions []Permission `json:"permissions"`
+}
+
+// PermissionsResponse lists the effective permissions of a principal.
+type PermissionsResponse struct {
+	Principal string   `json:"principal"`
+	Groups    []string `json:"groups,omitempty"`
+	Grants    []Grant  `json:"grants"`
+}
+
+// Permissions returns the effective permissions of the principal. Variables
+// bound by the principal or its groups are resolved in the path globs, and
+// unbound ones are shown as *.
+func (a *ACL) Permissions(p *Principal) *PermissionsResponse {
+	res := &PermissionsResponse{Grants: []Grant{}}
+	if p != nil {
+		res.Principal = p.Name
+		res.Groups = p.Groups
+	}
+
+	seen := map[string]int{}
+	add := func(rule *aclRule, vars map[string]string) {
+		glob := rule.render(vars)
+		i, ok := seen[glob]
+		if !ok {
+			i = len(res.Grants)
+			seen[glob] = i
+			res.Grants = append(res.Grants, Grant{Path: glob})
+		}
+
+		for _, perm := range rule.Permissions {
+			if !slices.Contains(res.Grants[i].Permissions, perm) {
+				res.Grants[i].Permissions = append(res.Grants[i].Permissions, perm)
+			}
+		}
+	}
+
+	for _, rule := range a.rules {
+		for _, principal := range rule.principals {
+			if principal.raw == "*" {
+				add(rule, nil)
+				continue
+			}
+			if p == nil {
+				continue
+			}
+			if vars, ok := principal.match(p.Name, map[string]string{}); ok {
+				add(rule, vars)
+			}
+		}
+
+		if p == nil {
+			continue
+		}
+
+		for _, group := range rule.groups {
+			for _, g := range p.Groups {
+				if vars, ok := group.match(g, map[string]string{}); ok {
+					add(rule, vars)
+				}
+			}
+		}
+	}
+
+	return res
+}
+
+// render returns the path glob of the rule with the variables resolved.
+func (r *aclRule) render(vars map[string]string) string {
+	segments := make([]string, len(r.path))
+	for i, p := range r.path {
+		segments[i] = p.render(vars)
+	}
+
+	return strings.Join(segments, "/")
+}
+
+// pattern matches a single path segment, principal or group. It is either **,
+// or a mix of literal text, * wildcards and {name} variables.
+type pattern struct {
+	raw  string
+	re   *regexp.Regexp
+	vars []string
+}
+
+var patternVariable = regexp.MustCompile(`\{([A-Za-z_][A-Za-z0-9_]*)\}|\*`)
+
+func compilePattern(raw string) (*pattern, error) {
+	p := &pattern{raw: raw}
+	if raw == "**" {
+		return p, nil
+	}
+
+	if strings.ContainsAny(patternVariable.ReplaceAllString(raw, ""), "{}") {
+		return nil, fmt.Errorf("invalid pattern %s", raw)
+	}
+
+	// principals may contain slashes, e.g. SPIFFE IDs, while path segments
+	// never do, so variables and wildcards match any text
+	expr := strings.Builder{}
+	expr.WriteString("^")
+	last := 0
+	for _, loc := range patternVariable.FindAllStringSubmatchIndex(raw, -1) {
+		expr.WriteString(regexp.QuoteMeta(raw[last:loc[0]]))
+		last = loc[1]
+
+		if loc[2] < 0 {
+			expr.WriteString(".*")
+			continue
+		}
+
+		name := raw[loc[2]:loc[3]]
+		if slices.Contains(p.vars, name) {
+			return nil, fmt.Errorf("variable %s is used twice in %s", name, raw)
+		}
+		p.vars = append(p.vars, name)
+		expr.WriteString("(.+)")
+	}
+	expr.WriteString(regexp.QuoteMeta(raw[last:]))
+	expr.WriteString("$")
+
+	re, err := regexp.Compile(expr.String())
+	if err != nil {
+		return nil, err
+	}
+	p.re = re
+
+	return p, nil
+}
+
+// match matches the value and returns the variables extended by the ones
+// bound by the pattern. Variables bound already must match the same text.
+func (p *pattern) match(value string, vars map[string]string) (map[string]string, bool) {
+	groups := p.re.FindStringSubmatch(value)
+	if groups == nil {
+		return nil, false
+	}
+
+	bound := map[string]string{}
+	for k, v := range vars {
+		bound[k] = v
+	}
+
+	for i, name := range p.vars {
+		if prev, ok := bound[name]; ok && prev != groups[i+1] {
+			return nil, false
+		}
+		bound[name] = groups[i+1]
+	}
+
+	return bound, true
+}
+
+// render returns the pattern with the bound variables replaced by their
+// values and the unbound ones by *.
+func (p *pattern) render(vars map[string]string) string {
+	return patternVariable.ReplaceAllStringFunc(p.raw, func(v string) string {
+		if v == "*" {
+			return v
+		}
+
+		if value, ok := vars[strings.Trim(v, "{}")]; ok {
+			return value
+		}
+
+		return "*"
+	})
+}
+
+// matchPath matches the path segments against the glob and returns the
+// variables of every way the path matches.
+func matchPath(glob []*pattern, segments []string, vars map[string]string) []map[string]string {
+	if len(glob) == 0 {
+		if len(segments) == 0 {
+			return []map[string]string{vars}
+		}
+
+		return nil
+	}
+
+	if glob[0].raw == "**" {
+		matches := []map[string]string{}
+		for i := 0; i <= len(segments); i++ {
+			matches = append(matches, matchPath(glob[1:], segments[i:], vars)...)
+		}
+
+		return matches
+	}
+
+	if len(segments) == 0 {
+		return nil
+	}
+
+	bound, ok := glob[0].match(segments[0], vars)
+	if !ok {
+		return nil
+	}
+
+	return matchPath(glob[1:], segments[1:], bound)
+}
+
+// splitPath splits the path into its segments.
+func splitPath(dir string) []string {
+	dir = strings.Trim(dir, "/")
+	if dir == "" {
+		return nil
+	}
+
+	return strings.Split(dir, "/")
+}
+
+// WithACL restricts the access to the paths by the rules of the ACL. Requests
+// are authorized by the principal attached by the authenticators, so an ACL
+// is usually combined with WithAuthenticator.
+func WithACL(acl *ACL) Option {
+	return func(c *Server) {
+		c.acl.Store(acl)
+	}
+}
+
+// permitted reports whether the principal of the context has the permission
+// on the path. Everything is permitted if the server has no ACL.
+func (s *Server) permitted(ctx context.Context, perm Permission, dir string) bool {
+	acl := s.acl.Load()
+	if acl == nil {
+		return true
+	}
+
+	p, _ := PrincipalFromContext(ctx)
+	return acl.Allowed(p, perm, dir)
+}
+
+// requestPermission returns the permission required by the request and the
+// path it is checked on. Requests that are authorized by their routes, or
+// not at all, return false.
+func requestPermission(r *http.Request) (Permission, string, bool) {
+	relPath := strings.TrimPrefix(r.URL.Path, "/")
+
+	switch {
+	case relPath == ":healthz" || relPath == ":readyz" || relPath == ":openapi":
+		return "", "", false
+	case strings.HasPrefix(relPath, ":index/") && r.Method == http.MethodPost:
+		// rebuilds read all pots covered by the index
+		return PermissionAdmin, "", true
+	case strings.HasPrefix(relPath, ":index/"), strings.HasPrefix(relPath, ":admin/"):
+		// the routes filter their results or authorize the request on their own
+		return "", "", false
+	case relPath == ":snapshot":
+		return PermissionAdmin, "", true
+	}
+
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		if prefix, ok := strings.CutSuffix(relPath, ":list"); ok {
+			return PermissionList, prefix, true
+		}
+		if prefix, ok := strings.CutSuffix(relPath, ":export"); ok {
+			return PermissionRead, prefix, true
+		}
+		if prefix, ok := strings.CutSuffix(relPath, ":audit"); ok {
+			return PermissionAdmin, prefix, true
+		}
+
+		return PermissionRead, relPath, true
+	case http.MethodPost:
+		if key, ok := strings.CutSuffix(relPath, ":increment"); ok {
+			dir, _ := path.Split(key)
+			return PermissionWrite, strings.TrimSuffix(dir, "/"), true
+		}
+		if prefix, ok := strings.CutSuffix(relPath, ":import"); ok {
+			return PermissionWrite, prefix, true
+		}
+
+		return PermissionWrite, relPath, true
+	case http.MethodDelete:
+		return PermissionDelete, relPath, true
+	}
+
+	return "", "", false
+}
+
+// authorize is the middleware rejecting requests the principal has no
+// permission for.
+func (s *Server) authorize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		perm, dir, ok := requestPermission(r)
+		if ok && !s.permitted(r.Context(), perm, dir) {
+			forbidden(w, perm, dir)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func forbidden(w http.ResponseWriter, perm Permission, dir string) {
+	http.Error(w, fmt.Sprintf("%s: no %s permission on /%s", ErrForbidden, perm, dir), http.StatusForbidden)
+}
+
+func (s *Server) routePermissionsFunc(w http.ResponseWriter, r *http.Request) {
+	codec, err := negotiateCodec(r.Header.Get("Accept"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotAcceptable)
+		return
+	}
+
+	acl := s.acl.Load()
+	if acl == nil {
+		http.Error(w, "no acl is configured", http.StatusNotFound)
+		return
+	}
+
+	// callers see their own permissions, the permissions of others can be
+	// viewed by admins only
+	p, _ := PrincipalFromContext(r.Context())
+	q := r.URL.Query()
+	if q.Has("principal") || q.Has("group") {
+		if !s.permitted(r.Context(), PermissionAdmin, "") {
+			forbidden(w, PermissionAdmin, "")
+			return
+		}
+
+		p = &Principal{Name: q.Get("principal"), Groups: q["group"]}
+	}
+
+	writeContent(w, codec, http.StatusOK, acl.Permissions(p))
+}
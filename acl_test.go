@@ -0,0 +1,193 @@
+package pot
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type ACLSuite struct {
+	suite.Suite
+
+	acl *ACL
+}
+
+func (s *ACLSuite) SetupTest() {
+	acl, err := NewACL(
+		ACLRule{Path: "teams/{team}/**", Groups: []string{"{team}"}, Permissions: []Permission{PermissionRead, PermissionWrite, PermissionList}},
+		ACLRule{Path: "users/{user}", Principals: []string{"{user}"}, Permissions: []Permission{PermissionRead, PermissionWrite, PermissionDelete}},
+		ACLRule{Path: "public/*", Principals: []string{"*"}, Permissions: []Permission{PermissionRead}},
+		ACLRule{Path: "**", Principals: []string{"admin"}, Permissions: []Permission{PermissionAdmin, PermissionDelete}},
+	)
+	s.Require().NoError(err)
+
+	s.acl = acl
+}
+
+func (s *ACLSuite) TestAllowed() {
+	alice := &Principal{Name: "alice", Groups: []string{"red"}}
+	admin := &Principal{Name: "admin"}
+
+	cases := []struct {
+		caseName  string
+		principal *Principal
+		perm      Permission
+		dir       string
+		expected  bool
+	}{
+		{"team member writes", alice, PermissionWrite, "teams/red/tasks", true},
+		{"team member writes nested", alice, PermissionWrite, "teams/red/a/b/c", true},
+		{"team member lists team root", alice, PermissionList, "teams/red", true},
+		{"other team", alice, PermissionRead, "teams/blue/tasks", false},
+		{"team member can't delete", alice, PermissionDelete, "teams/red/tasks", false},
+		{"own user", alice, PermissionDelete, "users/alice", true},
+		{"other user", alice, PermissionRead, "users/bob", false},
+		{"nested user path", alice, PermissionRead, "users/alice/nested", false},
+		{"public", alice, PermissionRead, "public/news", true},
+		{"public anonymous", nil, PermissionRead, "public/news", true},
+		{"public nested", nil, PermissionRead, "public/news/today", false},
+		{"anonymous team", nil, PermissionRead, "teams/red/tasks", false},
+		{"admin root", admin, PermissionAdmin, "", true},
+		{"admin anywhere", admin, PermissionDelete, "teams/red/tasks", true},
+		{"admin can't read", admin, PermissionRead, "teams/red/tasks", false},
+		{"no admin", alice, PermissionAdmin, "", false},
+	}
+
+	for _, c := range cases {
+		s.Run(c.caseName, func() {
+			s.Equal(c.expected, s.acl.Allowed(c.principal, c.perm, c.dir))
+		})
+	}
+}
+
+func (s *ACLSuite) TestInvalidRules() {
+	cases := []struct {
+		caseName string
+		rule     ACLRule
+	}{
+		{"no principals", ACLRule{Path: "a", Permissions: []Permission{PermissionRead}}},
+		{"no permissions", ACLRule{Path: "a", Principals: []string{"*"}}},
+		{"unknown permission", ACLRule{Path: "a", Principals: []string{"*"}, Permissions: []Permission{"execute"}}},
+		{"unclosed variable", ACLRule{Path: "a/{team", Principals: []string{"*"}, Permissions: []Permission{PermissionRead}}},
+		{"repeated variable", ACLRule{Path: "a/{x}-{x}", Principals: []string{"*"}, Permissions: []Permission{PermissionRead}}},
+	}
+
+	for _, c := range cases {
+		s.Run(c.caseName, func() {
+			_, err := NewACL(c.rule)
+			s.ErrorIs(err, ErrInvalidACL)
+		})
+	}
+}
+
+func (s *ACLSuite) TestPermissions() {
+	res := s.acl.Permissions(&Principal{Name: "alice", Groups: []string{"red", "blue"}})
+
+	s.Equal([]Grant{
+		{Path: "teams/red/**", Permissions: []Permission{PermissionRead, PermissionWrite, PermissionList}},
+		{Path: "teams/blue/**", Permissions: []Permission{PermissionRead, PermissionWrite, PermissionList}},
+		{Path: "users/alice", Permissions: []Permission{PermissionRead, PermissionWrite, PermissionDelete}},
+		{Path: "public/*", Permissions: []Permission{PermissionRead}},
+	}, res.Grants)
+}
+
+func (s *ACLSuite) TestRequestPermission() {
+	cases := []struct {
+		method string
+		target string
+		perm   Permission
+		dir    string
+		ok     bool
+	}{
+		{http.MethodGet, "/teams/red", PermissionRead, "teams/red", true},
+		{http.MethodGet, "/teams/red:list", PermissionList, "teams/red", true},
+		{http.MethodGet, "/:list", PermissionList, "", true},
+		{http.MethodGet, "/teams/red:export", PermissionRead, "teams/red", true},
+		{http.MethodGet, "/teams/red:audit", PermissionAdmin, "teams/red", true},
+		{http.MethodPost, "/teams/red", PermissionWrite, "teams/red", true},
+		{http.MethodPost, "/teams/red/key:increment", PermissionWrite, "teams/red", true},
+		{http.MethodPost, "/teams:import", PermissionWrite, "teams", true},
+		{http.MethodDelete, "/teams/red", PermissionDelete, "teams/red", true},
+		{http.MethodGet, "/:snapshot", PermissionAdmin, "", true},
+		{http.MethodPost, "/:snapshot", PermissionAdmin, "", true},
+		{http.MethodGet, "/:healthz", "", "", false},
+		{http.MethodGet, "/:openapi", "", "", false},
+		{http.MethodGet, "/:index/users", "", "", false},
+		{http.MethodPost, "/:index/users", PermissionAdmin, "", true},
+		{http.MethodGet, "/:admin/permissions", "", "", false},
+	}
+
+	for _, c := range cases {
+		s.Run(c.method+" "+c.target, func() {
+			perm, dir, ok := requestPermission(httptest.NewRequest(c.method, c.target, nil))
+			s.Equal(c.ok, ok)
+			s.Equal(c.perm, perm)
+			s.Equal(c.dir, dir)
+		})
+	}
+}
+
+func (s *ACLSuite) TestAuthorize() {
+	srv := &Server{}
+	srv.acl.Store(s.acl)
+
+	handler := srv.authorize(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	serve := func(p *Principal, method, target string) int {
+		r := httptest.NewRequest(method, target, nil)
+		if p != nil {
+			r = r.WithContext(ContextWithPrincipal(r.Context(), p))
+		}
+
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, r)
+		return rec.Code
+	}
+
+	alice := &Principal{Name: "alice", Groups: []string{"red"}}
+	s.Equal(http.StatusOK, serve(alice, http.MethodPost, "/teams/red/tasks"))
+	s.Equal(http.StatusForbidden, serve(alice, http.MethodDelete, "/teams/red/tasks"))
+	s.Equal(http.StatusForbidden, serve(alice, http.MethodGet, "/teams/blue:list"))
+	s.Equal(http.StatusForbidden, serve(nil, http.MethodGet, "/:snapshot"))
+	s.Equal(http.StatusOK, serve(nil, http.MethodGet, "/:healthz"))
+}
+
+func (s *ACLSuite) TestRoutePermissions() {
+	srv := &Server{}
+	srv.acl.Store(s.acl)
+
+	get := func(p *Principal, target string) (int, *PermissionsResponse) {
+		r := httptest.NewRequest(http.MethodGet, target, nil)
+		r = r.WithContext(ContextWithPrincipal(r.Context(), p))
+
+		rec := httptest.NewRecorder()
+		srv.routePermissionsFunc(rec, r)
+
+		res := &PermissionsResponse{}
+		if rec.Code == http.StatusOK {
+			s.NoError(json.NewDecoder(rec.Body).Decode(res))
+		}
+		return rec.Code, res
+	}
+
+	code, res := get(&Principal{Name: "alice"}, "/:admin/permissions")
+	s.Equal(http.StatusOK, code)
+	s.Equal("alice", res.Principal)
+
+	// only admins can view the permissions of others
+	code, _ = get(&Principal{Name: "alice"}, "/:admin/permissions?principal=bob")
+	s.Equal(http.StatusForbidden, code)
+
+	code, res = get(&Principal{Name: "admin"}, "/:admin/permissions?principal=bob&group=red")
+	s.Equal(http.StatusOK, code)
+	s.Equal("bob", res.Principal)
+	s.Equal([]string{"red"}, res.Groups)
+	s.Equal("teams/red/**", res.Grants[0].Path)
+}
+
+func TestACLSuite(t *testing.T) {
+	suite.Run(t, new(ACLSuite))
+}
@@ -0,0 +1,428 @@
+package pot
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/iterator"
+)
+
+var (
+	ErrNoAuditTrail = errors.New("audit sink can't be queried")
+)
+
+const (
+	// requestIDHeader is the header carrying the id of the request
+	requestIDHeader = "X-Request-ID"
+
+	// maxRequestIDLength is the longest request id accepted from clients,
+	// longer ids are replaced by a generated one
+	maxRequestIDLength = 128
+
+	// defaultAuditLimit is the number of events returned by the audit route
+	defaultAuditLimit = 100
+
+	// defaultAuditPrefix is the bucket directory of the audit events if no
+	// prefix is set
+	defaultAuditPrefix = ".potaudit"
+)
+
+// Audited actions.
+const (
+	AuditCreate    = "create"
+	AuditRemove    = "remove"
+	AuditIncrement = "increment"
+	AuditImport    = "import"
+	AuditRestore   = "restore"
+	AuditSnapshot  = "snapshot"
+	AuditReload    = "reload"
+)
+
+// AuditEvent records a single mutation or admin action.
+type AuditEvent struct {
+	Time      time.Time `json:"time"`
+	RequestID string    `json:"requestId,omitempty"`
+
+	// Principal is the name of the caller, empty for anonymous callers and
+	// actions of the server itself, e.g. reloads
+	Principal string `json:"principal,omitempty"`
+
+	Action string   `json:"action"`
+	Path   string   `json:"path"`
+	Keys   []string `json:"keys,omitempty"`
+
+	// Before and After are the SHA-256 hashes of the documents before and
+	// after the action by their keys. Missing documents have no hash.
+	Before map[string]string `json:"before,omitempty"`
+	After  map[string]string `json:"after,omitempty"`
+
+	// Generation is the generation of the pot written by the action
+	Generation int64 `json:"generation,omitempty"`
+}
+
+// AuditSink records the audit events. Sinks only ever append events.
+type AuditSink interface {
+	Record(ctx context.Context, event *AuditEvent) error
+}
+
+// AuditTrail is implemented by the sinks that can be queried.
+type AuditTrail interface {
+	// Trail returns the last events of the path, oldest first
+	Trail(ctx context.Context, dir string, limit int) ([]*AuditEvent, error)
+}
+
+// WithAuditSink records every mutation and admin action to the sink.
+func WithAuditSink(sink AuditSink) Option {
+	return func(c *Server) {
+		c.audit = sink
+	}
+}
+
+// WithAuditBucket records every mutation and admin action as objects under
+// the prefix of the bucket.
+func WithAuditBucket(prefix string) Option {
+	return func(c *Server) {
+		c.audit = NewBucketAuditSink(c.bucket, prefix)
+	}
+}
+
+// WriterAuditSink writes the events as JSON lines, e.g. to stdout.
+type WriterAuditSink struct {
+	mux sync.Mutex
+	w   io.Writer
+}
+
+// NewWriterAuditSink writes the events to w.
+func NewWriterAuditSink(w io.Writer) *WriterAuditSink {
+	return &WriterAuditSink{w: w}
+}
+
+func (s *WriterAuditSink) Record(ctx context.Context, event *AuditEvent) error {
+	b, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	_, err = s.w.Write(append(b, '\n'))
+	return err
+}
+
+// FileAuditSink appends the events as JSON lines to a local file.
+type FileAuditSink struct {
+	*WriterAuditSink
+
+	name string
+	file *os.File
+}
+
+// NewFileAuditSink opens the file for appending, creating it if needed.
+func NewFileAuditSink(name string) (*FileAuditSink, error) {
+	f, err := os.OpenFile(name, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FileAuditSink{
+		WriterAuditSink: NewWriterAuditSink(f),
+		name:            name,
+		file:            f,
+	}, nil
+}
+
+// Trail scans the file for the events of the path.
+func (s *FileAuditSink) Trail(ctx context.Context, dir string, limit int) ([]*AuditEvent, error) {
+	f, err := os.Open(s.name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	events := []*AuditEvent{}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxRecordSize)
+	for scanner.Scan() {
+		event := &AuditEvent{}
+		if err := json.Unmarshal(scanner.Bytes(), event); err != nil {
+			return nil, err
+		}
+
+		if event.Path == dir {
+			events = append(events, event)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return lastEvents(events, limit), nil
+}
+
+// Close closes the file.
+func (s *FileAuditSink) Close() error {
+	return s.file.Close()
+}
+
+// BucketAuditSink stores every event as a separate object named by its time
+// under the prefix and the path of the event. Objects are never overwritten.
+type BucketAuditSink struct {
+	bucket *storage.BucketHandle
+	prefix string
+}
+
+// NewBucketAuditSink stores the events under the prefix of the bucket, which
+// is .potaudit if empty.
+func NewBucketAuditSink(bucket *storage.BucketHandle, prefix string) *BucketAuditSink {
+	prefix = strings.Trim(prefix, "/")
+	if prefix == "" {
+		prefix = defaultAuditPrefix
+	}
+
+	return &BucketAuditSink{bucket: bucket, prefix: prefix}
+}
+
+func (s *BucketAuditSink) Record(ctx context.Context, event *AuditEvent) error {
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return err
+	}
+
+	// zero padded times sort the objects in the order of the events
+	name := path.Join(s.prefix, event.Path, fmt.Sprintf("%019d-%s.json", event.Time.UnixNano(), hex.EncodeToString(suffix)))
+
+	writeCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	w := s.bucket.Object(name).If(storage.Conditions{DoesNotExist: true}).NewWriter(writeCtx)
+	w.ContentType = "application/json"
+	if err := json.NewEncoder(w).Encode(event); err != nil {
+		return err
+	}
+
+	return w.Close()
+}
+
+// Trail lists the event objects of the path, nested paths are left out.
+func (s *BucketAuditSink) Trail(ctx context.Context, dir string, limit int) ([]*AuditEvent, error) {
+	names := []string{}
+	objList := s.bucket.Objects(ctx, &storage.Query{
+		Prefix:    path.Join(s.prefix, dir) + "/",
+		Delimiter: "/",
+	})
+	for {
+		obj, err := objList.Next()
+		if errors.Is(err, iterator.Done) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		// nested paths are listed as prefixes
+		if obj.Name != "" {
+			names = append(names, obj.Name)
+		}
+	}
+
+	if limit > 0 && len(names) > limit {
+		names = names[len(names)-limit:]
+	}
+
+	events := []*AuditEvent{}
+	for _, name := range names {
+		reader, err := s.bucket.Object(name).NewReader(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		event := &AuditEvent{}
+		err = json.NewDecoder(reader).Decode(event)
+		reader.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		events = append(events, event)
+	}
+
+	return events, nil
+}
+
+// isAuditObject checks whether the object is an audit event stored by the
+// bucket sink of the server.
+func (s *Server) isAuditObject(name string) bool {
+	sink, ok := s.audit.(*BucketAuditSink)
+	return ok && strings.HasPrefix(name, sink.prefix+"/")
+}
+
+func lastEvents(events []*AuditEvent, limit int) []*AuditEvent {
+	if limit > 0 && len(events) > limit {
+		return events[len(events)-limit:]
+	}
+
+	return events
+}
+
+// auditHash returns the hash of the document recorded in audit events.
+func auditHash(doc json.RawMessage) string {
+	sum := sha256.Sum256(doc)
+	return hex.EncodeToString(sum[:])
+}
+
+// auditHashes returns the hashes of the documents by their keys.
+func auditHashes(docs map[string]json.RawMessage) map[string]string {
+	hashes := map[string]string{}
+	for key, doc := range docs {
+		if doc != nil {
+			hashes[key] = auditHash(doc)
+		}
+	}
+
+	return hashes
+}
+
+// recordAudit completes the event by the caller and records it. The action
+// already happened, so failures are only logged.
+func (s *Server) recordAudit(ctx context.Context, event *AuditEvent) {
+	if s.audit == nil {
+		return
+	}
+
+	event.Time = time.Now().UTC()
+	event.RequestID = RequestIDFromContext(ctx)
+	if p, ok := PrincipalFromContext(ctx); ok && p != nil {
+		event.Principal = p.Name
+	}
+
+	// the event is recorded even if the caller went away
+	if err := s.audit.Record(context.WithoutCancel(ctx), event); err != nil {
+		slog.Error("failed to record audit event",
+			slog.String("action", event.Action),
+			slog.String("path", event.Path),
+			slog.String("error", err.Error()),
+		)
+	}
+}
+
+// auditConfig returns the hashes of the reloadable sections of the config.
+func auditConfig(cfg *Config) map[string]string {
+	sections := map[string]any{
+		"auth":        cfg.Auth,
+		"acl":         cfg.ACL,
+		"rateLimits":  cfg.RateLimits,
+		"policy":      cfg.Policy,
+		"cache":       cfg.Cache,
+		"groupCommit": cfg.GroupCommit,
+		"encryption":  cfg.Encryption,
+	}
+
+	hashes := map[string]string{}
+	for name, section := range sections {
+		// the sections are plain values, which always encode
+		b, _ := json.Marshal(section)
+		hashes[name] = auditHash(b)
+	}
+
+	return hashes
+}
+
+// changedHashes returns the sorted keys whose hashes differ.
+func changedHashes(before, after map[string]string) []string {
+	changed := []string{}
+	for _, key := range sortedKeys(after) {
+		if before[key] != after[key] {
+			changed = append(changed, key)
+		}
+	}
+
+	return changed
+}
+
+type requestIDKey struct{}
+
+// RequestIDFromContext returns the id of the request, empty if there is none.
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// ContextWithRequestID returns the context carrying the request id.
+func ContextWithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// requestID is the middleware attaching the id of the request to its context
+// and response. Ids sent by clients are kept, so requests can be correlated
+// across services.
+func (s *Server) requestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if id == "" || len(id) > maxRequestIDLength || strings.ContainsFunc(id, func(c rune) bool { return c < '!' || c > '~' }) {
+			b := make([]byte, 16)
+			if _, err := rand.Read(b); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			id = hex.EncodeToString(b)
+		}
+
+		w.Header().Set(requestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(ContextWithRequestID(r.Context(), id)))
+	})
+}
+
+func (s *Server) routeAuditFunc(w http.ResponseWriter, r *http.Request) {
+	dir := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/"), ":audit")
+
+	if err := validatePath(dir); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	codec, err := negotiateCodec(r.Header.Get("Accept"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotAcceptable)
+		return
+	}
+
+	trail, ok := s.audit.(AuditTrail)
+	if !ok {
+		http.Error(w, ErrNoAuditTrail.Error(), http.StatusNotImplemented)
+		return
+	}
+
+	limit := defaultAuditLimit
+	if r.URL.Query().Has("limit") {
+		limit, err = strconv.Atoi(r.URL.Query().Get("limit"))
+		if err != nil || limit <= 0 {
+			http.Error(w, "limit must be a positive number", http.StatusBadRequest)
+			return
+		}
+	}
+
+	events, err := trail.Trail(r.Context(), dir, limit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeContent(w, codec, http.StatusOK, events)
+}
@@ -0,0 +1,146 @@
+package pot
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type AuditSuite struct {
+	suite.Suite
+}
+
+func (s *AuditSuite) fileSink() *FileAuditSink {
+	sink, err := NewFileAuditSink(filepath.Join(s.T().TempDir(), "audit.log"))
+	s.Require().NoError(err)
+	s.T().Cleanup(func() { sink.Close() })
+
+	return sink
+}
+
+func (s *AuditSuite) TestFileTrail() {
+	sink := s.fileSink()
+	srv := &Server{audit: sink}
+
+	ctx := ContextWithPrincipal(ContextWithRequestID(context.Background(), "req-1"), &Principal{Name: "alice"})
+	srv.recordAudit(ctx, &AuditEvent{Action: AuditCreate, Path: "teams/red", Keys: []string{"a"}, Generation: 1})
+	srv.recordAudit(ctx, &AuditEvent{Action: AuditCreate, Path: "teams/red/nested", Keys: []string{"b"}, Generation: 2})
+	srv.recordAudit(context.Background(), &AuditEvent{Action: AuditRemove, Path: "teams/red", Keys: []string{"a"}, Generation: 3})
+
+	events, err := sink.Trail(context.Background(), "teams/red", 0)
+	s.Require().NoError(err)
+	s.Require().Len(events, 2)
+
+	s.Equal(AuditCreate, events[0].Action)
+	s.Equal("alice", events[0].Principal)
+	s.Equal("req-1", events[0].RequestID)
+	s.False(events[0].Time.IsZero())
+	s.Equal(AuditRemove, events[1].Action)
+	s.Equal("", events[1].Principal)
+
+	// the limit keeps the last events
+	events, err = sink.Trail(context.Background(), "teams/red", 1)
+	s.Require().NoError(err)
+	s.Require().Len(events, 1)
+	s.Equal(int64(3), events[0].Generation)
+}
+
+func (s *AuditSuite) TestWriterSink() {
+	buf := &bytes.Buffer{}
+	srv := &Server{audit: NewWriterAuditSink(buf)}
+
+	srv.recordAudit(context.Background(), &AuditEvent{
+		Action: AuditCreate,
+		Path:   "a",
+		After:  auditHashes(map[string]json.RawMessage{"x": json.RawMessage(`{"id":"x"}`)}),
+	})
+	srv.recordAudit(context.Background(), &AuditEvent{Action: AuditRemove, Path: "a"})
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	s.Require().Len(lines, 2)
+
+	event := &AuditEvent{}
+	s.NoError(json.Unmarshal([]byte(lines[0]), event))
+	s.Equal(auditHash(json.RawMessage(`{"id":"x"}`)), event.After["x"])
+}
+
+func (s *AuditSuite) TestRequestID() {
+	var id string
+	handler := (&Server{}).requestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id = RequestIDFromContext(r.Context())
+	}))
+
+	serve := func(header string) string {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		if header != "" {
+			r.Header.Set(requestIDHeader, header)
+		}
+
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, r)
+		s.Equal(id, rec.Header().Get(requestIDHeader))
+		return id
+	}
+
+	s.Len(serve(""), 32)
+	s.Equal("client-id", serve("client-id"))
+	s.Len(serve("bad id"), 32)
+	s.Len(serve(strings.Repeat("x", maxRequestIDLength+1)), 32)
+}
+
+func (s *AuditSuite) TestRoute() {
+	sink := s.fileSink()
+	srv := &Server{audit: sink}
+	srv.recordAudit(context.Background(), &AuditEvent{Action: AuditCreate, Path: "a"})
+	srv.recordAudit(context.Background(), &AuditEvent{Action: AuditCreate, Path: ""})
+
+	get := func(srv *Server, target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		srv.routeGetFunc(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		return rec
+	}
+
+	rec := get(srv, "/a:audit")
+	s.Equal(http.StatusOK, rec.Code)
+	events := []*AuditEvent{}
+	s.NoError(json.NewDecoder(rec.Body).Decode(&events))
+	s.Len(events, 1)
+
+	rec = get(srv, "/:audit?limit=5")
+	s.Equal(http.StatusOK, rec.Code)
+	s.NoError(json.NewDecoder(rec.Body).Decode(&events))
+	s.Len(events, 1)
+
+	s.Equal(http.StatusBadRequest, get(srv, "/a:audit?limit=0").Code)
+	s.Equal(http.StatusNotImplemented, get(&Server{audit: NewWriterAuditSink(&bytes.Buffer{})}, "/a:audit").Code)
+}
+
+func (s *AuditSuite) TestReload() {
+	buf := &bytes.Buffer{}
+	cfg := &Config{Bucket: "pots"}
+	srv := &Server{audit: NewWriterAuditSink(buf), config: cfg}
+
+	next := &Config{
+		Bucket: "pots",
+		ACL:    []ACLRule{{Path: "**", Principals: []string{"admin"}, Permissions: []Permission{PermissionAdmin}}},
+	}
+	s.Require().NoError(srv.Reload(next))
+
+	event := &AuditEvent{}
+	s.NoError(json.Unmarshal(buf.Bytes(), event))
+	s.Equal(AuditReload, event.Action)
+	s.Equal([]string{"acl"}, event.Keys)
+	s.NotEqual(event.Before["acl"], event.After["acl"])
+	s.Equal(event.Before["policy"], event.After["policy"])
+}
+
+func TestAuditSuite(t *testing.T) {
+	suite.Run(t, new(AuditSuite))
+}
@@ -0,0 +1,245 @@
+package pot
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+)
+
+var (
+	ErrUnauthenticated = errors.New("unauthenticated")
+	ErrInvalidAPIKey   = errors.New("invalid api key")
+)
+
+const (
+	// apiKeyHeader is the header carrying the API key
+	apiKeyHeader = "X-API-Key"
+
+	// bearerPrefix is the scheme of bearer tokens in the Authorization header
+	bearerPrefix = "Bearer "
+)
+
+// Authentication methods of principals.
+const (
+	AuthMethodAPIKey = "apikey"
+	AuthMethodBearer = "bearer"
+)
+
+// Principal is the authenticated caller of a request.
+type Principal struct {
+	// Name identifies the caller, e.g. the name of the API key
+	Name string `json:"name"`
+
+	// Method is the authentication method used by the caller
+	Method string `json:"method"`
+
+	// Subject and Issuer identify the caller of a token across issuers
+	Subject string `json:"subject,omitempty"`
+	Issuer  string `json:"issuer,omitempty"`
+
+	// Groups are the groups the caller belongs to
+	Groups []string `json:"groups,omitempty"`
+
+	// Claims are all claims of the caller's token
+	Claims map[string]any `json:"claims,omitempty"`
+}
+
+type principalKey struct{}
+
+// PrincipalFromContext returns the principal of the authenticated request.
+func PrincipalFromContext(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(*Principal)
+	return p, ok
+}
+
+// ContextWithPrincipal returns the context carrying the principal.
+func ContextWithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// Authenticator authenticates the caller of a request. It returns a nil
+// principal if the request carries no credentials the authenticator
+// recognizes, so the next authenticator can try. Credentials that are
+// recognized but invalid are reported as an error.
+type Authenticator interface {
+	Authenticate(r *http.Request) (*Principal, error)
+}
+
+// WithAuthenticator requires requests to be authenticated by one of the
+// authenticators, tried in order. Health and readiness endpoints stay open.
+func WithAuthenticator(authenticators ...Authenticator) Option {
+	return func(c *Server) {
+		c.authenticators = append(c.authenticators, authenticators...)
+	}
+}
+
+// APIKey is a static key identified by its name. Only the SHA-256 hash of the
+// key is stored, so config files and bucket objects never hold the key itself.
+type APIKey struct {
+	Name string `json:"name" yaml:"name" toml:"name"`
+	Hash string `json:"hash" yaml:"hash" toml:"hash"`
+}
+
+// HashAPIKey returns the hex encoded SHA-256 hash of the key as stored in
+// APIKey.Hash.
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// validate checks that the key has a name and a well formed hash.
+func (k APIKey) validate() error {
+	if k.Name == "" {
+		return errors.New("api key requires a name")
+	}
+
+	hash, err := hex.DecodeString(k.Hash)
+	if err != nil || len(hash) != sha256.Size {
+		return fmt.Errorf("api key %s requires a hex encoded sha256 hash", k.Name)
+	}
+
+	return nil
+}
+
+// ReadAPIKeys decodes a JSON array of API keys.
+func ReadAPIKeys(r io.Reader) ([]APIKey, error) {
+	keys := []APIKey{}
+	if err := json.NewDecoder(r).Decode(&keys); err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// APIKeys authenticates requests carrying one of the keys, either in the
+// X-API-Key header or as a bearer token. The keys can be replaced while the
+// server is running.
+type APIKeys struct {
+	// names maps the key hashes to the names of the keys
+	names atomic.Pointer[map[string]string]
+}
+
+// NewAPIKeys creates the authenticator accepting the keys.
+func NewAPIKeys(keys ...APIKey) (*APIKeys, error) {
+	a := &APIKeys{}
+	if err := a.Set(keys); err != nil {
+		return nil, err
+	}
+
+	return a, nil
+}
+
+// Set replaces the accepted keys. The keys are left unchanged if any of them
+// is invalid.
+func (a *APIKeys) Set(keys []APIKey) error {
+	names := map[string]string{}
+	for _, key := range keys {
+		if err := key.validate(); err != nil {
+			return err
+		}
+
+		names[strings.ToLower(key.Hash)] = key.Name
+	}
+
+	a.names.Store(&names)
+	return nil
+}
+
+func (a *APIKeys) Authenticate(r *http.Request) (*Principal, error) {
+	names := *a.names.Load()
+
+	if key := r.Header.Get(apiKeyHeader); key != "" {
+		name, ok := names[HashAPIKey(key)]
+		if !ok {
+			return nil, ErrInvalidAPIKey
+		}
+
+		return &Principal{Name: name, Method: AuthMethodAPIKey}, nil
+	}
+
+	// unknown bearer tokens are left to the other authenticators, they may
+	// not be API keys at all
+	token, ok := bearerToken(r)
+	if !ok {
+		return nil, nil
+	}
+
+	name, ok := names[HashAPIKey(token)]
+	if !ok {
+		return nil, nil
+	}
+
+	return &Principal{Name: name, Method: AuthMethodBearer}, nil
+}
+
+// bearerToken returns the bearer token of the Authorization header.
+func bearerToken(r *http.Request) (string, bool) {
+	auth := r.Header.Get("Authorization")
+	if len(auth) < len(bearerPrefix) || !strings.EqualFold(auth[:len(bearerPrefix)], bearerPrefix) {
+		return "", false
+	}
+
+	token := strings.TrimSpace(auth[len(bearerPrefix):])
+	return token, token != ""
+}
+
+// authenticate is the middleware rejecting requests that none of the
+// authenticators accepts. The principal is attached to the request context.
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// probes must work without credentials
+		if len(s.authenticators) == 0 || r.URL.Path == "/:healthz" || r.URL.Path == "/:readyz" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		for _, authenticator := range s.authenticators {
+			p, err := authenticator.Authenticate(r)
+			if err != nil {
+				unauthorized(w, err)
+				return
+			}
+
+			if p != nil {
+				next.ServeHTTP(w, r.WithContext(ContextWithPrincipal(r.Context(), p)))
+				return
+			}
+		}
+
+		unauthorized(w, errors.New("missing or unknown credentials"))
+	})
+}
+
+func unauthorized(w http.ResponseWriter, err error) {
+	w.Header().Set("WWW-Authenticate", `Bearer realm="pot"`)
+	http.Error(w, fmt.Sprintf("%s: %s", ErrUnauthenticated, err), http.StatusUnauthorized)
+}
+
+// loadAPIKeys reads the API keys stored as a JSON array in the bucket object.
+func (s *Server) loadAPIKeys(ctx context.Context, object string) ([]APIKey, error) {
+	reader, err := s.bucket.Object(object).NewReader(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read api keys from %s: %w", object, err)
+	}
+	defer reader.Close()
+
+	return ReadAPIKeys(reader)
+}
+
+// apiKeys returns the API key authenticator of the server, if any.
+func (s *Server) apiKeys() *APIKeys {
+	for _, authenticator := range s.authenticators {
+		if keys, ok := authenticator.(*APIKeys); ok {
+			return keys
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,131 @@
+package pot
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type AuthSuite struct {
+	suite.Suite
+}
+
+func (s *AuthSuite) TestAPIKeys() {
+	keys, err := NewAPIKeys(APIKey{Name: "ci", Hash: HashAPIKey("secret")})
+	s.NoError(err)
+
+	cases := []struct {
+		caseName  string
+		header    string
+		value     string
+		principal *Principal
+		err       error
+	}{
+		{"api key header", "X-API-Key", "secret", &Principal{Name: "ci", Method: AuthMethodAPIKey}, nil},
+		{"bearer token", "Authorization", "Bearer secret", &Principal{Name: "ci", Method: AuthMethodBearer}, nil},
+		{"lowercase scheme", "Authorization", "bearer secret", &Principal{Name: "ci", Method: AuthMethodBearer}, nil},
+		{"unknown api key", "X-API-Key", "other", nil, ErrInvalidAPIKey},
+		{"unknown bearer token", "Authorization", "Bearer other", nil, nil},
+		{"basic auth", "Authorization", "Basic c2VjcmV0", nil, nil},
+		{"no credentials", "", "", nil, nil},
+	}
+
+	for _, c := range cases {
+		s.Run(c.caseName, func() {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if c.header != "" {
+				r.Header.Set(c.header, c.value)
+			}
+
+			p, err := keys.Authenticate(r)
+			s.ErrorIs(err, c.err)
+			s.Equal(c.principal, p)
+		})
+	}
+}
+
+func (s *AuthSuite) TestInvalidAPIKeys() {
+	keys, err := NewAPIKeys(APIKey{Name: "ci", Hash: HashAPIKey("secret")})
+	s.NoError(err)
+
+	s.Error(keys.Set([]APIKey{{Name: "ci", Hash: "secret"}}))
+	s.Error(keys.Set([]APIKey{{Hash: HashAPIKey("secret")}}))
+
+	// the previous keys are kept
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("X-API-Key", "secret")
+	p, err := keys.Authenticate(r)
+	s.NoError(err)
+	s.Equal("ci", p.Name)
+}
+
+func (s *AuthSuite) TestReadAPIKeys() {
+	keys, err := ReadAPIKeys(strings.NewReader(`[{"name":"ci","hash":"` + HashAPIKey("secret") + `"}]`))
+	s.NoError(err)
+	s.Equal([]APIKey{{Name: "ci", Hash: HashAPIKey("secret")}}, keys)
+}
+
+func (s *AuthSuite) TestMiddleware() {
+	keys, err := NewAPIKeys(APIKey{Name: "ci", Hash: HashAPIKey("secret")})
+	s.NoError(err)
+	srv := &Server{authenticators: []Authenticator{keys}}
+
+	var principal *Principal
+	handler := srv.authenticate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, _ = PrincipalFromContext(r.Context())
+	}))
+
+	cases := []struct {
+		caseName  string
+		target    string
+		token     string
+		status    int
+		principal *Principal
+	}{
+		{"authenticated", "/pot", "secret", http.StatusOK, &Principal{Name: "ci", Method: AuthMethodBearer}},
+		{"missing credentials", "/pot", "", http.StatusUnauthorized, nil},
+		{"unknown token", "/pot", "other", http.StatusUnauthorized, nil},
+		{"health", "/:healthz", "", http.StatusOK, nil},
+		{"readiness", "/:readyz", "", http.StatusOK, nil},
+	}
+
+	for _, c := range cases {
+		s.Run(c.caseName, func() {
+			principal = nil
+
+			r := httptest.NewRequest(http.MethodGet, c.target, nil)
+			if c.token != "" {
+				r.Header.Set("Authorization", "Bearer "+c.token)
+			}
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, r)
+
+			s.Equal(c.status, rec.Code)
+			s.Equal(c.principal, principal)
+			if c.status == http.StatusUnauthorized {
+				s.NotEmpty(rec.Header().Get("WWW-Authenticate"))
+			}
+		})
+	}
+}
+
+func (s *AuthSuite) TestClientToken() {
+	var auth string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		w.Write([]byte(`{"paths":[]}`))
+	}))
+	defer ts.Close()
+
+	_, err := NewClient[testStruct](ts.URL, WithToken("secret")).ListPaths("")
+	s.NoError(err)
+	s.Equal("Bearer secret", auth)
+}
+
+func TestAuthSuite(t *testing.T) {
+	suite.Run(t, new(AuthSuite))
+}
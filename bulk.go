@@ -0,0 +1,312 @@
+package pot
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+var (
+	ErrInvalidRecord  = errors.New("invalid import record")
+	ErrImportConflict = errors.New("import conflicts with an existing document")
+)
+
+const (
+	// contentTypeNDJSON is the media type of imports and exports
+	contentTypeNDJSON = "application/x-ndjson"
+
+	// importFlushSize is the number of documents buffered for a single pot
+	// before they are written, which bounds the memory used by large imports.
+	importFlushSize = 1000
+
+	// maxRecordSize is the maximum size of a single import line
+	maxRecordSize = 16 << 20
+)
+
+// ConflictPolicy decides what happens when an imported document already exists.
+type ConflictPolicy string
+
+const (
+	// ConflictOverwrite replaces the existing documents
+	ConflictOverwrite ConflictPolicy = "overwrite"
+
+	// ConflictSkip keeps the existing documents
+	ConflictSkip ConflictPolicy = "skip"
+
+	// ConflictFail stops the import at the first existing document
+	ConflictFail ConflictPolicy = "fail"
+)
+
+func (c ConflictPolicy) validate() error {
+	switch c {
+	case ConflictOverwrite, ConflictSkip, ConflictFail:
+		return nil
+	}
+
+	return fmt.Errorf("unknown conflict policy: %s", c)
+}
+
+// Record is a single line of an import or export. The path is relative to the
+// prefix the records are imported to or exported from.
+type Record struct {
+	Path  string          `json:"path"`
+	Key   string          `json:"key"`
+	Value json.RawMessage `json:"value"`
+}
+
+// ImportResponse is the response returned by the Import method.
+type ImportResponse struct {
+	Imported int `json:"imported"`
+	Skipped  int `json:"skipped"`
+}
+
+// Import reads newline delimited records and writes them to the pots under the
+// prefix. Records are grouped by their pots, so each pot is written once per
+// batch of documents instead of once per document. Imports are not atomic, the
+// pots written before an error is encountered keep the imported documents.
+func (s *Server) Import(ctx context.Context, prefix string, r io.Reader, policy ConflictPolicy) (*ImportResponse, error) {
+	ctx, fullEnd := s.trace(ctx, "import", attribute.String("path", prefix))
+	defer fullEnd()
+
+	if err := policy.validate(); err != nil {
+		return nil, err
+	}
+
+	res := &ImportResponse{}
+	pending := map[string]map[string]json.RawMessage{}
+
+	flush := func(dir string) error {
+		imported, skipped, err := s.importDocuments(ctx, dir, pending[dir], policy)
+		res.Imported += imported
+		res.Skipped += skipped
+		delete(pending, dir)
+		return err
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxRecordSize)
+
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+
+		dir, rec, err := parseRecord(prefix, scanner.Bytes())
+		if err != nil {
+			return res, fmt.Errorf("line %d: %w", line, err)
+		}
+
+		if !s.permitted(ctx, PermissionWrite, dir) {
+			return res, fmt.Errorf("line %d: %w: no write permission on /%s", line, ErrForbidden, dir)
+		}
+
+		if err := s.allowedRecord(ctx, dir, rec); err != nil {
+			return res, fmt.Errorf("line %d: %w", line, err)
+		}
+
+		if err := s.limits.checkDocument(rec.Key, rec.Value); err != nil {
+			return res, fmt.Errorf("line %d: %w", line, err)
+		}
+
+		if pending[dir] == nil {
+			pending[dir] = map[string]json.RawMessage{}
+		}
+		pending[dir][rec.Key] = rec.Value
+
+		if len(pending[dir]) >= importFlushSize {
+			if err := flush(dir); err != nil {
+				return res, err
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return res, err
+	}
+
+	for _, dir := range sortedKeys(pending) {
+		if err := flush(dir); err != nil {
+			return res, err
+		}
+	}
+
+	return res, nil
+}
+
+// parseRecord decodes the import line and resolves the pot it belongs to.
+func parseRecord(prefix string, line []byte) (string, *Record, error) {
+	rec := &Record{}
+	if err := json.Unmarshal(line, rec); err != nil {
+		return "", nil, fmt.Errorf("%w: %s", ErrInvalidRecord, err)
+	}
+
+	if rec.Key == "" {
+		return "", nil, fmt.Errorf("%w: missing key", ErrInvalidRecord)
+	}
+	if len(rec.Value) == 0 || rec.Value[0] != '{' {
+		return "", nil, fmt.Errorf("%w: value of %s is not an object", ErrInvalidRecord, rec.Key)
+	}
+
+	// records can't escape the prefix they are imported to
+	prefix = strings.Trim(prefix, "/")
+	dir := strings.Trim(path.Join(prefix, rec.Path), "/")
+	outside := prefix != "" && dir != prefix && !strings.HasPrefix(dir, prefix+"/")
+	if outside || dir == ".." || strings.HasPrefix(dir, "../") {
+		return "", nil, fmt.Errorf("%w: path %s is outside of the prefix", ErrInvalidRecord, rec.Path)
+	}
+	if err := validatePath(dir); err != nil {
+		return "", nil, fmt.Errorf("%w: %w", ErrInvalidRecord, err)
+	}
+
+	return dir, rec, nil
+}
+
+// importDocuments merges the documents into the pot following the conflict
+// policy and returns the number of imported and skipped documents.
+func (s *Server) importDocuments(ctx context.Context, dir string, docs map[string]json.RawMessage, policy ConflictPolicy) (int, int, error) {
+	unlock, err := s.lockPath(ctx, dir, "import")
+	if err != nil {
+		return 0, 0, err
+	}
+	defer unlock()
+
+	reader, err := s.openPot(ctx, dir)
+	if err != nil {
+		return 0, 0, err
+	}
+	if reader != nil {
+		defer reader.Close()
+	}
+
+	writer, err := s.newPotWriter(ctx, dir)
+	if err != nil {
+		return 0, 0, err
+	}
+	writer.limit = s.potLimiter()
+
+	written := map[string]json.RawMessage{}
+	replaced := map[string]bool{}
+	previous := map[string]json.RawMessage{}
+	skipped := 0
+
+	if reader != nil {
+		err := reader.Each(func(key string, doc json.RawMessage) error {
+			next, ok := docs[key]
+			if !ok {
+				return writer.Encode(key, doc)
+			}
+
+			replaced[key] = true
+			switch policy {
+			case ConflictFail:
+				return fmt.Errorf("%w: %s/%s", ErrImportConflict, dir, key)
+			case ConflictSkip:
+				skipped++
+				return writer.Encode(key, doc)
+			}
+
+			written[key] = next
+			if s.keepPrevious() {
+				previous[key] = doc
+			}
+			return writer.Encode(key, next)
+		})
+		if err != nil {
+			writer.Abort()
+			return 0, 0, err
+		}
+	}
+
+	// append documents that didn't exist in the pot yet
+	for _, key := range sortedKeys(docs) {
+		if replaced[key] {
+			continue
+		}
+
+		written[key] = docs[key]
+		if err := writer.Encode(key, docs[key]); err != nil {
+			writer.Abort()
+			return 0, 0, err
+		}
+	}
+
+	if err := writer.Close(); err != nil {
+		return 0, 0, err
+	}
+
+	s.updateIndexes(ctx, dir, previous, written)
+	s.updateCache(dir, reader, writer, written, nil)
+	s.watchers.notify(dir)
+
+	s.recordAudit(ctx, &AuditEvent{
+		Action:     AuditImport,
+		Path:       dir,
+		Keys:       sortedKeys(written),
+		Before:     auditHashes(previous),
+		After:      auditHashes(written),
+		Generation: writer.Attrs().Generation,
+	})
+
+	return len(written), skipped, nil
+}
+
+// Export writes every document stored under the prefix as newline delimited
+// records. Pots are streamed one by one, so exports of any size only hold a
+// single document in memory.
+func (s *Server) Export(ctx context.Context, prefix string, w io.Writer) error {
+	ctx, fullEnd := s.trace(ctx, "export", attribute.String("path", prefix))
+	defer fullEnd()
+
+	prefix = strings.Trim(prefix, "/")
+
+	paths, err := s.ListPaths(ctx, prefix)
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	for _, dir := range paths.Paths {
+		// the listing matches any path starting with the prefix, but only the
+		// pots under the prefix directory are exported
+		if prefix != "" && dir != prefix && !strings.HasPrefix(dir, prefix+"/") {
+			continue
+		}
+
+		// pots the caller may not read are left out
+		if !s.permitted(ctx, PermissionRead, dir) {
+			continue
+		}
+
+		rel := strings.TrimPrefix(strings.TrimPrefix(dir, prefix), "/")
+		if err := s.exportPot(ctx, dir, rel, enc); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *Server) exportPot(ctx context.Context, dir, rel string, enc *json.Encoder) error {
+	s.localRLock(ctx, dir)
+	defer s.localRUnlock(dir)
+
+	reader, err := s.openPot(ctx, dir)
+	if err != nil || reader == nil {
+		return err
+	}
+	defer reader.Close()
+
+	return reader.Each(func(key string, doc json.RawMessage) error {
+		return enc.Encode(Record{Path: rel, Key: key, Value: doc})
+	})
+}
@@ -0,0 +1,57 @@
+package pot
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type BulkSuite struct {
+	suite.Suite
+}
+
+func (s *BulkSuite) TestParseRecord() {
+	dir, rec, err := parseRecord("seed", []byte(`{"path":"users/eu","key":"1","value":{"id":"1"}}`))
+	s.Require().NoError(err)
+	s.Equal("seed/users/eu", dir)
+	s.Equal("1", rec.Key)
+	s.JSONEq(`{"id":"1"}`, string(rec.Value))
+
+	dir, _, err = parseRecord("", []byte(`{"path":"/users/","key":"1","value":{}}`))
+	s.Require().NoError(err)
+	s.Equal("users", dir)
+
+	dir, _, err = parseRecord("seed/", []byte(`{"key":"1","value":{}}`))
+	s.Require().NoError(err)
+	s.Equal("seed", dir)
+}
+
+func (s *BulkSuite) TestParseInvalidRecord() {
+	lines := []string{
+		`not json`,
+		`{"path":"users","value":{}}`,
+		`{"path":"users","key":"1"}`,
+		`{"path":"users","key":"1","value":[1,2]}`,
+		`{"path":"../other","key":"1","value":{}}`,
+		`{"path":"a/../../other","key":"1","value":{}}`,
+	}
+
+	for _, line := range lines {
+		_, _, err := parseRecord("seed", []byte(line))
+		s.ErrorIs(err, ErrInvalidRecord, line)
+	}
+
+	_, _, err := parseRecord("", []byte(`{"path":"../other","key":"1","value":{}}`))
+	s.ErrorIs(err, ErrInvalidRecord)
+}
+
+func (s *BulkSuite) TestConflictPolicy() {
+	s.NoError(ConflictOverwrite.validate())
+	s.NoError(ConflictSkip.validate())
+	s.NoError(ConflictFail.validate())
+	s.Error(ConflictPolicy("merge").validate())
+}
+
+func TestBulkSuite(t *testing.T) {
+	suite.Run(t, new(BulkSuite))
+}
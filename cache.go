@@ -0,0 +1,236 @@
+package pot
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"maps"
+	"sync"
+	"time"
+)
+
+// potCache is an in-process LRU cache of decoded pots keyed by their paths.
+// Every entry remembers the generation of the pot it was decoded from, so it
+// can be revalidated against the object attributes, which is much cheaper than
+// reading and decoding the whole pot.
+type potCache struct {
+	mux sync.Mutex
+
+	// size is the maximum number of cached pots
+	size int
+
+	// staleness is the duration for which the entries are served without being
+	// revalidated. Entries are revalidated on every read if zero.
+	staleness time.Duration
+
+	// lru holds the entries from the most to the least recently used
+	lru     *list.List
+	entries map[string]*list.Element
+}
+
+type cacheEntry struct {
+	dir        string
+	content    map[string]any
+	generation int64
+	validated  time.Time
+}
+
+func newPotCache(size int, staleness time.Duration) *potCache {
+	return &potCache{
+		size:      size,
+		staleness: staleness,
+		lru:       list.New(),
+		entries:   map[string]*list.Element{},
+	}
+}
+
+// WithCache caches up to size decoded pots in memory. Cached pots are revalidated
+// against the generation of the stored object once they are older than the given
+// staleness, or on every read if the staleness is zero, so writes of other
+// instances are observed. Writes made by this server update the cache directly.
+func WithCache(size int, staleness time.Duration) Option {
+	return func(c *Server) {
+		c.cache = newPotCache(size, staleness)
+	}
+}
+
+// resize changes the size and staleness of the cache, evicting the least
+// recently used pots if the cache is over the new size.
+func (c *potCache) resize(size int, staleness time.Duration) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	c.size = size
+	c.staleness = staleness
+	c.evict()
+}
+
+// get returns the cached entry for the path and whether it is still fresh,
+// i.e. it doesn't need to be revalidated.
+func (c *potCache) get(dir string, now time.Time) (*cacheEntry, bool) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	elem, ok := c.entries[dir]
+	if !ok {
+		return nil, false
+	}
+
+	c.lru.MoveToFront(elem)
+	entry := elem.Value.(*cacheEntry)
+
+	return entry, c.staleness > 0 && now.Sub(entry.validated) < c.staleness
+}
+
+// validated marks the entry as matching the stored pot at the given time.
+func (c *potCache) validated(dir string, generation int64, now time.Time) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	if elem, ok := c.entries[dir]; ok {
+		entry := elem.Value.(*cacheEntry)
+		if entry.generation == generation {
+			entry.validated = now
+		}
+	}
+}
+
+// put stores the decoded pot, evicting the least recently used pots if the
+// cache is full.
+func (c *potCache) put(dir string, content map[string]any, generation int64, now time.Time) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	entry := &cacheEntry{
+		dir:        dir,
+		content:    content,
+		generation: generation,
+		validated:  now,
+	}
+
+	if elem, ok := c.entries[dir]; ok {
+		elem.Value = entry
+		c.lru.MoveToFront(elem)
+		return
+	}
+
+	c.entries[dir] = c.lru.PushFront(entry)
+	c.evict()
+}
+
+// evict removes the least recently used pots until the cache fits its size.
+func (c *potCache) evict() {
+	for c.lru.Len() > c.size {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).dir)
+	}
+}
+
+// update applies the local write to the cached pot. The write is only applied
+// if the cached pot is the one the write was based on, otherwise the entry is
+// dropped and the pot is read again on the next Get.
+func (c *potCache) update(dir string, baseGeneration, generation int64, changed map[string]json.RawMessage, removed []string, now time.Time) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	elem, ok := c.entries[dir]
+	if !ok {
+		return
+	}
+
+	entry := elem.Value.(*cacheEntry)
+	if entry.generation != baseGeneration {
+		c.lru.Remove(elem)
+		delete(c.entries, dir)
+		return
+	}
+
+	// cached content may be still used by readers, so it is never modified
+	content := maps.Clone(entry.content)
+	for _, key := range removed {
+		delete(content, key)
+	}
+	for key, doc := range changed {
+		var obj any
+		if err := json.Unmarshal(doc, &obj); err != nil {
+			c.lru.Remove(elem)
+			delete(c.entries, dir)
+			return
+		}
+		content[key] = obj
+	}
+
+	elem.Value = &cacheEntry{
+		dir:        dir,
+		content:    content,
+		generation: generation,
+		validated:  now,
+	}
+}
+
+// remove drops the cached pot, so it is read again on the next Get.
+func (c *potCache) remove(dir string) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	if elem, ok := c.entries[dir]; ok {
+		c.lru.Remove(elem)
+		delete(c.entries, dir)
+	}
+}
+
+// getCached returns a copy of the cached pot if it matches the stored one.
+func (s *Server) getCached(ctx context.Context, dir string) (map[string]any, bool, error) {
+	now := time.Now()
+
+	entry, fresh := s.cache.get(dir, now)
+	if entry == nil {
+		s.recordCacheLookup(ctx, false)
+		return nil, false, nil
+	}
+
+	if !fresh {
+		// pots that don't exist are cached with the zero generation
+		generation, err := s.potGeneration(ctx, dir)
+		if err != nil {
+			return nil, false, err
+		}
+
+		if generation != entry.generation {
+			s.recordCacheLookup(ctx, false)
+			return nil, false, nil
+		}
+
+		s.cache.validated(dir, generation, now)
+	}
+
+	s.recordCacheLookup(ctx, true)
+	return maps.Clone(entry.content), true, nil
+}
+
+// updateCache applies the write of the pot to the cache.
+func (s *Server) updateCache(dir string, reader *potReader, writer *potWriter, changed map[string]json.RawMessage, removed []string) {
+	if s.cache == nil {
+		return
+	}
+
+	var baseGeneration int64
+	if reader != nil {
+		baseGeneration = reader.Attrs.Generation
+	}
+
+	s.cache.update(dir, baseGeneration, writer.Attrs().Generation, changed, removed, time.Now())
+}
+
+func (s *Server) recordCacheLookup(ctx context.Context, hit bool) {
+	if !s.MetricsOptions.Enabled {
+		return
+	}
+
+	if hit {
+		s.MetricsOptions.PotCacheHits.Add(ctx, 1)
+	} else {
+		s.MetricsOptions.PotCacheMisses.Add(ctx, 1)
+	}
+}
@@ -0,0 +1,92 @@
+package pot
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type CacheSuite struct {
+	suite.Suite
+}
+
+func (s *CacheSuite) TestEviction() {
+	now := time.Now()
+	cache := newPotCache(2, time.Minute)
+
+	cache.put("a", map[string]any{}, 1, now)
+	cache.put("b", map[string]any{}, 1, now)
+
+	// touch a, so b becomes the least recently used
+	entry, _ := cache.get("a", now)
+	s.NotNil(entry)
+
+	cache.put("c", map[string]any{}, 1, now)
+
+	entry, _ = cache.get("b", now)
+	s.Nil(entry)
+	entry, _ = cache.get("a", now)
+	s.NotNil(entry)
+	entry, _ = cache.get("c", now)
+	s.NotNil(entry)
+}
+
+func (s *CacheSuite) TestStaleness() {
+	now := time.Now()
+
+	cache := newPotCache(1, time.Minute)
+	cache.put("a", map[string]any{}, 1, now)
+
+	_, fresh := cache.get("a", now.Add(time.Second))
+	s.True(fresh)
+	_, fresh = cache.get("a", now.Add(2*time.Minute))
+	s.False(fresh)
+
+	cache.validated("a", 1, now.Add(2*time.Minute))
+	_, fresh = cache.get("a", now.Add(2*time.Minute+time.Second))
+	s.True(fresh)
+
+	// zero staleness always revalidates
+	cache = newPotCache(1, 0)
+	cache.put("a", map[string]any{}, 1, now)
+	_, fresh = cache.get("a", now)
+	s.False(fresh)
+}
+
+func (s *CacheSuite) TestUpdate() {
+	now := time.Now()
+	cache := newPotCache(1, time.Minute)
+
+	original := map[string]any{"a": map[string]any{"id": "a"}, "b": map[string]any{"id": "b"}}
+	cache.put("p", original, 1, now)
+
+	cache.update("p", 1, 2, map[string]json.RawMessage{"c": json.RawMessage(`{"id":"c"}`)}, []string{"a"}, now)
+
+	entry, _ := cache.get("p", now)
+	s.Require().NotNil(entry)
+	s.Equal(int64(2), entry.generation)
+	s.Equal(map[string]any{"b": map[string]any{"id": "b"}, "c": map[string]any{"id": "c"}}, entry.content)
+
+	// content handed out to readers must stay untouched
+	s.Len(original, 2)
+	s.Contains(original, "a")
+}
+
+func (s *CacheSuite) TestUpdateOfDifferentGeneration() {
+	now := time.Now()
+	cache := newPotCache(1, time.Minute)
+
+	cache.put("p", map[string]any{}, 1, now)
+
+	// the write was based on a generation written by another instance
+	cache.update("p", 5, 6, map[string]json.RawMessage{"c": json.RawMessage(`{}`)}, nil, now)
+
+	entry, _ := cache.get("p", now)
+	s.Nil(entry)
+}
+
+func TestCacheSuite(t *testing.T) {
+	suite.Run(t, new(CacheSuite))
+}
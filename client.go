@@ -2,10 +2,12 @@ package pot
 
 import (
 	"bytes"
-	"encoding/json"
+	"crypto/tls"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"path"
 	"strconv"
 	"sync"
 )
@@ -35,53 +37,249 @@ type Client[T Unique] struct {
 
 	// client is the HTTP client used to make requests to the Pot API server.
 	client *http.Client
+
+	// codec is the wire format used for requests and responses.
+	codec Codec
+
+	// token is sent as the bearer token of every request if set.
+	token string
+}
+
+// ClientOptions is a set of options that configure the Client.
+type ClientOptions struct {
+	codec     Codec
+	token     string
+	tlsConfig *tls.Config
+	certs     []tls.Certificate
+}
+
+// ClientOption is a functional option for the Client. It allows to
+// configure the client via its constructor.
+type ClientOption func(*ClientOptions)
+
+// WithCodec sets the wire format used to talk to the Pot API server.
+// JSON is used by default.
+func WithCodec(codec Codec) ClientOption {
+	return func(o *ClientOptions) {
+		o.codec = codec
+	}
+}
+
+// WithToken authenticates the requests with the token, e.g. an API key, sent
+// as a bearer token in the Authorization header.
+func WithToken(token string) ClientOption {
+	return func(o *ClientOptions) {
+		o.token = token
+	}
+}
+
+// WithTLSConfig sets the TLS config of the connections to the Pot API server,
+// e.g. to trust a private CA.
+func WithTLSConfig(cfg *tls.Config) ClientOption {
+	return func(o *ClientOptions) {
+		o.tlsConfig = cfg
+	}
+}
+
+// WithClientCertificate presents the certificate to Pot API servers that
+// require mutual TLS.
+func WithClientCertificate(cert tls.Certificate) ClientOption {
+	return func(o *ClientOptions) {
+		o.certs = append(o.certs, cert)
+	}
+}
+
+// httpClient returns the HTTP client using the TLS options, or the default
+// client if there are none.
+func (o *ClientOptions) httpClient() *http.Client {
+	if o.tlsConfig == nil && len(o.certs) == 0 {
+		return http.DefaultClient
+	}
+
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if o.tlsConfig != nil {
+		cfg = o.tlsConfig.Clone()
+	}
+	cfg.Certificates = append(cfg.Certificates, o.certs...)
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = cfg
+
+	return &http.Client{Transport: transport}
 }
 
 // NewClient creates a new APIClient.
-func NewClient[T Unique](baseURL string) *Client[T] {
+func NewClient[T Unique](baseURL string, co ...ClientOption) *Client[T] {
 	if baseURL[len(baseURL)-1] != '/' {
 		baseURL += "/"
 	}
 
+	opts := &ClientOptions{
+		codec: CodecJSON,
+	}
+	for _, opt := range co {
+		opt(opts)
+	}
+
 	return &Client[T]{
 		BaseURL:              baseURL,
 		ownedPathGenerations: map[string]int64{},
-		client:               http.DefaultClient,
+		client:               opts.httpClient(),
+		codec:                opts.codec,
+		token:                opts.token,
 	}
 }
 
+// newRequest creates a request to the Pot API server with headers
+// matching the configured codec.
+func (c *Client[T]) newRequest(method, urlPath string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequest(method, c.BaseURL+urlPath, body)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Accept", c.codec.ContentType())
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", c.codec.ContentType())
+	}
+
+	return req, nil
+}
+
 // ListPaths lists all available paths on the bucket
 func (c *Client[T]) ListPaths(urlPath string) (*ListPathsResponse, error) {
 	respObj := ListPathsResponse{}
 
-	req, err := http.NewRequest(http.MethodGet, c.BaseURL+urlPath+":list", nil)
+	req, err := c.newRequest(http.MethodGet, urlPath+":list", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, unexpectedStatus(resp)
+	}
+
+	if err := c.codec.Decode(resp.Body, &respObj); err != nil {
+		return nil, err
+	}
+
+	return &respObj, nil
+}
+
+// Query returns the paths and keys of documents with the given value of the
+// field indexed by the named index.
+func (c *Client[T]) Query(index, value string) (*IndexResponse, error) {
+	respObj := IndexResponse{}
+
+	req, err := c.newRequest(http.MethodGet, ":index/"+url.PathEscape(index), nil)
 	if err != nil {
 		return nil, err
 	}
+	req.URL.RawQuery = url.Values{"value": {value}}.Encode()
 
 	resp, err := c.client.Do(req)
 	if err != nil {
 		return nil, err
 	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, unexpectedStatus(resp)
+	}
 
-	if err := json.NewDecoder(resp.Body).Decode(&respObj); err != nil {
+	if err := c.codec.Decode(resp.Body, &respObj); err != nil {
 		return nil, err
 	}
 
 	return &respObj, nil
 }
 
+// RebuildIndex recreates the named index from the documents of all pots it
+// covers. It requires the admin permission.
+func (c *Client[T]) RebuildIndex(index string) (*IndexRebuildResponse, error) {
+	respObj := IndexRebuildResponse{}
+
+	req, err := c.newRequest(http.MethodPost, ":index/"+url.PathEscape(index), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, unexpectedStatus(resp)
+	}
+
+	if err := c.codec.Decode(resp.Body, &respObj); err != nil {
+		return nil, err
+	}
+
+	return &respObj, nil
+}
+
+// AuditTrail returns the last audit events of the pot, oldest first. All
+// events up to the server's default limit are returned if limit is 0.
+func (c *Client[T]) AuditTrail(urlPath string, limit int) ([]*AuditEvent, error) {
+	events := []*AuditEvent{}
+
+	req, err := c.newRequest(http.MethodGet, urlPath+":audit", nil)
+	if err != nil {
+		return nil, err
+	}
+	if limit > 0 {
+		req.URL.RawQuery = url.Values{"limit": {strconv.Itoa(limit)}}.Encode()
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, unexpectedStatus(resp)
+	}
+
+	if err := c.codec.Decode(resp.Body, &events); err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
+
 // Get calls the GET method on the Pot API server.
 func (c *Client[T]) Get(urlPath string) (map[string]T, error) {
 	content := map[string]T{}
 
-	resp, err := c.client.Get(c.BaseURL + urlPath)
+	req, err := c.newRequest(http.MethodGet, urlPath, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.client.Do(req)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 
-	if err := json.NewDecoder(resp.Body).Decode(&content); err != nil {
+	if resp.StatusCode != http.StatusOK {
+		return nil, unexpectedStatus(resp)
+	}
+
+	if err := c.codec.Decode(resp.Body, &content); err != nil {
 		return nil, err
 	}
 
@@ -101,12 +299,12 @@ func (c *Client[T]) Create(urlPath string, obj []T, co ...CallOpt) (*CreateRespo
 		content[o.Key()] = o
 	}
 
-	b, err := json.Marshal(content)
-	if err != nil {
+	var b bytes.Buffer
+	if err := c.codec.Encode(&b, content); err != nil {
 		return nil, err
 	}
 
-	req, err := http.NewRequest(http.MethodPost, c.BaseURL+urlPath, bytes.NewReader(b))
+	req, err := c.newRequest(http.MethodPost, urlPath, &b)
 	if err != nil {
 		return nil, err
 	}
@@ -132,16 +330,11 @@ func (c *Client[T]) Create(urlPath string, obj []T, co ...CallOpt) (*CreateRespo
 	}
 
 	if resp.StatusCode != http.StatusCreated {
-		bodyBytes, err := io.ReadAll(resp.Body)
-		if err != nil {
-			return nil, err
-		}
-		bodyString := string(bodyBytes)
-		return nil, fmt.Errorf("unexpected status code: %v, body: %s", resp.StatusCode, bodyString)
+		return nil, unexpectedStatus(resp)
 	}
 
 	var respContent CreateResponse
-	if err := json.NewDecoder(resp.Body).Decode(&respContent); err != nil {
+	if err := c.codec.Decode(resp.Body, &respContent); err != nil {
 		return nil, err
 	}
 
@@ -154,9 +347,58 @@ func (c *Client[T]) Create(urlPath string, obj []T, co ...CallOpt) (*CreateRespo
 	return &respContent, nil
 }
 
+// Increment atomically adds the given amount to the numeric field of the document
+// with the given key. The result can be clamped using the WithMin and WithMax options.
+func (c *Client[T]) Increment(urlPath, key, field string, by float64, co ...CallOpt) (*IncrementResponse, error) {
+	opts := &CallOpts{}
+	for _, opt := range co {
+		opt(opts)
+	}
+
+	req, err := c.newRequest(http.MethodPost, path.Join(urlPath, key)+":increment", nil)
+	if err != nil {
+		return nil, err
+	}
+	q := req.URL.Query()
+	q.Set("field", field)
+	q.Set("by", strconv.FormatFloat(by, 'f', -1, 64))
+	if opts.min != nil {
+		q.Set("min", strconv.FormatFloat(*opts.min, 'f', -1, 64))
+	}
+	if opts.max != nil {
+		q.Set("max", strconv.FormatFloat(*opts.max, 'f', -1, 64))
+	}
+	req.URL.RawQuery = q.Encode()
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, unexpectedStatus(resp)
+	}
+
+	var respContent IncrementResponse
+	if err := c.codec.Decode(resp.Body, &respContent); err != nil {
+		return nil, err
+	}
+
+	// the increment changes the generation of the pot, so the ownership of
+	// the path must follow it
+	c.ownedPathGenerationsMux.Lock()
+	if _, ok := c.ownedPathGenerations[urlPath]; ok {
+		c.ownedPathGenerations[urlPath] = respContent.Generation
+	}
+	c.ownedPathGenerationsMux.Unlock()
+
+	return &respContent, nil
+}
+
 // Remove calls the DELETE method on the Pot API server.
 func (c *Client[T]) Remove(urlPath string, keys ...string) error {
-	req, err := http.NewRequest(http.MethodDelete, c.BaseURL+urlPath, nil)
+	req, err := c.newRequest(http.MethodDelete, urlPath, nil)
 	if err != nil {
 		return err
 	}
@@ -172,5 +414,124 @@ func (c *Client[T]) Remove(urlPath string, keys ...string) error {
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode != http.StatusOK {
+		return unexpectedStatus(resp)
+	}
+
 	return nil
 }
+
+// Import writes the newline delimited records read from r to the pots under
+// the prefix. Existing documents are handled according to the conflict policy.
+func (c *Client[T]) Import(prefix string, r io.Reader, conflict ConflictPolicy) (*ImportResponse, error) {
+	req, err := c.newRequest(http.MethodPost, prefix+":import", r)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", contentTypeNDJSON)
+	q := req.URL.Query()
+	q.Set("conflict", string(conflict))
+	req.URL.RawQuery = q.Encode()
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, unexpectedStatus(resp)
+	}
+
+	var respContent ImportResponse
+	if err := c.codec.Decode(resp.Body, &respContent); err != nil {
+		return nil, err
+	}
+
+	return &respContent, nil
+}
+
+// Export writes all documents stored under the prefix to w as newline
+// delimited records.
+func (c *Client[T]) Export(prefix string, w io.Writer) error {
+	req, err := c.newRequest(http.MethodGet, prefix+":export", nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", contentTypeNDJSON)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return unexpectedStatus(resp)
+	}
+
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
+
+// Snapshot writes a snapshot archive of all pots to w.
+func (c *Client[T]) Snapshot(w io.Writer) error {
+	req, err := c.newRequest(http.MethodGet, ":snapshot", nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/gzip")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return unexpectedStatus(resp)
+	}
+
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
+
+// Restore replays the snapshot archive read from r. If dryRun is set, the
+// changes are only reported and the pots are left untouched.
+func (c *Client[T]) Restore(r io.Reader, dryRun bool) (*RestoreResponse, error) {
+	req, err := c.newRequest(http.MethodPost, ":snapshot", r)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/gzip")
+	if dryRun {
+		req.URL.RawQuery = "dryrun"
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, unexpectedStatus(resp)
+	}
+
+	var respContent RestoreResponse
+	if err := c.codec.Decode(resp.Body, &respContent); err != nil {
+		return nil, err
+	}
+
+	return &respContent, nil
+}
+
+// unexpectedStatus returns an error describing the unexpected response.
+func unexpectedStatus(resp *http.Response) error {
+	bodyBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	bodyString := string(bodyBytes)
+	return fmt.Errorf("unexpected status code: %v, body: %s", resp.StatusCode, bodyString)
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type auditCmd struct {
+	clientFlags
+	outputFlags
+
+	Path  string `arg:"" optional:"" help:"path of the pot, the root pot if empty"`
+	Limit int    `help:"limit is the number of the last events printed" default:"100"`
+}
+
+func (cmd *auditCmd) Run(ctx context.Context) error {
+	client, err := cmd.client()
+	if err != nil {
+		return err
+	}
+
+	events, err := client.AuditTrail(cmd.Path, cmd.Limit)
+	if err != nil {
+		return err
+	}
+
+	rows := [][]string{}
+	for _, event := range events {
+		rows = append(rows, []string{
+			event.Time.Format(time.RFC3339),
+			event.Principal,
+			event.Action,
+			strings.Join(event.Keys, ","),
+			strconv.FormatInt(event.Generation, 10),
+			event.RequestID,
+		})
+	}
+
+	return cmd.print(events, []string{"TIME", "PRINCIPAL", "ACTION", "KEYS", "GENERATION", "REQUEST"}, rows)
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+
+	"github.com/petomalina/pot"
+)
+
+type importCmd struct {
+	clientFlags
+
+	Prefix   string `arg:"" optional:"" help:"prefix the record paths are relative to"`
+	File     string `help:"file with the records, stdin if empty" short:"f" type:"existingfile"`
+	Conflict string `help:"conflict policy for existing documents: overwrite | skip | fail" enum:"overwrite,skip,fail" default:"overwrite"`
+}
+
+func (cmd *importCmd) Run(ctx context.Context) error {
+	client, err := cmd.client()
+	if err != nil {
+		return err
+	}
+
+	var r io.Reader = os.Stdin
+	if cmd.File != "" {
+		f, err := os.Open(cmd.File)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	res, err := client.Import(cmd.Prefix, r, pot.ConflictPolicy(cmd.Conflict))
+	if err != nil {
+		return err
+	}
+
+	slog.Info("import finished", slog.Int("imported", res.Imported), slog.Int("skipped", res.Skipped))
+	return nil
+}
+
+type exportCmd struct {
+	clientFlags
+
+	Prefix string `arg:"" optional:"" help:"prefix of the exported pots"`
+	File   string `help:"file to write the records to, stdout if empty" short:"f"`
+}
+
+func (cmd *exportCmd) Run(ctx context.Context) error {
+	client, err := cmd.client()
+	if err != nil {
+		return err
+	}
+
+	var w io.Writer = os.Stdout
+	if cmd.File != "" {
+		f, err := os.Create(cmd.File)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	return client.Export(cmd.Prefix, w)
+}
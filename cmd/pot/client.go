@@ -0,0 +1,63 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+
+	"github.com/petomalina/pot"
+)
+
+// clientFlags are the flags shared by the commands talking to a running
+// pot server.
+type clientFlags struct {
+	URL     string `help:"url of the pot server" env:"POT_URL" default:"http://localhost:8080"`
+	Token   string `help:"token authenticates the requests, e.g. an API key" env:"POT_TOKEN"`
+	TLSCert string `help:"tls-cert is the client certificate presented to servers requiring mutual TLS" env:"POT_TLS_CERT" type:"existingfile"`
+	TLSKey  string `help:"tls-key is the key file of the client certificate" env:"POT_TLS_KEY" type:"existingfile"`
+	TLSCA   string `help:"tls-ca is the CA bundle verifying the server certificate, the system roots if empty" env:"POT_TLS_CA" type:"existingfile"`
+}
+
+func (f *clientFlags) client() (*pot.Client[document], error) {
+	opts := []pot.ClientOption{}
+	if f.Token != "" {
+		opts = append(opts, pot.WithToken(f.Token))
+	}
+
+	if f.TLSCert != "" || f.TLSKey != "" {
+		cert, err := tls.LoadX509KeyPair(f.TLSCert, f.TLSKey)
+		if err != nil {
+			return nil, err
+		}
+
+		opts = append(opts, pot.WithClientCertificate(cert))
+	}
+
+	if f.TLSCA != "" {
+		b, err := os.ReadFile(f.TLSCA)
+		if err != nil {
+			return nil, err
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(b) {
+			return nil, fmt.Errorf("no certificates found in %s", f.TLSCA)
+		}
+
+		opts = append(opts, pot.WithTLSConfig(&tls.Config{MinVersion: tls.VersionTLS12, RootCAs: pool}))
+	}
+
+	return pot.NewClient[document](f.URL, opts...), nil
+}
+
+// document is an arbitrary pot document keyed by its id or name.
+type document map[string]any
+
+func (d document) Key() string {
+	if id, ok := d["id"]; ok {
+		return fmt.Sprint(id)
+	}
+
+	return fmt.Sprint(d["name"])
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/petomalina/pot"
+)
+
+type getCmd struct {
+	clientFlags
+	outputFlags
+
+	Path string   `arg:"" help:"path of the pot"`
+	Keys []string `arg:"" optional:"" help:"keys of the printed documents, all documents are printed if empty"`
+}
+
+func (cmd *getCmd) Run(ctx context.Context) error {
+	client, err := cmd.client()
+	if err != nil {
+		return err
+	}
+
+	docs, err := client.Get(cmd.Path)
+	if err != nil {
+		return err
+	}
+
+	if len(cmd.Keys) > 0 {
+		selected := map[string]document{}
+		for _, key := range cmd.Keys {
+			if doc, ok := docs[key]; ok {
+				selected[key] = doc
+			}
+		}
+		docs = selected
+	}
+
+	header, rows := documentRows(docs)
+	return cmd.print(docs, header, rows)
+}
+
+type putCmd struct {
+	clientFlags
+	outputFlags
+
+	Path      string        `arg:"" help:"path of the pot"`
+	File      string        `help:"file with a document or an array of documents, stdin if empty" short:"f" type:"existingfile"`
+	NoRewrite time.Duration `help:"no-rewrite rejects the write if the documents were modified within the duration"`
+}
+
+func (cmd *putCmd) Run(ctx context.Context) error {
+	client, err := cmd.client()
+	if err != nil {
+		return err
+	}
+
+	var r io.Reader = os.Stdin
+	if cmd.File != "" {
+		f, err := os.Open(cmd.File)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	docs, err := readDocuments(r)
+	if err != nil {
+		return err
+	}
+
+	callOpts := []pot.CallOpt{}
+	if cmd.NoRewrite > 0 {
+		callOpts = append(callOpts, pot.WithNoRewrite(cmd.NoRewrite))
+	}
+
+	res, err := client.Create(cmd.Path, docs, callOpts...)
+	if err != nil {
+		return err
+	}
+
+	rows := [][]string{}
+	for _, key := range sortedKeys(res.Content) {
+		rows = append(rows, []string{key, strconv.FormatInt(res.Generation, 10)})
+	}
+
+	return cmd.print(res, []string{"KEY", "GENERATION"}, rows)
+}
+
+// readDocuments decodes a single document or an array of documents. Every
+// document needs an id or a name, which is used as its key.
+func readDocuments(r io.Reader) ([]document, error) {
+	var v any
+	if err := json.NewDecoder(r).Decode(&v); err != nil {
+		return nil, err
+	}
+
+	values := []any{v}
+	if arr, ok := v.([]any); ok {
+		values = arr
+	}
+
+	docs := []document{}
+	for i, value := range values {
+		obj, ok := value.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("document %d is not an object", i)
+		}
+
+		doc := document(obj)
+		if _, ok := doc["id"]; !ok {
+			if _, ok := doc["name"]; !ok {
+				return nil, fmt.Errorf("document %d has neither an id nor a name", i)
+			}
+		}
+
+		docs = append(docs, doc)
+	}
+
+	return docs, nil
+}
+
+type rmCmd struct {
+	clientFlags
+
+	Path string   `arg:"" help:"path of the pot"`
+	Keys []string `arg:"" help:"keys of the removed documents"`
+}
+
+func (cmd *rmCmd) Run(ctx context.Context) error {
+	client, err := cmd.client()
+	if err != nil {
+		return err
+	}
+
+	if err := client.Remove(cmd.Path, cmd.Keys...); err != nil {
+		return err
+	}
+
+	slog.Info("documents removed", slog.String("path", cmd.Path), slog.Any("keys", cmd.Keys))
+	return nil
+}
+
+type lsCmd struct {
+	clientFlags
+	outputFlags
+
+	Prefix string `arg:"" optional:"" help:"prefix of the listed paths"`
+}
+
+func (cmd *lsCmd) Run(ctx context.Context) error {
+	client, err := cmd.client()
+	if err != nil {
+		return err
+	}
+
+	res, err := client.ListPaths(cmd.Prefix)
+	if err != nil {
+		return err
+	}
+
+	rows := [][]string{}
+	for _, p := range res.Paths {
+		rows = append(rows, []string{p})
+	}
+
+	return cmd.print(res, []string{"PATH"}, rows)
+}
+
+type watchCmd struct {
+	clientFlags
+	outputFlags
+
+	Path     string        `arg:"" help:"path of the watched pot"`
+	Interval time.Duration `help:"interval between polls of the pot" default:"2s"`
+}
+
+// watchEvent is a change of a single document observed by the watch.
+type watchEvent struct {
+	Time time.Time `json:"time"`
+	pot.WatchEvent
+}
+
+// Run polls the pot and prints the changed documents. The current documents
+// are printed as added on the first poll.
+func (cmd *watchCmd) Run(ctx context.Context) error {
+	client, err := cmd.client()
+	if err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(cmd.Interval)
+	defer ticker.Stop()
+
+	var previous map[string]json.RawMessage
+	for {
+		docs, err := client.Get(cmd.Path)
+		if err == nil {
+			var current map[string]json.RawMessage
+			if current, err = encodeDocuments(docs); err == nil {
+				now := time.Now()
+				for _, event := range pot.WatchEvents(previous, current) {
+					if err := cmd.printEvent(watchEvent{Time: now, WatchEvent: event}); err != nil {
+						return err
+					}
+				}
+				previous = current
+			}
+		}
+		if err != nil {
+			slog.Error("failed to poll the pot", slog.String("path", cmd.Path), slog.String("error", err.Error()))
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func (cmd *watchCmd) printEvent(event watchEvent) error {
+	switch cmd.Output {
+	case "json":
+		return json.NewEncoder(os.Stdout).Encode(event)
+	case "yaml":
+		fmt.Println("---")
+		return pot.CodecYAML.Encode(os.Stdout, event)
+	}
+
+	_, err := fmt.Printf("%s  %-8s  %s\n", event.Time.Format(time.RFC3339), event.Action, event.Key)
+	return err
+}
+
+// encodeDocuments encodes the polled documents so they can be compared with
+// pot.WatchEvents. The keys of the encoded objects are sorted, so equal
+// documents always encode to the same bytes.
+func encodeDocuments(docs map[string]document) (map[string]json.RawMessage, error) {
+	encoded := make(map[string]json.RawMessage, len(docs))
+	for key, doc := range docs {
+		raw, err := json.Marshal(doc)
+		if err != nil {
+			return nil, err
+		}
+		encoded[key] = raw
+	}
+
+	return encoded, nil
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/petomalina/pot"
+	"github.com/stretchr/testify/suite"
+)
+
+type DataSuite struct {
+	suite.Suite
+}
+
+func (s *DataSuite) TestReadDocuments() {
+	cases := []struct {
+		caseName string
+		input    string
+		expected []document
+		err      string
+	}{
+		{"single document", `{"id":"a","age":1}`, []document{{"id": "a", "age": 1.0}}, ""},
+		{"keyed by name", `{"name":"a"}`, []document{{"name": "a"}}, ""},
+		{"array", `[{"id":"a"},{"name":"b"}]`, []document{{"id": "a"}, {"name": "b"}}, ""},
+		{"empty array", `[]`, []document{}, ""},
+		{"without key", `{"age":1}`, nil, "document 0 has neither an id nor a name"},
+		{"array without key", `[{"id":"a"},{"age":1}]`, nil, "document 1 has neither an id nor a name"},
+		{"not an object", `"a"`, nil, "document 0 is not an object"},
+		{"array of scalars", `[{"id":"a"},1]`, nil, "document 1 is not an object"},
+		{"invalid json", `{"id":`, nil, "unexpected EOF"},
+	}
+
+	for _, c := range cases {
+		s.Run(c.caseName, func() {
+			docs, err := readDocuments(strings.NewReader(c.input))
+			if c.err != "" {
+				s.ErrorContains(err, c.err)
+				return
+			}
+
+			s.Require().NoError(err)
+			s.Equal(c.expected, docs)
+		})
+	}
+}
+
+func (s *DataSuite) TestEncodeDocuments() {
+	cases := []struct {
+		caseName string
+		previous map[string]document
+		current  map[string]document
+		expected []pot.WatchEvent
+	}{
+		{
+			"first poll",
+			nil,
+			map[string]document{"b": {"id": "b"}, "a": {"id": "a"}},
+			[]pot.WatchEvent{
+				{Action: pot.WatchAdded, Key: "a", Document: json.RawMessage(`{"id":"a"}`)},
+				{Action: pot.WatchAdded, Key: "b", Document: json.RawMessage(`{"id":"b"}`)},
+			},
+		},
+		{
+			"unchanged",
+			map[string]document{"a": {"id": "a", "age": 1.0, "tags": []any{"x"}}},
+			map[string]document{"a": {"tags": []any{"x"}, "age": 1.0, "id": "a"}},
+			[]pot.WatchEvent{},
+		},
+		{
+			"modified",
+			map[string]document{"a": {"id": "a", "age": 1.0}},
+			map[string]document{"a": {"id": "a", "age": 2.0}},
+			[]pot.WatchEvent{{Action: pot.WatchModified, Key: "a", Document: json.RawMessage(`{"age":2,"id":"a"}`)}},
+		},
+		{
+			"removed",
+			map[string]document{"a": {"id": "a"}, "b": {"id": "b"}},
+			map[string]document{"b": {"id": "b"}},
+			[]pot.WatchEvent{{Action: pot.WatchRemoved, Key: "a"}},
+		},
+	}
+
+	for _, c := range cases {
+		s.Run(c.caseName, func() {
+			previous, err := encodeDocuments(c.previous)
+			s.Require().NoError(err)
+			current, err := encodeDocuments(c.current)
+			s.Require().NoError(err)
+
+			s.Equal(c.expected, pot.WatchEvents(previous, current))
+		})
+	}
+}
+
+func TestDataSuite(t *testing.T) {
+	suite.Run(t, new(DataSuite))
+}
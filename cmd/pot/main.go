@@ -3,98 +3,48 @@ package main
 import (
 	"context"
 	"log/slog"
-	"net/http"
 	"os"
 	"os/signal"
-	"time"
+	"syscall"
 
 	"github.com/alecthomas/kong"
-	"github.com/petomalina/pot"
 )
 
 var cli struct {
-	LogLevel        string `help:"debug | info | warn | error" env:"LOG_LEVEL" default:"info"`
-	Bucket          string `help:"bucket name" env:"BUCKET" required:"true" short:"b"`
-	Zip             string `help:"zip is the path where the zip file is stored" env:"ZIP"`
-	DistributedLock bool   `help:"distributed-lock enables distributed locking of the pot" env:"DISTRIBUTED_LOCK"`
-	Tracing         bool   `help:"tracing enables tracing" env:"TRACING"`
-	Metrics         bool   `help:"metrics enables metrics" env:"METRICS"`
+	LogLevel string `help:"debug | info | warn | error" env:"LOG_LEVEL" default:"info"`
+
+	Serve    serveCmd    `cmd:"" default:"withargs" help:"serve runs the pot server"`
+	Get      getCmd      `cmd:"" help:"get prints the documents of the pot"`
+	Put      putCmd      `cmd:"" help:"put writes documents to the pot"`
+	Rm       rmCmd       `cmd:"" help:"rm removes documents from the pot"`
+	Ls       lsCmd       `cmd:"" help:"ls lists the paths of pots"`
+	Watch    watchCmd    `cmd:"" help:"watch prints changes of the pot's documents"`
+	Import   importCmd   `cmd:"" help:"import writes newline delimited records to the pots under the prefix"`
+	Export   exportCmd   `cmd:"" help:"export prints all documents under the prefix as newline delimited records"`
+	Snapshot snapshotCmd `cmd:"" help:"snapshot creates and restores snapshots of all pots"`
+	Audit    auditCmd    `cmd:"" help:"audit prints the audit trail of the pot"`
 }
 
 func main() {
-	_ = kong.Parse(&cli)
+	kctx := kong.Parse(&cli)
 
 	loglevel := new(slog.Level)
 	err := loglevel.UnmarshalText([]byte(cli.LogLevel))
 	if err != nil {
-		slog.Error("failed to parse log level: %v", err)
+		slog.Error("failed to parse log level", slog.String("error", err.Error()))
 		os.Exit(1)
 	}
 
 	h := slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: *loglevel})
 	slog.SetDefault(slog.New(h))
 
-	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer cancel()
 
-	shutdownOtel, err := pot.BootstrapOTEL(ctx)
-	if err != nil {
-		slog.Error("failed to bootstrap OTEL: %v", err)
-		os.Exit(1)
-	}
-	defer func() {
-		if err := shutdownOtel(ctx); err != nil {
-			slog.Error("failed to shutdown OTEL: %v", err)
-			os.Exit(1)
-		}
-	}()
-
-	opts := []pot.Option{}
-	if cli.DistributedLock {
-		slog.Debug("distributed lock enabled")
-		opts = append(opts, pot.WithDistributedLock())
-	}
-
-	if cli.Zip != "" {
-		slog.Info("zip file enabled")
-		opts = append(opts, pot.WithZip(cli.Zip))
-	}
-
-	if cli.Metrics {
-		slog.Info("metrics enabled")
-		opts = append(opts, pot.WithMetrics())
-	}
-
-	if cli.Tracing {
-		slog.Info("tracing enabled")
-		opts = append(opts, pot.WithTracing())
-	}
-
-	server, err := pot.NewServer(ctx, cli.Bucket, opts...)
-	if err != nil {
-		slog.Error("failed to create pot client: %v", err)
-		os.Exit(1)
-	}
-
-	// register pot handler
-	handler := server.Routes()
-
-	srv := &http.Server{Addr: ":8080", Handler: handler}
-	go func() {
-		slog.Info("starting server on :8080")
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			slog.Error("failed to start server: %v", err)
-			os.Exit(1)
-		}
-	}()
-
-	<-ctx.Done()
-
-	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-	err = srv.Shutdown(shutdownCtx)
-	if err != nil {
-		slog.Error("failed to shutdown server: %v", err)
+	kctx.BindTo(ctx, (*context.Context)(nil))
+	if err := kctx.Run(); err != nil {
+		slog.Error("command failed", slog.String("command", kctx.Command()), slog.String("error", err.Error()))
+		cancel()
 		os.Exit(1)
 	}
 }
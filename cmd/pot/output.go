@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/petomalina/pot"
+)
+
+// outputFlags are the flags of commands printing the server responses.
+type outputFlags struct {
+	Output string `help:"output format: table | json | yaml" short:"o" enum:"table,json,yaml" default:"table"`
+}
+
+// print writes the value in the selected format. Tables are built from the
+// header and the rows, while JSON and YAML encode the value as is.
+func (f *outputFlags) print(v any, header []string, rows [][]string) error {
+	return f.fprint(os.Stdout, v, header, rows)
+}
+
+func (f *outputFlags) fprint(w io.Writer, v any, header []string, rows [][]string) error {
+	switch f.Output {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	case "yaml":
+		return pot.CodecYAML.Encode(w, v)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+	for _, row := range rows {
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+
+	return tw.Flush()
+}
+
+// documentRows renders the documents as table rows with a column for each of
+// the top level fields.
+func documentRows(docs map[string]document) ([]string, [][]string) {
+	fields := map[string]bool{}
+	for _, doc := range docs {
+		for field := range doc {
+			fields[field] = true
+		}
+	}
+
+	header := []string{"KEY"}
+	for _, field := range sortedKeys(fields) {
+		header = append(header, strings.ToUpper(field))
+	}
+
+	rows := [][]string{}
+	for _, key := range sortedKeys(docs) {
+		row := []string{key}
+		for _, field := range sortedKeys(fields) {
+			row = append(row, cell(docs[key][field]))
+		}
+		rows = append(rows, row)
+	}
+
+	return header, rows
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// cell renders the value as a single table cell.
+func cell(v any) string {
+	switch t := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return t
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
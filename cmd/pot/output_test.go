@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type OutputSuite struct {
+	suite.Suite
+}
+
+func (s *OutputSuite) TestDocumentRows() {
+	docs := map[string]document{
+		"b": {"id": "b", "age": 2.0},
+		"a": {"id": "a", "tags": []any{"x", "y"}},
+	}
+
+	header, rows := documentRows(docs)
+	s.Equal([]string{"KEY", "AGE", "ID", "TAGS"}, header)
+	s.Equal([][]string{
+		{"a", "", "a", `["x","y"]`},
+		{"b", "2", "b", ""},
+	}, rows)
+}
+
+func (s *OutputSuite) TestCell() {
+	cases := []struct {
+		caseName string
+		value    any
+		expected string
+	}{
+		{"missing", nil, ""},
+		{"string", "a b", "a b"},
+		{"number", 1.5, "1.5"},
+		{"bool", true, "true"},
+		{"object", map[string]any{"id": "a"}, `{"id":"a"}`},
+	}
+
+	for _, c := range cases {
+		s.Run(c.caseName, func() {
+			s.Equal(c.expected, cell(c.value))
+		})
+	}
+}
+
+func (s *OutputSuite) TestPrint() {
+	value := map[string]any{"paths": []string{"a"}}
+	header, rows := []string{"PATH", "SIZE"}, [][]string{{"a", "1"}, {"teams/red", "12"}}
+
+	cases := []struct {
+		output   string
+		expected string
+	}{
+		{"table", "PATH       SIZE\na          1\nteams/red  12\n"},
+		{"json", "{\n  \"paths\": [\n    \"a\"\n  ]\n}\n"},
+		{"yaml", "paths:\n    - a\n"},
+	}
+
+	for _, c := range cases {
+		s.Run(c.output, func() {
+			var buf bytes.Buffer
+			f := &outputFlags{Output: c.output}
+			s.Require().NoError(f.fprint(&buf, value, header, rows))
+			s.Equal(c.expected, buf.String())
+		})
+	}
+}
+
+func TestOutputSuite(t *testing.T) {
+	suite.Run(t, new(OutputSuite))
+}
@@ -0,0 +1,455 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/petomalina/pot"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+type serveCmd struct {
+	Config            string        `help:"config is a YAML or TOML config file, flags and environment variables take precedence over it" env:"CONFIG" type:"existingfile"`
+	Bucket            string        `help:"bucket name" env:"BUCKET" short:"b"`
+	Listen            []string      `help:"listen addresses, either host:port or unix:/path/to.sock, :8080 if empty" env:"LISTEN"`
+	GRPCListen        []string      `help:"grpc-listen addresses serving the gRPC API, either host:port or unix:/path/to.sock" env:"GRPC_LISTEN"`
+	TLSCert           string        `help:"tls-cert enables TLS on TCP listeners with the given certificate file" env:"TLS_CERT" type:"existingfile"`
+	TLSKey            string        `help:"tls-key is the key file of the TLS certificate" env:"TLS_KEY" type:"existingfile"`
+	TLSClientCA       string        `help:"tls-client-ca requires client certificates verified by the CA bundle" env:"TLS_CLIENT_CA" type:"existingfile"`
+	TLSClientAuth     string        `help:"tls-client-auth is either require or optional to also accept clients without a certificate" env:"TLS_CLIENT_AUTH"`
+	MTLS              bool          `help:"mtls authenticates callers by their client certificates" env:"MTLS"`
+	MTLSTrustDomain   []string      `help:"mtls-trust-domain accepts only client certificates with a SPIFFE ID of the trust domains" env:"MTLS_TRUST_DOMAIN"`
+	APIKey            []string      `help:"api-key accepts the API key in the name:sha256 format, the hash is the hex encoded SHA-256 of the key" env:"API_KEY"`
+	APIKeysObject     string        `help:"api-keys-object accepts the API keys stored as a JSON array in the bucket object" env:"API_KEYS_OBJECT"`
+	JWTIssuer         string        `help:"jwt-issuer enables authentication by JWTs issued by the issuer" env:"JWT_ISSUER"`
+	JWTAudience       []string      `help:"jwt-audience are the accepted audiences of JWTs" env:"JWT_AUDIENCE"`
+	JWKSURL           string        `help:"jwks-url is the URL of the key set verifying JWTs" env:"JWKS_URL"`
+	JWKSFile          string        `help:"jwks-file is a local key set verifying JWTs, used instead of jwks-url" env:"JWKS_FILE" type:"existingfile"`
+	JWTNameClaim      string        `help:"jwt-name-claim is the claim used as the principal name, sub if empty" env:"JWT_NAME_CLAIM"`
+	JWTGroupsClaim    string        `help:"jwt-groups-claim is the claim holding the groups of the principal" env:"JWT_GROUPS_CLAIM"`
+	RateLimit         []string      `help:"rate-limit limits the requests of each client in the rate:burst[:path] format, the rate is per second" env:"RATE_LIMIT"`
+	PolicyFile        string        `help:"policy-file authorizes requests by the Rego policy in the file" env:"POLICY_FILE" type:"existingfile"`
+	PolicyObject      string        `help:"policy-object authorizes requests by the Rego policy in the bucket object" env:"POLICY_OBJECT"`
+	PolicyQuery       string        `help:"policy-query is the query deciding whether requests are allowed, data.pot.allow if empty" env:"POLICY_QUERY"`
+	MaxBodySize       int64         `help:"max-body-size rejects writes with larger bodies, in bytes" env:"MAX_BODY_SIZE"`
+	MaxBatchKeys      int           `help:"max-batch-keys rejects batches of more documents" env:"MAX_BATCH_KEYS"`
+	MaxDocumentSize   int64         `help:"max-document-size rejects larger documents, in bytes" env:"MAX_DOCUMENT_SIZE"`
+	MaxPotSize        int64         `help:"max-pot-size rejects writes growing pots over the size, in bytes" env:"MAX_POT_SIZE"`
+	MaxPotKeys        int           `help:"max-pot-keys rejects writes growing pots over the number of documents" env:"MAX_POT_KEYS"`
+	AuditSink         string        `help:"audit-sink records every mutation and admin action: stdout | file | bucket" env:"AUDIT_SINK"`
+	AuditFile         string        `help:"audit-file is the file the audit events are appended to" env:"AUDIT_FILE"`
+	AuditPrefix       string        `help:"audit-prefix is the bucket prefix of the audit events, .potaudit if empty" env:"AUDIT_PREFIX"`
+	CORSOrigin        []string      `help:"cors-origin allows browser clients of the origin, e.g. https://admin.example.com, * allows any origin" env:"CORS_ORIGIN"`
+	CORSCredentials   bool          `help:"cors-credentials lets browser clients send cookies and authorization headers" env:"CORS_CREDENTIALS"`
+	Zip               string        `help:"zip is the path where the zip file is stored" env:"ZIP"`
+	Compression       string        `help:"compression of stored pots: none | gzip | zstd, zstd pots are only readable by pot" env:"COMPRESSION"`
+	DistributedLock   bool          `help:"distributed-lock enables distributed locking of the pot" env:"DISTRIBUTED_LOCK"`
+	EncryptionKeyfile string        `help:"encryption-keyfile enables encryption of pots using keys from the given keyfile" env:"ENCRYPTION_KEYFILE" type:"existingfile"`
+	EncryptedFields   []string      `help:"encrypted-fields limits the encryption to the given document fields" env:"ENCRYPTED_FIELDS"`
+	Index             []string      `help:"index maintains a secondary index in the name:prefix:field format" env:"INDEX"`
+	CacheSize         int           `help:"cache-size enables caching of up to the given number of pots" env:"CACHE_SIZE"`
+	CacheStaleness    time.Duration `help:"cache-staleness serves cached pots without revalidation for the given duration" env:"CACHE_STALENESS"`
+	GroupCommit       bool          `help:"group-commit coalesces concurrent writes to the same path" env:"GROUP_COMMIT"`
+	GroupCommitMax    int           `help:"group-commit-max limits the number of writes committed together" env:"GROUP_COMMIT_MAX"`
+	ShutdownDelay     time.Duration `help:"shutdown-delay keeps serving with failing readiness for the given duration before shutting down" env:"SHUTDOWN_DELAY"`
+	Tracing           bool          `help:"tracing enables tracing" env:"TRACING"`
+	Metrics           bool          `help:"metrics enables metrics" env:"METRICS"`
+}
+
+// config loads the config file and overrides it with the flags and environment
+// variables that are set. Lists set by flags replace the ones of the file.
+func (cmd *serveCmd) config() (*pot.Config, error) {
+	cfg := &pot.Config{}
+	if cmd.Config != "" {
+		var err error
+		cfg, err = pot.LoadConfig(cmd.Config)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if cmd.Bucket != "" {
+		cfg.Bucket = cmd.Bucket
+	}
+
+	if len(cmd.Listen) > 0 {
+		cfg.Listen = cmd.Listen
+	}
+
+	if len(cmd.GRPCListen) > 0 {
+		cfg.GRPCListen = cmd.GRPCListen
+	}
+
+	// the flags only override the fields they set, so the client CA and the
+	// client auth mode of the file are kept
+	if cfg.TLS == nil && (cmd.TLSCert != "" || cmd.TLSKey != "") {
+		cfg.TLS = &pot.TLSConfig{}
+	}
+	if cfg.TLS != nil && cmd.TLSCert != "" {
+		cfg.TLS.CertFile = cmd.TLSCert
+	}
+	if cfg.TLS != nil && cmd.TLSKey != "" {
+		cfg.TLS.KeyFile = cmd.TLSKey
+	}
+	if cfg.TLS == nil && (cmd.TLSClientCA != "" || cmd.TLSClientAuth != "") {
+		return nil, errors.New("tls-client-ca and tls-client-auth require tls-cert and tls-key")
+	}
+	if cmd.TLSClientCA != "" {
+		cfg.TLS.ClientCAFile = cmd.TLSClientCA
+	}
+	if cmd.TLSClientAuth != "" {
+		cfg.TLS.ClientAuth = cmd.TLSClientAuth
+	}
+
+	if len(cmd.APIKey) > 0 || cmd.APIKeysObject != "" {
+		if cfg.Auth == nil {
+			cfg.Auth = &pot.AuthConfig{}
+		}
+
+		cfg.Auth.APIKeys = nil
+		cfg.Auth.KeysObject = cmd.APIKeysObject
+	}
+	for _, def := range cmd.APIKey {
+		name, hash, ok := strings.Cut(def, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid api key %s, expected name:sha256", def)
+		}
+
+		cfg.Auth.APIKeys = append(cfg.Auth.APIKeys, pot.APIKey{Name: name, Hash: hash})
+	}
+
+	if cmd.JWTIssuer != "" {
+		if cfg.Auth == nil {
+			cfg.Auth = &pot.AuthConfig{}
+		}
+
+		cfg.Auth.JWT = &pot.JWTConfig{
+			Issuer:      cmd.JWTIssuer,
+			Audience:    cmd.JWTAudience,
+			JWKSURL:     cmd.JWKSURL,
+			JWKSFile:    cmd.JWKSFile,
+			NameClaim:   cmd.JWTNameClaim,
+			GroupsClaim: cmd.JWTGroupsClaim,
+		}
+	}
+
+	if cmd.MTLS || len(cmd.MTLSTrustDomain) > 0 {
+		if cfg.Auth == nil {
+			cfg.Auth = &pot.AuthConfig{}
+		}
+		if cfg.Auth.MTLS == nil {
+			cfg.Auth.MTLS = &pot.MTLSConfig{}
+		}
+
+		// the mappings are only configurable in the config file
+		if len(cmd.MTLSTrustDomain) > 0 {
+			cfg.Auth.MTLS.TrustDomains = cmd.MTLSTrustDomain
+		}
+	}
+
+	if len(cmd.RateLimit) > 0 {
+		cfg.RateLimits = nil
+	}
+	for _, def := range cmd.RateLimit {
+		parts := strings.SplitN(def, ":", 3)
+		if len(parts) < 2 {
+			return nil, fmt.Errorf("invalid rate limit %s, expected rate:burst[:path]", def)
+		}
+
+		rate, err := strconv.ParseFloat(parts[0], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rate limit %s: %w", def, err)
+		}
+		burst, err := strconv.Atoi(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid rate limit %s: %w", def, err)
+		}
+
+		rule := pot.RateLimitRule{Rate: rate, Burst: burst}
+		if len(parts) == 3 {
+			rule.Path = parts[2]
+		}
+		cfg.RateLimits = append(cfg.RateLimits, rule)
+	}
+
+	if cmd.PolicyFile != "" || cmd.PolicyObject != "" {
+		cfg.Policy = &pot.PolicyConfig{File: cmd.PolicyFile, Object: cmd.PolicyObject, Query: cmd.PolicyQuery}
+	}
+
+	if cmd.MaxBodySize > 0 || cmd.MaxBatchKeys > 0 || cmd.MaxDocumentSize > 0 || cmd.MaxPotSize > 0 || cmd.MaxPotKeys > 0 {
+		if cfg.Limits == nil {
+			cfg.Limits = &pot.Limits{}
+		}
+	}
+	if cmd.MaxBodySize > 0 {
+		cfg.Limits.MaxBodySize = cmd.MaxBodySize
+	}
+	if cmd.MaxBatchKeys > 0 {
+		cfg.Limits.MaxBatchKeys = cmd.MaxBatchKeys
+	}
+	if cmd.MaxDocumentSize > 0 {
+		cfg.Limits.MaxDocumentSize = cmd.MaxDocumentSize
+	}
+	if cmd.MaxPotSize > 0 {
+		cfg.Limits.MaxPotSize = cmd.MaxPotSize
+	}
+	if cmd.MaxPotKeys > 0 {
+		cfg.Limits.MaxPotKeys = cmd.MaxPotKeys
+	}
+
+	if cmd.AuditSink != "" {
+		cfg.Audit = &pot.AuditConfig{Sink: cmd.AuditSink, File: cmd.AuditFile, Prefix: cmd.AuditPrefix}
+	}
+
+	if len(cmd.CORSOrigin) > 0 {
+		if cfg.CORS == nil {
+			cfg.CORS = &pot.CORS{}
+		}
+		cfg.CORS.AllowedOrigins = cmd.CORSOrigin
+	}
+	if cmd.CORSCredentials && cfg.CORS != nil {
+		cfg.CORS.AllowCredentials = true
+	}
+
+	if cmd.Zip != "" {
+		cfg.Zip = cmd.Zip
+	}
+
+	if cmd.Compression != "" {
+		cfg.Compression = pot.Compression(cmd.Compression)
+	}
+
+	if cmd.DistributedLock {
+		cfg.DistributedLock = true
+	}
+
+	if cmd.EncryptionKeyfile != "" {
+		cfg.Encryption = &pot.EncryptionConfig{Keyfile: cmd.EncryptionKeyfile}
+	}
+	if len(cmd.EncryptedFields) > 0 && cfg.Encryption != nil {
+		cfg.Encryption.Fields = cmd.EncryptedFields
+	}
+
+	if len(cmd.Index) > 0 {
+		cfg.Indexes = nil
+	}
+	for _, def := range cmd.Index {
+		parts := strings.SplitN(def, ":", 3)
+		if len(parts) != 3 {
+			return nil, fmt.Errorf("invalid index definition %s, expected name:prefix:field", def)
+		}
+
+		cfg.Indexes = append(cfg.Indexes, pot.Index{Name: parts[0], Prefix: parts[1], Field: parts[2]})
+	}
+
+	if cmd.CacheSize > 0 {
+		cfg.Cache = &pot.CacheConfig{Size: cmd.CacheSize}
+	}
+	if cmd.CacheStaleness > 0 && cfg.Cache != nil {
+		cfg.Cache.Staleness = pot.Duration(cmd.CacheStaleness)
+	}
+
+	if cmd.GroupCommit {
+		cfg.GroupCommit = &pot.GroupCommitConfig{}
+	}
+	if cmd.GroupCommitMax > 0 && cfg.GroupCommit != nil {
+		cfg.GroupCommit.MaxBatch = cmd.GroupCommitMax
+	}
+
+	if cmd.Metrics {
+		cfg.Metrics = true
+	}
+
+	if cmd.Tracing {
+		cfg.Tracing = true
+	}
+
+	return cfg, cfg.Validate()
+}
+
+func (cmd *serveCmd) Run(ctx context.Context) error {
+	cfg, err := cmd.config()
+	if err != nil {
+		return err
+	}
+
+	shutdownOtel, err := pot.BootstrapOTEL(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to bootstrap OTEL: %w", err)
+	}
+	defer func() {
+		if err := shutdownOtel(context.WithoutCancel(ctx)); err != nil {
+			slog.Error("failed to shutdown OTEL", slog.String("error", err.Error()))
+		}
+	}()
+
+	slog.Info("starting pot", slog.Any("config", cfg))
+
+	server, err := pot.NewServerFromConfig(ctx, cfg)
+	if err != nil {
+		return fmt.Errorf("failed to create pot client: %w", err)
+	}
+
+	var certs *pot.CertReloader
+	if cfg.TLS != nil {
+		certs, err = pot.NewCertReloader(cfg.TLS.CertFile, cfg.TLS.KeyFile, cfg.TLS.CertOptions()...)
+		if err != nil {
+			return fmt.Errorf("failed to load the certificate: %w", err)
+		}
+
+		go certs.Watch(ctx, 30*time.Second)
+	}
+
+	go cmd.reloadOnHangup(ctx, server, certs)
+
+	// register pot handler
+	handler := server.Routes()
+
+	srv := &http.Server{Handler: handler}
+	if certs != nil {
+		srv.TLSConfig = certs.TLSConfig()
+	}
+
+	errs := make(chan error, len(cfg.ListenAddresses())+len(cfg.GRPCListen))
+	for _, addr := range cfg.ListenAddresses() {
+		l, err := pot.Listen(ctx, addr)
+		if err != nil {
+			srv.Close()
+			return fmt.Errorf("failed to listen on %s: %w", addr, err)
+		}
+
+		// TLS is only used on TCP listeners, unix sockets are reachable only
+		// from the same host
+		useTLS := certs != nil && l.Addr().Network() == "tcp"
+
+		go func(addr string) {
+			slog.Info("starting server", slog.String("address", addr), slog.Bool("tls", useTLS))
+
+			var err error
+			if useTLS {
+				err = srv.ServeTLS(l, "", "")
+			} else {
+				err = srv.Serve(l)
+			}
+			if err != nil && err != http.ErrServerClosed {
+				errs <- fmt.Errorf("failed to serve on %s: %w", addr, err)
+			}
+		}(addr)
+	}
+
+	// the gRPC servers by whether they use TLS, which is only used on TCP
+	// listeners as for HTTP
+	grpcServers := map[bool]*grpc.Server{}
+	stopGRPC := func() {
+		for _, grpcSrv := range grpcServers {
+			grpcSrv.Stop()
+		}
+	}
+	for _, addr := range cfg.GRPCListen {
+		l, err := pot.Listen(ctx, addr)
+		if err != nil {
+			srv.Close()
+			stopGRPC()
+			return fmt.Errorf("failed to listen on %s: %w", addr, err)
+		}
+
+		useTLS := certs != nil && l.Addr().Network() == "tcp"
+		if grpcServers[useTLS] == nil {
+			opts := []grpc.ServerOption{}
+			if useTLS {
+				opts = append(opts, grpc.Creds(credentials.NewTLS(certs.TLSConfig())))
+			}
+
+			grpcServers[useTLS] = server.NewGRPCServer(opts...)
+		}
+
+		go func(addr string, grpcSrv *grpc.Server) {
+			slog.Info("starting grpc server", slog.String("address", addr), slog.Bool("tls", useTLS))
+
+			if err := grpcSrv.Serve(l); err != nil {
+				errs <- fmt.Errorf("failed to serve grpc on %s: %w", addr, err)
+			}
+		}(addr, grpcServers[useTLS])
+	}
+
+	select {
+	case <-ctx.Done():
+	case err := <-errs:
+		srv.Close()
+		stopGRPC()
+		return err
+	}
+
+	// readiness fails from now on, the delay gives load balancers time to
+	// notice it before the listeners are closed
+	server.Drain()
+	if cmd.ShutdownDelay > 0 {
+		slog.Info("draining server", slog.Duration("delay", cmd.ShutdownDelay))
+		time.Sleep(cmd.ShutdownDelay)
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		stopGRPC()
+		return fmt.Errorf("failed to shutdown server: %w", err)
+	}
+
+	// watches run until the clients go away, so the gRPC servers are stopped
+	// once the HTTP server is shut down or the timeout passes
+	for _, grpcSrv := range grpcServers {
+		stopped := make(chan struct{})
+		go func(grpcSrv *grpc.Server) {
+			grpcSrv.GracefulStop()
+			close(stopped)
+		}(grpcSrv)
+
+		select {
+		case <-stopped:
+		case <-shutdownCtx.Done():
+			grpcSrv.Stop()
+		}
+	}
+
+	return nil
+}
+
+// reloadOnHangup reloads the config of the server and the certificate on
+// every SIGHUP.
+func (cmd *serveCmd) reloadOnHangup(ctx context.Context, server *pot.Server, certs *pot.CertReloader) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+		}
+
+		cfg, err := cmd.config()
+		if err == nil {
+			err = server.Reload(cfg)
+		}
+		if err == nil && certs != nil {
+			err = certs.Reload()
+		}
+		if err != nil {
+			slog.Error("failed to reload config", slog.String("error", err.Error()))
+			continue
+		}
+
+		slog.Info("config reloaded", slog.Any("config", cfg))
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/petomalina/pot"
+	"github.com/stretchr/testify/suite"
+)
+
+type ServeSuite struct {
+	suite.Suite
+}
+
+func (s *ServeSuite) TestConfigTLS() {
+	p := filepath.Join(s.T().TempDir(), "pot.yaml")
+	s.Require().NoError(os.WriteFile(p, []byte(`
+bucket: pots
+tls:
+  certFile: file.crt
+  keyFile: file.key
+  clientCAFile: ca.pem
+  clientAuth: optional
+`), 0o600))
+
+	cases := []struct {
+		caseName string
+		cmd      serveCmd
+		expected *pot.TLSConfig
+		err      bool
+	}{
+		{
+			"file only",
+			serveCmd{Config: p},
+			&pot.TLSConfig{CertFile: "file.crt", KeyFile: "file.key", ClientCAFile: "ca.pem", ClientAuth: "optional"},
+			false,
+		},
+		{
+			"certificate flags keep the client settings",
+			serveCmd{Config: p, TLSCert: "flag.crt", TLSKey: "flag.key"},
+			&pot.TLSConfig{CertFile: "flag.crt", KeyFile: "flag.key", ClientCAFile: "ca.pem", ClientAuth: "optional"},
+			false,
+		},
+		{
+			"client flags",
+			serveCmd{Config: p, TLSClientCA: "flag-ca.pem", TLSClientAuth: "require"},
+			&pot.TLSConfig{CertFile: "file.crt", KeyFile: "file.key", ClientCAFile: "flag-ca.pem", ClientAuth: "require"},
+			false,
+		},
+		{
+			"flags without file",
+			serveCmd{Bucket: "pots", TLSCert: "flag.crt", TLSKey: "flag.key", TLSClientCA: "flag-ca.pem"},
+			&pot.TLSConfig{CertFile: "flag.crt", KeyFile: "flag.key", ClientCAFile: "flag-ca.pem"},
+			false,
+		},
+		{
+			"client ca without tls",
+			serveCmd{Bucket: "pots", TLSClientCA: "flag-ca.pem"},
+			nil,
+			true,
+		},
+	}
+
+	for _, c := range cases {
+		s.Run(c.caseName, func() {
+			cfg, err := c.cmd.config()
+			if c.err {
+				s.Error(err)
+				return
+			}
+
+			s.Require().NoError(err)
+			s.Equal(c.expected, cfg.TLS)
+		})
+	}
+}
+
+func TestServeSuite(t *testing.T) {
+	suite.Run(t, new(ServeSuite))
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+
+	"cloud.google.com/go/storage"
+	"github.com/petomalina/pot"
+)
+
+type snapshotCmd struct {
+	Create  snapshotCreateCmd  `cmd:"" help:"create writes a snapshot of all pots to a file or a gs://bucket/object"`
+	Restore snapshotRestoreCmd `cmd:"" help:"restore replays a snapshot from a file or a gs://bucket/object"`
+}
+
+type snapshotCreateCmd struct {
+	clientFlags
+
+	Target string `arg:"" help:"file or gs://bucket/object the snapshot is written to"`
+}
+
+func (cmd *snapshotCreateCmd) Run(ctx context.Context) error {
+	client, err := cmd.client()
+	if err != nil {
+		return err
+	}
+
+	writeCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	w, err := createTarget(writeCtx, cmd.Target)
+	if err != nil {
+		return err
+	}
+
+	if err := client.Snapshot(w); err != nil {
+		// the cancelled context aborts uploads to gcs, partial local files are
+		// removed
+		cancel()
+		w.Close()
+		if _, _, ok := splitGCSURL(cmd.Target); !ok {
+			os.Remove(cmd.Target)
+		}
+		return err
+	}
+
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	slog.Info("snapshot created", slog.String("target", cmd.Target))
+	return nil
+}
+
+type snapshotRestoreCmd struct {
+	clientFlags
+
+	Source string `arg:"" help:"file or gs://bucket/object the snapshot is read from"`
+	DryRun bool   `help:"dry-run only prints the changes the restore would make"`
+}
+
+func (cmd *snapshotRestoreCmd) Run(ctx context.Context) error {
+	r, err := openSource(ctx, cmd.Source)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	client, err := cmd.client()
+	if err != nil {
+		return err
+	}
+
+	res, err := client.Restore(r, cmd.DryRun)
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	for _, change := range res.Changes {
+		if change.Action == pot.RestoreUnchanged {
+			continue
+		}
+
+		if err := enc.Encode(change); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// splitGCSURL splits the gs://bucket/object url into its bucket and object.
+func splitGCSURL(u string) (string, string, bool) {
+	rest, ok := strings.CutPrefix(u, "gs://")
+	if !ok {
+		return "", "", false
+	}
+
+	bucket, object, _ := strings.Cut(rest, "/")
+	return bucket, object, true
+}
+
+// createTarget creates the local file or the gcs object for writing.
+func createTarget(ctx context.Context, target string) (io.WriteCloser, error) {
+	bucket, object, ok := splitGCSURL(target)
+	if !ok {
+		return os.Create(target)
+	}
+	if bucket == "" || object == "" {
+		return nil, fmt.Errorf("invalid target %s, expected gs://bucket/object", target)
+	}
+
+	gcs, err := storage.NewClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	w := gcs.Bucket(bucket).Object(object).NewWriter(ctx)
+	w.ContentType = "application/gzip"
+	return w, nil
+}
+
+// openSource opens the local file or the gcs object for reading.
+func openSource(ctx context.Context, source string) (io.ReadCloser, error) {
+	bucket, object, ok := splitGCSURL(source)
+	if !ok {
+		return os.Open(source)
+	}
+	if bucket == "" || object == "" {
+		return nil, fmt.Errorf("invalid source %s, expected gs://bucket/object", source)
+	}
+
+	gcs, err := storage.NewClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return gcs.Bucket(bucket).Object(object).NewReader(ctx)
+}
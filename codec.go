@@ -0,0 +1,259 @@
+package pot
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/vmihailenco/msgpack/v5"
+	"gopkg.in/yaml.v3"
+)
+
+var ErrNotAcceptable = errors.New("none of the accepted media types is supported")
+
+// Codec encodes and decodes the wire format of requests and responses. Pots
+// are always stored as JSON, codecs only change the representation used
+// between the server and its clients.
+type Codec interface {
+	// ContentType is the media type used in Content-Type and Accept headers.
+	ContentType() string
+
+	Encode(w io.Writer, v any) error
+	Decode(r io.Reader, v any) error
+}
+
+var (
+	CodecJSON        Codec = jsonCodec{}
+	CodecYAML        Codec = yamlCodec{}
+	CodecCBOR        Codec = cborCodec{}
+	CodecMessagePack Codec = msgpackCodec{}
+)
+
+// codecsByMediaType maps all recognized media types to their codecs, including
+// the commonly used aliases.
+var codecsByMediaType = map[string]Codec{
+	"application/json":        CodecJSON,
+	"application/yaml":        CodecYAML,
+	"application/x-yaml":      CodecYAML,
+	"text/yaml":               CodecYAML,
+	"application/cbor":        CodecCBOR,
+	"application/msgpack":     CodecMessagePack,
+	"application/x-msgpack":   CodecMessagePack,
+	"application/vnd.msgpack": CodecMessagePack,
+}
+
+// codecForContentType returns the codec used to decode a request body with the
+// given Content-Type header. Requests without the header or with an unknown
+// media type are treated as JSON, as clients like curl send form media types
+// with JSON bodies by default.
+func codecForContentType(contentType string) Codec {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return CodecJSON
+	}
+
+	if codec, ok := codecsByMediaType[mediaType]; ok {
+		return codec
+	}
+
+	return CodecJSON
+}
+
+// negotiateCodec picks the codec for the response based on the Accept header.
+// Media types are tried in the order of their quality, and wildcards fall back
+// to JSON.
+func negotiateCodec(accept string) (Codec, error) {
+	if accept == "" {
+		return CodecJSON, nil
+	}
+
+	type candidate struct {
+		mediaType string
+		q         float64
+	}
+
+	candidates := []candidate{}
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			q, err = strconv.ParseFloat(v, 64)
+			if err != nil {
+				continue
+			}
+		}
+
+		if q > 0 {
+			candidates = append(candidates, candidate{mediaType, q})
+		}
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].q > candidates[j].q
+	})
+
+	for _, c := range candidates {
+		if c.mediaType == "*/*" || c.mediaType == "application/*" {
+			return CodecJSON, nil
+		}
+
+		if codec, ok := codecsByMediaType[c.mediaType]; ok {
+			return codec, nil
+		}
+	}
+
+	return nil, ErrNotAcceptable
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) ContentType() string { return "application/json" }
+
+func (jsonCodec) Encode(w io.Writer, v any) error {
+	return json.NewEncoder(w).Encode(v)
+}
+
+func (jsonCodec) Decode(r io.Reader, v any) error {
+	return json.NewDecoder(r).Decode(v)
+}
+
+type yamlCodec struct{}
+
+func (yamlCodec) ContentType() string { return "application/yaml" }
+
+func (yamlCodec) Encode(w io.Writer, v any) error {
+	g, err := toGeneric(v)
+	if err != nil {
+		return err
+	}
+
+	enc := yaml.NewEncoder(w)
+	if err := enc.Encode(g); err != nil {
+		return err
+	}
+
+	return enc.Close()
+}
+
+func (yamlCodec) Decode(r io.Reader, v any) error {
+	var g any
+	if err := yaml.NewDecoder(r).Decode(&g); err != nil {
+		return err
+	}
+
+	return fromGeneric(g, v)
+}
+
+type cborCodec struct{}
+
+// cborDecMode decodes maps with string keys, so the decoded values can be
+// converted to JSON.
+var cborDecMode, _ = cbor.DecOptions{
+	DefaultMapType: reflect.TypeOf(map[string]any(nil)),
+}.DecMode()
+
+func (cborCodec) ContentType() string { return "application/cbor" }
+
+func (cborCodec) Encode(w io.Writer, v any) error {
+	g, err := toGeneric(v)
+	if err != nil {
+		return err
+	}
+
+	return cbor.NewEncoder(w).Encode(g)
+}
+
+func (cborCodec) Decode(r io.Reader, v any) error {
+	var g any
+	if err := cborDecMode.NewDecoder(r).Decode(&g); err != nil {
+		return err
+	}
+
+	return fromGeneric(g, v)
+}
+
+type msgpackCodec struct{}
+
+func (msgpackCodec) ContentType() string { return "application/msgpack" }
+
+func (msgpackCodec) Encode(w io.Writer, v any) error {
+	g, err := toGeneric(v)
+	if err != nil {
+		return err
+	}
+
+	return msgpack.NewEncoder(w).Encode(g)
+}
+
+func (msgpackCodec) Decode(r io.Reader, v any) error {
+	var g any
+	if err := msgpack.NewDecoder(r).Decode(&g); err != nil {
+		return err
+	}
+
+	return fromGeneric(g, v)
+}
+
+// toGeneric converts the value into maps, slices and scalars following its JSON
+// encoding. This makes all codecs honor the json struct tags, so documents look
+// the same regardless of the wire format they were sent with.
+func toGeneric(v any) (any, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+
+	var g any
+	if err := dec.Decode(&g); err != nil {
+		return nil, err
+	}
+
+	return normalizeNumbers(g), nil
+}
+
+// fromGeneric converts the decoded value into v through its JSON encoding.
+func fromGeneric(g any, v any) error {
+	b, err := json.Marshal(g)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(b, v)
+}
+
+// normalizeNumbers replaces JSON numbers with integers where possible, so binary
+// encodings don't turn integer fields into floats.
+func normalizeNumbers(v any) any {
+	switch t := v.(type) {
+	case json.Number:
+		if i, err := t.Int64(); err == nil {
+			return i
+		}
+		f, _ := t.Float64()
+		return f
+	case map[string]any:
+		for k, val := range t {
+			t[k] = normalizeNumbers(val)
+		}
+	case []any:
+		for i, val := range t {
+			t[i] = normalizeNumbers(val)
+		}
+	}
+
+	return v
+}
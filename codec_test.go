@@ -0,0 +1,101 @@
+package pot
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type CodecSuite struct {
+	suite.Suite
+}
+
+func (s *CodecSuite) TestRoundTrip() {
+	obj := map[string]testStruct{
+		"test": {
+			ID:   "test",
+			Age:  42,
+			Path: []string{"a", "b"},
+			NiceThings: []struct {
+				Name string `json:"name"`
+			}{{Name: "nice"}},
+		},
+	}
+
+	for _, codec := range []Codec{CodecJSON, CodecYAML, CodecCBOR, CodecMessagePack} {
+		s.Run(codec.ContentType(), func() {
+			var buf bytes.Buffer
+			s.Require().NoError(codec.Encode(&buf, obj))
+
+			decoded := map[string]testStruct{}
+			s.Require().NoError(codec.Decode(&buf, &decoded))
+			s.Equal(obj, decoded)
+		})
+	}
+}
+
+func (s *CodecSuite) TestDecodedDocumentsMatchJSON() {
+	// documents sent in any format must be stored the same way as if they
+	// were sent as JSON, including the json struct tags and integer numbers
+	for _, codec := range []Codec{CodecYAML, CodecCBOR, CodecMessagePack} {
+		s.Run(codec.ContentType(), func() {
+			var buf bytes.Buffer
+			s.Require().NoError(codec.Encode(&buf, testStruct{ID: "test", Age: 42}))
+
+			doc := map[string]any{}
+			s.Require().NoError(codec.Decode(&buf, &doc))
+			s.Equal("test", doc["id"])
+			s.Equal(42.0, doc["age"])
+		})
+	}
+}
+
+func (s *CodecSuite) TestNegotiateCodec() {
+	cases := []struct {
+		caseName string
+		accept   string
+		expected Codec
+		err      error
+	}{
+		{"empty", "", CodecJSON, nil},
+		{"wildcard", "*/*", CodecJSON, nil},
+		{"yaml", "application/yaml", CodecYAML, nil},
+		{"yaml alias", "text/yaml", CodecYAML, nil},
+		{"quality", "application/json;q=0.5, application/cbor", CodecCBOR, nil},
+		{"skip unsupported", "text/html, application/x-msgpack;q=0.8", CodecMessagePack, nil},
+		{"zero quality", "application/cbor;q=0", nil, ErrNotAcceptable},
+		{"unsupported", "text/html", nil, ErrNotAcceptable},
+	}
+
+	for _, c := range cases {
+		s.Run(c.caseName, func() {
+			codec, err := negotiateCodec(c.accept)
+			s.ErrorIs(err, c.err)
+			s.Equal(c.expected, codec)
+		})
+	}
+}
+
+func (s *CodecSuite) TestCodecForContentType() {
+	cases := []struct {
+		contentType string
+		expected    Codec
+	}{
+		{"", CodecJSON},
+		{"application/json; charset=utf-8", CodecJSON},
+		{"application/x-yaml", CodecYAML},
+		{"application/vnd.msgpack", CodecMessagePack},
+		{"application/x-www-form-urlencoded", CodecJSON},
+		{"text/plain", CodecJSON},
+		{"not a media type", CodecJSON},
+	}
+
+	for _, c := range cases {
+		s.Equal(c.expected, codecForContentType(c.contentType), c.contentType)
+	}
+}
+
+func TestCodecSuite(t *testing.T) {
+	suite.Run(t, new(CodecSuite))
+}
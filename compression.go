@@ -0,0 +1,66 @@
+package pot
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression is the encoding used to store pots on the bucket. The encoding
+// is recorded in the Content-Encoding metadata of each pot, so every pot is
+// decoded using the encoding it was written with, regardless of the current
+// server setting.
+type Compression string
+
+const (
+	CompressionNone Compression = ""
+	CompressionGzip Compression = "gzip"
+	CompressionZstd Compression = "zstd"
+)
+
+// validate checks whether the compression is supported by the server.
+func (c Compression) validate() error {
+	switch c {
+	case CompressionNone, CompressionGzip, CompressionZstd:
+		return nil
+	}
+
+	return fmt.Errorf("unsupported compression: %s", c)
+}
+
+// compressWriter wraps the writer with the compressor of the given encoding.
+// A nil writer is returned when no compression should be applied.
+func compressWriter(w io.Writer, c Compression) (io.WriteCloser, error) {
+	switch c {
+	case CompressionNone:
+		return nil, nil
+	case CompressionGzip:
+		return gzip.NewWriter(w), nil
+	case CompressionZstd:
+		return zstd.NewWriter(w)
+	}
+
+	return nil, fmt.Errorf("unsupported compression: %s", c)
+}
+
+// decompressReader wraps the reader with the decompressor of the given
+// Content-Encoding.
+func decompressReader(r io.Reader, contentEncoding string) (io.ReadCloser, error) {
+	switch Compression(contentEncoding) {
+	case CompressionNone:
+		return io.NopCloser(r), nil
+	case CompressionGzip:
+		return gzip.NewReader(r)
+	case CompressionZstd:
+		dec, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+
+		return dec.IOReadCloser(), nil
+	}
+
+	return nil, fmt.Errorf("unsupported content encoding: %s", contentEncoding)
+}
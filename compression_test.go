@@ -0,0 +1,55 @@
+package pot
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type CompressionSuite struct {
+	suite.Suite
+}
+
+func (s *CompressionSuite) TestRoundTrip() {
+	content := []byte(`{"a":{"id":"a"},"b":{"id":"b"},"c":{"id":"c"}}` + "\n")
+
+	for _, c := range []Compression{CompressionNone, CompressionGzip, CompressionZstd} {
+		s.Run(string(c), func() {
+			var buf bytes.Buffer
+			var w io.Writer = &buf
+
+			enc, err := compressWriter(&buf, c)
+			s.Require().NoError(err)
+			if enc != nil {
+				w = enc
+			}
+
+			_, err = w.Write(content)
+			s.Require().NoError(err)
+			if enc != nil {
+				s.Require().NoError(enc.Close())
+			}
+
+			dec, err := decompressReader(&buf, string(c))
+			s.Require().NoError(err)
+			defer dec.Close()
+
+			decoded, err := io.ReadAll(dec)
+			s.Require().NoError(err)
+			s.Equal(content, decoded)
+		})
+	}
+}
+
+func (s *CompressionSuite) TestUnsupported() {
+	s.Error(Compression("lz4").validate())
+
+	_, err := decompressReader(bytes.NewReader(nil), "br")
+	s.Error(err)
+}
+
+func TestCompressionSuite(t *testing.T) {
+	suite.Run(t, new(CompressionSuite))
+}
@@ -0,0 +1,811 @@
+package pot
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	ErrInvalidConfig = errors.New("invalid config")
+	ErrNotReloadable = errors.New("config change requires a restart")
+	ErrUnknownFormat = errors.New("unknown config format")
+)
+
+// reloadTimeout limits the duration of reading the reloaded sources from the
+// bucket
+const reloadTimeout = 10 * time.Second
+
+// Config is the configuration of the server. It maps onto the server options
+// and can be loaded from YAML or TOML files.
+type Config struct {
+	// Bucket is the name of the bucket holding the pots
+	Bucket string `json:"bucket" yaml:"bucket" toml:"bucket"`
+
+	// Listen are the addresses the server listens on, either TCP host:port
+	// or unix:/path/to.sock. The server listens on :8080 if empty.
+	Listen []string `json:"listen,omitempty" yaml:"listen,omitempty" toml:"listen,omitempty"`
+
+	// GRPCListen are the addresses the gRPC API is served on, in the format of
+	// Listen. The gRPC API is disabled if empty.
+	GRPCListen []string `json:"grpcListen,omitempty" yaml:"grpcListen,omitempty" toml:"grpcListen,omitempty"`
+
+	// TLS enables TLS on the TCP listeners
+	TLS *TLSConfig `json:"tls,omitempty" yaml:"tls,omitempty" toml:"tls,omitempty"`
+
+	// Auth requires requests to be authenticated
+	Auth *AuthConfig `json:"auth,omitempty" yaml:"auth,omitempty" toml:"auth,omitempty"`
+
+	// ACL restricts the access to the paths, everything is allowed if empty
+	ACL []ACLRule `json:"acl,omitempty" yaml:"acl,omitempty" toml:"acl,omitempty"`
+
+	// RateLimits limit the rate of requests per client and path
+	RateLimits []RateLimitRule `json:"rateLimits,omitempty" yaml:"rateLimits,omitempty" toml:"rateLimits,omitempty"`
+
+	// Policy authorizes requests by a Rego policy
+	Policy *PolicyConfig `json:"policy,omitempty" yaml:"policy,omitempty" toml:"policy,omitempty"`
+
+	// Limits cap the size of writes and pots
+	Limits *Limits `json:"limits,omitempty" yaml:"limits,omitempty" toml:"limits,omitempty"`
+
+	// Audit records every mutation and admin action
+	Audit *AuditConfig `json:"audit,omitempty" yaml:"audit,omitempty" toml:"audit,omitempty"`
+
+	// CORS allows browser clients of other origins to call the server
+	CORS *CORS `json:"cors,omitempty" yaml:"cors,omitempty" toml:"cors,omitempty"`
+
+	// Zip is the path where the zip file is stored, zipping is disabled if empty
+	Zip string `json:"zip,omitempty" yaml:"zip,omitempty" toml:"zip,omitempty"`
+
+	// Compression is the encoding of newly written pots
+	Compression Compression `json:"compression,omitempty" yaml:"compression,omitempty" toml:"compression,omitempty"`
+
+	// DistributedLock enables distributed locking of pots
+	DistributedLock bool `json:"distributedLock,omitempty" yaml:"distributedLock,omitempty" toml:"distributedLock,omitempty"`
+
+	// Encryption enables the envelope encryption of newly written pots
+	Encryption *EncryptionConfig `json:"encryption,omitempty" yaml:"encryption,omitempty" toml:"encryption,omitempty"`
+
+	// Indexes are the secondary indexes maintained on writes
+	Indexes []Index `json:"indexes,omitempty" yaml:"indexes,omitempty" toml:"indexes,omitempty"`
+
+	// Cache enables caching of decoded pots
+	Cache *CacheConfig `json:"cache,omitempty" yaml:"cache,omitempty" toml:"cache,omitempty"`
+
+	// GroupCommit enables coalescing of concurrent writes
+	GroupCommit *GroupCommitConfig `json:"groupCommit,omitempty" yaml:"groupCommit,omitempty" toml:"groupCommit,omitempty"`
+
+	// Metrics enables metrics reporting
+	Metrics bool `json:"metrics,omitempty" yaml:"metrics,omitempty" toml:"metrics,omitempty"`
+
+	// Tracing enables tracing reporting
+	Tracing bool `json:"tracing,omitempty" yaml:"tracing,omitempty" toml:"tracing,omitempty"`
+}
+
+// LogValue logs the config without its auth material. Only the presence of
+// the API keys, JWT, mTLS and encryption settings is logged, along with the
+// sizes of the rule lists.
+func (c Config) LogValue() slog.Value {
+	attrs := []slog.Attr{
+		slog.String("bucket", c.Bucket),
+		slog.Any("listen", c.ListenAddresses()),
+		slog.Any("grpcListen", c.GRPCListen),
+		slog.Bool("tls", c.TLS != nil),
+		slog.Bool("mtls", c.Auth.mtls() != nil),
+		slog.Bool("apiKeys", c.Auth.hasAPIKeys()),
+		slog.Bool("jwt", c.Auth.jwt() != nil),
+		slog.Int("aclRules", len(c.ACL)),
+		slog.Int("rateLimits", len(c.RateLimits)),
+		slog.Bool("policy", c.Policy != nil),
+		slog.Bool("limits", c.Limits != nil),
+		slog.Bool("encryption", c.Encryption != nil),
+		slog.Int("indexes", len(c.Indexes)),
+		slog.Bool("cache", c.Cache != nil),
+		slog.Bool("groupCommit", c.GroupCommit != nil),
+		slog.String("compression", string(c.Compression)),
+		slog.Bool("distributedLock", c.DistributedLock),
+		slog.Bool("metrics", c.Metrics),
+		slog.Bool("tracing", c.Tracing),
+	}
+
+	if c.Audit != nil {
+		attrs = append(attrs, slog.String("audit", c.Audit.Sink))
+	}
+	if c.CORS != nil {
+		attrs = append(attrs, slog.Any("corsOrigins", c.CORS.AllowedOrigins))
+	}
+	if c.Zip != "" {
+		attrs = append(attrs, slog.String("zip", c.Zip))
+	}
+
+	return slog.GroupValue(attrs...)
+}
+
+// EncryptionConfig configures the envelope encryption. The keyfile is read
+// again on every reload, so keys can be rotated without a restart.
+type EncryptionConfig struct {
+	Keyfile string   `json:"keyfile" yaml:"keyfile" toml:"keyfile"`
+	Fields  []string `json:"fields,omitempty" yaml:"fields,omitempty" toml:"fields,omitempty"`
+}
+
+// AuthConfig configures the authentication of requests. The API keys are
+// either listed in the config or stored as a JSON array in a bucket object,
+// both are read again on every reload.
+type AuthConfig struct {
+	APIKeys    []APIKey   `json:"apiKeys,omitempty" yaml:"apiKeys,omitempty" toml:"apiKeys,omitempty"`
+	KeysObject string     `json:"keysObject,omitempty" yaml:"keysObject,omitempty" toml:"keysObject,omitempty"`
+	JWT        *JWTConfig `json:"jwt,omitempty" yaml:"jwt,omitempty" toml:"jwt,omitempty"`
+
+	// MTLS identifies callers by their client certificates, which requires
+	// the TLS client CA
+	MTLS *MTLSConfig `json:"mtls,omitempty" yaml:"mtls,omitempty" toml:"mtls,omitempty"`
+}
+
+// hasAPIKeys reports whether API keys are accepted.
+func (c *AuthConfig) hasAPIKeys() bool {
+	return c != nil && (len(c.APIKeys) > 0 || c.KeysObject != "")
+}
+
+// jwt returns the JWT config, if any.
+func (c *AuthConfig) jwt() *JWTConfig {
+	if c == nil {
+		return nil
+	}
+
+	return c.JWT
+}
+
+// mtls returns the mTLS config, if any.
+func (c *AuthConfig) mtls() *MTLSConfig {
+	if c == nil {
+		return nil
+	}
+
+	return c.MTLS
+}
+
+// MTLSConfig configures how client certificates map onto principals.
+type MTLSConfig struct {
+	TrustDomains []string      `json:"trustDomains,omitempty" yaml:"trustDomains,omitempty" toml:"trustDomains,omitempty"`
+	Mappings     []CertMapping `json:"mappings,omitempty" yaml:"mappings,omitempty" toml:"mappings,omitempty"`
+}
+
+// authenticator creates the client certificate authenticator.
+func (c *MTLSConfig) authenticator() (*CertAuthenticator, error) {
+	return NewCertAuthenticator(MTLSOptions{TrustDomains: c.TrustDomains, Mappings: c.Mappings})
+}
+
+// JWTConfig configures the validation of JWTs. The keys are fetched from the
+// JWKS URL, or read from the local JWKS file.
+type JWTConfig struct {
+	Issuer      string   `json:"issuer" yaml:"issuer" toml:"issuer"`
+	Audience    []string `json:"audience" yaml:"audience" toml:"audience"`
+	JWKSURL     string   `json:"jwksURL,omitempty" yaml:"jwksURL,omitempty" toml:"jwksURL,omitempty"`
+	JWKSFile    string   `json:"jwksFile,omitempty" yaml:"jwksFile,omitempty" toml:"jwksFile,omitempty"`
+	CacheTTL    Duration `json:"cacheTTL,omitempty" yaml:"cacheTTL,omitempty" toml:"cacheTTL,omitempty"`
+	NameClaim   string   `json:"nameClaim,omitempty" yaml:"nameClaim,omitempty" toml:"nameClaim,omitempty"`
+	GroupsClaim string   `json:"groupsClaim,omitempty" yaml:"groupsClaim,omitempty" toml:"groupsClaim,omitempty"`
+}
+
+// authenticator creates the JWT authenticator with its key source.
+func (c *JWTConfig) authenticator() (*JWTAuthenticator, error) {
+	opts := JWTOptions{
+		Issuer:      c.Issuer,
+		Audience:    c.Audience,
+		NameClaim:   c.NameClaim,
+		GroupsClaim: c.GroupsClaim,
+	}
+
+	if c.JWKSFile != "" {
+		keys, err := LoadJWKSFile(c.JWKSFile)
+		if err != nil {
+			return nil, err
+		}
+
+		return NewJWTAuthenticator(keys, opts), nil
+	}
+
+	return NewJWTAuthenticator(NewRemoteJWKS(c.JWKSURL, time.Duration(c.CacheTTL)), opts), nil
+}
+
+// Audit sinks of AuditConfig.
+const (
+	AuditSinkStdout = "stdout"
+	AuditSinkFile   = "file"
+	AuditSinkBucket = "bucket"
+)
+
+// AuditConfig configures where the audit events are recorded. Events are
+// written to stdout, appended to a local file, or stored under a prefix of
+// the bucket, .potaudit if empty.
+type AuditConfig struct {
+	Sink   string `json:"sink" yaml:"sink" toml:"sink"`
+	File   string `json:"file,omitempty" yaml:"file,omitempty" toml:"file,omitempty"`
+	Prefix string `json:"prefix,omitempty" yaml:"prefix,omitempty" toml:"prefix,omitempty"`
+}
+
+// PolicyConfig configures the Rego policy, which is read either from a local
+// file or a bucket object. The policy is read again on every reload.
+type PolicyConfig struct {
+	File   string `json:"file,omitempty" yaml:"file,omitempty" toml:"file,omitempty"`
+	Object string `json:"object,omitempty" yaml:"object,omitempty" toml:"object,omitempty"`
+	Query  string `json:"query,omitempty" yaml:"query,omitempty" toml:"query,omitempty"`
+}
+
+// CacheConfig configures the cache of decoded pots. Both fields can be changed
+// on reload.
+type CacheConfig struct {
+	Size      int      `json:"size" yaml:"size" toml:"size"`
+	Staleness Duration `json:"staleness,omitempty" yaml:"staleness,omitempty" toml:"staleness,omitempty"`
+}
+
+// GroupCommitConfig configures the group commit of writes. The batch size can
+// be changed on reload.
+type GroupCommitConfig struct {
+	MaxBatch int `json:"maxBatch,omitempty" yaml:"maxBatch,omitempty" toml:"maxBatch,omitempty"`
+}
+
+// Duration is a time.Duration written as a string in config files, e.g. 5s.
+type Duration time.Duration
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+func (d *Duration) UnmarshalText(b []byte) error {
+	v, err := time.ParseDuration(string(b))
+	if err != nil {
+		return err
+	}
+
+	*d = Duration(v)
+	return nil
+}
+
+// LoadConfig reads the config file. The format is chosen by the extension of
+// the file, either .yaml, .yml or .toml. Unknown fields are rejected, so typos
+// don't silently fall back to defaults.
+func LoadConfig(path string) (*Config, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &Config{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(bytes.NewReader(b))
+		dec.KnownFields(true)
+		if err := dec.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidConfig, err)
+		}
+	case ".toml":
+		dec := toml.NewDecoder(bytes.NewReader(b))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(cfg); err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidConfig, err)
+		}
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownFormat, path)
+	}
+
+	return cfg, nil
+}
+
+// Validate checks the config for errors that would otherwise surface only
+// once the server is running.
+func (c *Config) Validate() error {
+	errs := []error{}
+	if c.Bucket == "" {
+		errs = append(errs, errors.New("bucket is required"))
+	}
+
+	for _, addr := range append(slices.Clone(c.Listen), c.GRPCListen...) {
+		if _, _, err := parseListenAddress(addr); err != nil {
+			errs = append(errs, fmt.Errorf("invalid listen address %s: %w", addr, err))
+		}
+	}
+
+	if c.TLS != nil && (c.TLS.CertFile == "" || c.TLS.KeyFile == "") {
+		errs = append(errs, errors.New("tls requires a certificate and a key file"))
+	}
+	if c.TLS != nil && !slices.Contains([]string{"", ClientAuthRequire, ClientAuthOptional}, c.TLS.ClientAuth) {
+		errs = append(errs, fmt.Errorf("unknown tls client auth %s, expected require or optional", c.TLS.ClientAuth))
+	}
+
+	if c.Auth != nil {
+		if !c.Auth.hasAPIKeys() && c.Auth.JWT == nil && c.Auth.MTLS == nil {
+			errs = append(errs, errors.New("auth requires api keys, a keys object, jwt or mtls"))
+		}
+		for _, key := range c.Auth.APIKeys {
+			if err := key.validate(); err != nil {
+				errs = append(errs, err)
+			}
+		}
+
+		if jwt := c.Auth.JWT; jwt != nil {
+			if jwt.Issuer == "" || len(jwt.Audience) == 0 {
+				errs = append(errs, errors.New("jwt requires an issuer and an audience"))
+			}
+			if (jwt.JWKSURL == "") == (jwt.JWKSFile == "") {
+				errs = append(errs, errors.New("jwt requires either a jwks url or a jwks file"))
+			}
+		}
+
+		if mtls := c.Auth.MTLS; mtls != nil {
+			if c.TLS == nil || c.TLS.ClientCAFile == "" {
+				errs = append(errs, errors.New("mtls requires a tls client ca file"))
+			}
+			if _, err := mtls.authenticator(); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	if _, err := NewACL(c.ACL...); err != nil {
+		errs = append(errs, err)
+	}
+
+	if _, err := NewRateLimiter(c.RateLimits...); err != nil {
+		errs = append(errs, err)
+	}
+
+	if c.Limits != nil {
+		if err := c.Limits.validate(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if c.CORS != nil {
+		if err := c.CORS.validate(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if c.Audit != nil {
+		switch c.Audit.Sink {
+		case AuditSinkStdout, AuditSinkBucket:
+		case AuditSinkFile:
+			if c.Audit.File == "" {
+				errs = append(errs, errors.New("audit file sink requires a file"))
+			}
+		default:
+			errs = append(errs, fmt.Errorf("unknown audit sink %s, expected stdout, file or bucket", c.Audit.Sink))
+		}
+	}
+
+	if c.Policy != nil && (c.Policy.File == "") == (c.Policy.Object == "") {
+		errs = append(errs, errors.New("policy requires either a file or an object"))
+	}
+
+	if c.Compression != "none" {
+		if err := c.Compression.validate(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if c.Encryption != nil && c.Encryption.Keyfile == "" {
+		errs = append(errs, errors.New("encryption requires a keyfile"))
+	}
+
+	if c.Cache != nil {
+		if c.Cache.Size <= 0 {
+			errs = append(errs, errors.New("cache size must be positive"))
+		}
+		if c.Cache.Staleness < 0 {
+			errs = append(errs, errors.New("cache staleness can't be negative"))
+		}
+	}
+
+	if c.GroupCommit != nil && c.GroupCommit.MaxBatch < 0 {
+		errs = append(errs, errors.New("group commit batch can't be negative"))
+	}
+
+	// indexes are validated against the encryption settings as they would be
+	// by the server
+	s := &Server{indexes: c.Indexes}
+	if c.Encryption != nil {
+		s.encryption = encryptionOptions{keys: &reloadableKeySource{}, fields: c.Encryption.Fields}
+	}
+	if err := s.validateIndexes(); err != nil {
+		errs = append(errs, err)
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("%w: %w", ErrInvalidConfig, errors.Join(errs...))
+	}
+
+	return nil
+}
+
+// ListenAddresses returns the addresses the server listens on.
+func (c *Config) ListenAddresses() []string {
+	if len(c.Listen) == 0 {
+		return []string{defaultListen}
+	}
+
+	return c.Listen
+}
+
+// Options maps the config onto the server options.
+func (c *Config) Options() ([]Option, error) {
+	opts := []Option{}
+
+	if c.Auth.hasAPIKeys() {
+		// keys of the bucket object are added once the server is created
+		keys, err := NewAPIKeys(c.Auth.APIKeys...)
+		if err != nil {
+			return nil, err
+		}
+
+		opts = append(opts, WithAuthenticator(keys))
+	}
+
+	if c.Auth != nil && c.Auth.JWT != nil {
+		jwt, err := c.Auth.JWT.authenticator()
+		if err != nil {
+			return nil, err
+		}
+
+		opts = append(opts, WithAuthenticator(jwt))
+	}
+
+	if c.Auth != nil && c.Auth.MTLS != nil {
+		mtls, err := c.Auth.MTLS.authenticator()
+		if err != nil {
+			return nil, err
+		}
+
+		opts = append(opts, WithAuthenticator(mtls))
+	}
+
+	if len(c.ACL) > 0 {
+		acl, err := NewACL(c.ACL...)
+		if err != nil {
+			return nil, err
+		}
+
+		opts = append(opts, WithACL(acl))
+	}
+
+	if len(c.RateLimits) > 0 {
+		limiter, err := NewRateLimiter(c.RateLimits...)
+		if err != nil {
+			return nil, err
+		}
+
+		opts = append(opts, WithRateLimiter(limiter))
+	}
+
+	if c.Policy != nil && c.Policy.File != "" {
+		// policies of bucket objects are loaded once the server is created
+		policy, err := LoadPolicyFile(context.Background(), c.Policy.Query, c.Policy.File)
+		if err != nil {
+			return nil, err
+		}
+
+		opts = append(opts, WithPolicy(policy))
+	}
+
+	if c.Limits != nil {
+		opts = append(opts, WithLimits(*c.Limits))
+	}
+
+	if c.CORS != nil {
+		opts = append(opts, WithCORS(*c.CORS))
+	}
+
+	if c.Audit != nil {
+		switch c.Audit.Sink {
+		case AuditSinkStdout:
+			opts = append(opts, WithAuditSink(NewWriterAuditSink(os.Stdout)))
+		case AuditSinkFile:
+			sink, err := NewFileAuditSink(c.Audit.File)
+			if err != nil {
+				return nil, err
+			}
+
+			opts = append(opts, WithAuditSink(sink))
+		case AuditSinkBucket:
+			opts = append(opts, WithAuditBucket(c.Audit.Prefix))
+		}
+	}
+
+	if c.Zip != "" {
+		opts = append(opts, WithZip(c.Zip))
+	}
+
+	if c.Compression != "" && c.Compression != "none" {
+		opts = append(opts, WithCompression(c.Compression))
+	}
+
+	if c.DistributedLock {
+		opts = append(opts, WithDistributedLock())
+	}
+
+	if c.Encryption != nil {
+		keys, err := LoadLocalKeySource(c.Encryption.Keyfile)
+		if err != nil {
+			return nil, err
+		}
+
+		// the key source is wrapped so the keys can be swapped on reload
+		opts = append(opts, WithEncryption(newReloadableKeySource(keys), c.Encryption.Fields...))
+	}
+
+	for _, index := range c.Indexes {
+		opts = append(opts, WithIndex(index))
+	}
+
+	if c.Cache != nil {
+		opts = append(opts, WithCache(c.Cache.Size, time.Duration(c.Cache.Staleness)))
+	}
+
+	if c.GroupCommit != nil {
+		opts = append(opts, WithGroupCommit(c.GroupCommit.MaxBatch))
+	}
+
+	if c.Metrics {
+		opts = append(opts, WithMetrics())
+	}
+
+	if c.Tracing {
+		opts = append(opts, WithTracing())
+	}
+
+	return opts, nil
+}
+
+// NewServerFromConfig validates the config and creates a server from it. Other
+// options are applied after the ones of the config. Servers created from a
+// config can be reloaded.
+func NewServerFromConfig(ctx context.Context, cfg *Config, opts ...Option) (*Server, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	cfgOpts, err := cfg.Options()
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := NewServer(ctx, cfg.Bucket, append(cfgOpts, opts...)...)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.Auth != nil && cfg.Auth.KeysObject != "" {
+		keys, err := s.configAPIKeys(ctx, cfg.Auth)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := s.apiKeys().Set(keys); err != nil {
+			return nil, err
+		}
+	}
+
+	if cfg.Policy != nil && cfg.Policy.Object != "" {
+		policy, err := s.loadPolicyObject(ctx, cfg.Policy.Query, cfg.Policy.Object)
+		if err != nil {
+			return nil, err
+		}
+
+		s.policy.Store(policy)
+	}
+
+	s.config = cfg
+	return s, nil
+}
+
+// configAPIKeys returns the API keys listed in the config together with the
+// ones stored in the keys object.
+func (s *Server) configAPIKeys(ctx context.Context, cfg *AuthConfig) ([]APIKey, error) {
+	keys := slices.Clone(cfg.APIKeys)
+	if cfg.KeysObject == "" {
+		return keys, nil
+	}
+
+	stored, err := s.loadAPIKeys(ctx, cfg.KeysObject)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(keys, stored...), nil
+}
+
+// Reload applies the reloadable sections of the config to the running server:
+// the cache size and staleness, the group commit batch size, the encryption
+// keys, the API keys, the ACL, the rate limits and the policy. The config is
+// rejected as a whole with ErrNotReloadable if any other section changed, in
+// which case the server must be restarted.
+func (s *Server) Reload(cfg *Config) error {
+	s.configMux.Lock()
+	defer s.configMux.Unlock()
+
+	if s.config == nil {
+		return fmt.Errorf("%w: server was not created from a config", ErrNotReloadable)
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+
+	if changed := changedSections(s.config, cfg); len(changed) > 0 {
+		return fmt.Errorf("%w: %s", ErrNotReloadable, strings.Join(changed, ", "))
+	}
+
+	// everything that can fail is done before the config is applied
+	var keys KeySource
+	if cfg.Encryption != nil {
+		local, err := LoadLocalKeySource(cfg.Encryption.Keyfile)
+		if err != nil {
+			return err
+		}
+		keys = local
+	}
+
+	var apiKeys []APIKey
+	if cfg.Auth.hasAPIKeys() {
+		ctx, cancel := context.WithTimeout(context.Background(), reloadTimeout)
+		defer cancel()
+
+		var err error
+		apiKeys, err = s.configAPIKeys(ctx, cfg.Auth)
+		if err != nil {
+			return err
+		}
+
+		// keys are validated here, so setting them later can't fail
+		for _, key := range apiKeys {
+			if err := key.validate(); err != nil {
+				return err
+			}
+		}
+	}
+
+	var acl *ACL
+	if len(cfg.ACL) > 0 {
+		var err error
+		acl, err = NewACL(cfg.ACL...)
+		if err != nil {
+			return err
+		}
+	}
+
+	// the buckets are kept unless the rules changed
+	limiter := s.rateLimiter.Load()
+	if !reflect.DeepEqual(s.config.RateLimits, cfg.RateLimits) {
+		limiter = nil
+		if len(cfg.RateLimits) > 0 {
+			var err error
+			limiter, err = NewRateLimiter(cfg.RateLimits...)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	var policy *Policy
+	if cfg.Policy != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), reloadTimeout)
+		defer cancel()
+
+		var err error
+		if cfg.Policy.File != "" {
+			policy, err = LoadPolicyFile(ctx, cfg.Policy.Query, cfg.Policy.File)
+		} else {
+			policy, err = s.loadPolicyObject(ctx, cfg.Policy.Query, cfg.Policy.Object)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if cfg.Cache != nil {
+		s.cache.resize(cfg.Cache.Size, time.Duration(cfg.Cache.Staleness))
+	}
+
+	if cfg.GroupCommit != nil {
+		s.groupCommit.setMaxBatch(cfg.GroupCommit.MaxBatch)
+	}
+
+	if reloadable, ok := s.encryption.keys.(*reloadableKeySource); ok && keys != nil {
+		reloadable.swap(keys)
+	}
+
+	if cfg.Auth.hasAPIKeys() {
+		s.apiKeys().Set(apiKeys)
+	}
+
+	s.acl.Store(acl)
+	s.rateLimiter.Store(limiter)
+	s.policy.Store(policy)
+
+	before, after := auditConfig(s.config), auditConfig(cfg)
+	s.recordAudit(context.Background(), &AuditEvent{
+		Action: AuditReload,
+		Keys:   changedHashes(before, after),
+		Before: before,
+		After:  after,
+	})
+
+	s.config = cfg
+	return nil
+}
+
+// changedSections returns the sections of the config that differ and can't be
+// changed on reload.
+func changedSections(before, after *Config) []string {
+	sections := []struct {
+		name    string
+		changed bool
+	}{
+		{"bucket", before.Bucket != after.Bucket},
+		{"listen", !slices.Equal(before.Listen, after.Listen)},
+		{"grpcListen", !slices.Equal(before.GRPCListen, after.GRPCListen)},
+		{"tls", !reflect.DeepEqual(before.TLS, after.TLS)},
+		{"auth", before.Auth.hasAPIKeys() != after.Auth.hasAPIKeys() ||
+			!reflect.DeepEqual(before.Auth.jwt(), after.Auth.jwt()) ||
+			!reflect.DeepEqual(before.Auth.mtls(), after.Auth.mtls())},
+		{"limits", !reflect.DeepEqual(before.Limits, after.Limits)},
+		{"audit", !reflect.DeepEqual(before.Audit, after.Audit)},
+		{"cors", !reflect.DeepEqual(before.CORS, after.CORS)},
+		{"zip", before.Zip != after.Zip},
+		{"compression", before.Compression != after.Compression},
+		{"distributedLock", before.DistributedLock != after.DistributedLock},
+		{"encryption", (before.Encryption == nil) != (after.Encryption == nil) ||
+			before.Encryption != nil && !slices.Equal(before.Encryption.Fields, after.Encryption.Fields)},
+		{"indexes", !reflect.DeepEqual(before.Indexes, after.Indexes)},
+		{"cache", (before.Cache == nil) != (after.Cache == nil)},
+		{"groupCommit", (before.GroupCommit == nil) != (after.GroupCommit == nil)},
+		{"metrics", before.Metrics != after.Metrics},
+		{"tracing", before.Tracing != after.Tracing},
+	}
+
+	changed := []string{}
+	for _, section := range sections {
+		if section.changed {
+			changed = append(changed, section.name)
+		}
+	}
+
+	return changed
+}
+
+// reloadableKeySource is a key source whose keys can be replaced while the
+// server is running.
+type reloadableKeySource struct {
+	keys atomic.Pointer[KeySource]
+}
+
+func newReloadableKeySource(keys KeySource) *reloadableKeySource {
+	r := &reloadableKeySource{}
+	r.swap(keys)
+	return r
+}
+
+func (r *reloadableKeySource) swap(keys KeySource) {
+	r.keys.Store(&keys)
+}
+
+func (r *reloadableKeySource) WrapKey(ctx context.Context, dataKey []byte) (string, []byte, error) {
+	return (*r.keys.Load()).WrapKey(ctx, dataKey)
+}
+
+func (r *reloadableKeySource) UnwrapKey(ctx context.Context, keyID string, wrapped []byte) ([]byte, error) {
+	return (*r.keys.Load()).UnwrapKey(ctx, keyID, wrapped)
+}
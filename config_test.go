@@ -0,0 +1,176 @@
+package pot
+
+import (
+	"bytes"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type ConfigSuite struct {
+	suite.Suite
+}
+
+func (s *ConfigSuite) writeFile(name, content string) string {
+	p := filepath.Join(s.T().TempDir(), name)
+	s.Require().NoError(os.WriteFile(p, []byte(content), 0o600))
+	return p
+}
+
+func (s *ConfigSuite) expected() *Config {
+	return &Config{
+		Bucket:      "pots",
+		Compression: CompressionZstd,
+		Indexes:     []Index{{Name: "subjects", Prefix: "projects", Field: "subject"}},
+		Cache:       &CacheConfig{Size: 100, Staleness: Duration(5 * time.Second)},
+		GroupCommit: &GroupCommitConfig{MaxBatch: 10},
+		Metrics:     true,
+	}
+}
+
+func (s *ConfigSuite) TestLoadYAML() {
+	cfg, err := LoadConfig(s.writeFile("pot.yaml", `
+bucket: pots
+compression: zstd
+indexes:
+  - name: subjects
+    prefix: projects
+    field: subject
+cache:
+  size: 100
+  staleness: 5s
+groupCommit:
+  maxBatch: 10
+metrics: true
+`))
+	s.Require().NoError(err)
+	s.Equal(s.expected(), cfg)
+	s.NoError(cfg.Validate())
+}
+
+func (s *ConfigSuite) TestLoadTOML() {
+	cfg, err := LoadConfig(s.writeFile("pot.toml", `
+bucket = "pots"
+compression = "zstd"
+metrics = true
+
+[[indexes]]
+name = "subjects"
+prefix = "projects"
+field = "subject"
+
+[cache]
+size = 100
+staleness = "5s"
+
+[groupCommit]
+maxBatch = 10
+`))
+	s.Require().NoError(err)
+	s.Equal(s.expected(), cfg)
+}
+
+func (s *ConfigSuite) TestLoadRejectsUnknown() {
+	_, err := LoadConfig(s.writeFile("pot.yaml", "bucket: pots\ncompresion: zstd\n"))
+	s.ErrorIs(err, ErrInvalidConfig)
+
+	_, err = LoadConfig(s.writeFile("pot.toml", "bucket = \"pots\"\ncompresion = \"zstd\"\n"))
+	s.ErrorIs(err, ErrInvalidConfig)
+
+	_, err = LoadConfig(s.writeFile("pot.json", "{}"))
+	s.ErrorIs(err, ErrUnknownFormat)
+}
+
+func (s *ConfigSuite) TestValidate() {
+	invalid := []*Config{
+		{},
+		{Bucket: "pots", Compression: "brotli"},
+		{Bucket: "pots", Listen: []string{"8080"}},
+		{Bucket: "pots", TLS: &TLSConfig{CertFile: "tls.crt"}},
+		{Bucket: "pots", Auth: &AuthConfig{}},
+		{Bucket: "pots", Policy: &PolicyConfig{}},
+		{Bucket: "pots", ACL: []ACLRule{{Path: "**", Permissions: []Permission{PermissionRead}}}},
+		{Bucket: "pots", Auth: &AuthConfig{JWT: &JWTConfig{Issuer: "https://issuer.example.com", Audience: []string{"pot"}}}},
+		{Bucket: "pots", Auth: &AuthConfig{APIKeys: []APIKey{{Name: "ci", Hash: "secret"}}}},
+		{Bucket: "pots", Encryption: &EncryptionConfig{}},
+		{Bucket: "pots", Cache: &CacheConfig{}},
+		{Bucket: "pots", GroupCommit: &GroupCommitConfig{MaxBatch: -1}},
+		{Bucket: "pots", Indexes: []Index{{Name: "a", Field: "a"}, {Name: "a", Field: "b"}}},
+		{Bucket: "pots", Encryption: &EncryptionConfig{Keyfile: "keys.json"}, Indexes: []Index{{Name: "a", Field: "a"}}},
+	}
+	for _, cfg := range invalid {
+		s.ErrorIs(cfg.Validate(), ErrInvalidConfig, "%+v", cfg)
+	}
+
+	valid := &Config{
+		Bucket:      "pots",
+		Compression: "none",
+		Encryption:  &EncryptionConfig{Keyfile: "keys.json", Fields: []string{"secret"}},
+		Indexes:     []Index{{Name: "a", Field: "a"}},
+	}
+	s.NoError(valid.Validate())
+}
+
+func (s *ConfigSuite) TestChangedSections() {
+	before := s.expected()
+
+	after := s.expected()
+	after.Cache.Size = 1000
+	after.Cache.Staleness = 0
+	after.GroupCommit.MaxBatch = 0
+	s.Empty(changedSections(before, after))
+
+	after.Cache = nil
+	after.Indexes = nil
+	after.Bucket = "other"
+	s.Equal([]string{"bucket", "indexes", "cache"}, changedSections(before, after))
+}
+
+func (s *ConfigSuite) TestLogValue() {
+	cfg := s.expected()
+	cfg.Auth = &AuthConfig{
+		APIKeys:    []APIKey{{Name: "ci", Hash: HashAPIKey("secret-key")}},
+		KeysObject: "secrets/keys.json",
+		JWT:        &JWTConfig{Issuer: "https://issuer.example.com", JWKSURL: "https://issuer.example.com/jwks.json"},
+	}
+	cfg.Encryption = &EncryptionConfig{Keyfile: "/etc/pot/keys.json"}
+	cfg.TLS = &TLSConfig{CertFile: "/etc/pot/tls.crt", KeyFile: "/etc/pot/tls.key"}
+
+	var buf bytes.Buffer
+	slog.New(slog.NewJSONHandler(&buf, nil)).Info("starting pot", slog.Any("config", cfg))
+
+	logged := buf.String()
+	for _, secret := range []string{HashAPIKey("secret-key"), "secrets/keys.json", "issuer.example.com", "/etc/pot"} {
+		s.NotContains(logged, secret)
+	}
+
+	s.Contains(logged, `"bucket":"pots"`)
+	s.Contains(logged, `"apiKeys":true`)
+	s.Contains(logged, `"jwt":true`)
+	s.Contains(logged, `"encryption":true`)
+}
+
+func (s *ConfigSuite) TestResizeCache() {
+	c := newPotCache(3, 0)
+	now := time.Now()
+	for _, dir := range []string{"a", "b", "c"} {
+		c.put(dir, map[string]any{}, 1, now)
+	}
+
+	c.resize(1, time.Minute)
+
+	entry, fresh := c.get("c", now)
+	s.NotNil(entry)
+	s.True(fresh)
+
+	entry, _ = c.get("a", now)
+	s.Nil(entry)
+}
+
+func TestConfigSuite(t *testing.T) {
+	suite.Run(t, new(ConfigSuite))
+}
@@ -0,0 +1,200 @@
+package pot
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	defaultCORSMethods = []string{http.MethodGet, http.MethodHead, http.MethodPost, http.MethodDelete, http.MethodPatch}
+	defaultCORSHeaders = []string{"Accept", "Authorization", "Content-Type", apiKeyHeader, requestIDHeader}
+	defaultCORSExposed = []string{requestIDHeader, "Retry-After"}
+)
+
+// CORS configures the cross-origin requests of browser clients. Requests from
+// other origins are served without CORS headers, so browsers block them.
+type CORS struct {
+	// AllowedOrigins are the origins allowed to call the server, e.g.
+	// https://admin.example.com. A * matches any origin, and a * in the host,
+	// e.g. https://*.example.com, matches any of its subdomains.
+	AllowedOrigins []string `json:"allowedOrigins" yaml:"allowedOrigins" toml:"allowedOrigins"`
+
+	// AllowedMethods are GET, HEAD, POST, DELETE and PATCH if empty
+	AllowedMethods []string `json:"allowedMethods,omitempty" yaml:"allowedMethods,omitempty" toml:"allowedMethods,omitempty"`
+
+	// AllowedHeaders are the request headers used by the pot clients if
+	// empty, a * allows any header
+	AllowedHeaders []string `json:"allowedHeaders,omitempty" yaml:"allowedHeaders,omitempty" toml:"allowedHeaders,omitempty"`
+
+	// ExposedHeaders are the response headers readable by the browser clients,
+	// X-Request-ID and Retry-After if empty
+	ExposedHeaders []string `json:"exposedHeaders,omitempty" yaml:"exposedHeaders,omitempty" toml:"exposedHeaders,omitempty"`
+
+	// AllowCredentials lets browsers send cookies and authorization headers,
+	// which requires explicit origins
+	AllowCredentials bool `json:"allowCredentials,omitempty" yaml:"allowCredentials,omitempty" toml:"allowCredentials,omitempty"`
+
+	// MaxAge is how long browsers cache the preflight responses
+	MaxAge Duration `json:"maxAge,omitempty" yaml:"maxAge,omitempty" toml:"maxAge,omitempty"`
+}
+
+// validate asserts that the origins are set and that credentials are only
+// sent to explicit origins.
+func (c CORS) validate() error {
+	if len(c.AllowedOrigins) == 0 {
+		return errors.New("cors requires allowed origins")
+	}
+
+	if c.AllowCredentials && slices.Contains(c.AllowedOrigins, "*") {
+		return errors.New("cors credentials can't be allowed for any origin")
+	}
+
+	return nil
+}
+
+// WithCORS answers the preflight requests of browsers and adds the CORS
+// headers to the responses for the allowed origins.
+func WithCORS(cors CORS) Option {
+	return func(c *Server) {
+		if len(cors.AllowedMethods) == 0 {
+			cors.AllowedMethods = defaultCORSMethods
+		}
+		if len(cors.AllowedHeaders) == 0 {
+			cors.AllowedHeaders = defaultCORSHeaders
+		}
+		if len(cors.ExposedHeaders) == 0 {
+			cors.ExposedHeaders = defaultCORSExposed
+		}
+
+		c.cors = &cors
+	}
+}
+
+// allowOrigin returns the value of the Access-Control-Allow-Origin header for
+// the origin, false if the origin is not allowed.
+func (c *CORS) allowOrigin(origin string) (string, bool) {
+	for _, allowed := range c.AllowedOrigins {
+		if allowed == "*" {
+			return "*", true
+		}
+
+		if matchOrigin(allowed, origin) {
+			return origin, true
+		}
+	}
+
+	return "", false
+}
+
+// matchOrigin matches the origin against the allowed one. The * of the allowed
+// origin only matches host names, so it can't be used to smuggle in other
+// hosts.
+func matchOrigin(allowed, origin string) bool {
+	prefix, suffix, ok := strings.Cut(strings.ToLower(allowed), "*")
+	if !ok {
+		return strings.EqualFold(allowed, origin)
+	}
+
+	origin = strings.ToLower(origin)
+	if len(origin) <= len(prefix)+len(suffix) || !strings.HasPrefix(origin, prefix) || !strings.HasSuffix(origin, suffix) {
+		return false
+	}
+
+	host := origin[len(prefix) : len(origin)-len(suffix)]
+	return !strings.ContainsFunc(host, func(c rune) bool {
+		return !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-' || c == '.')
+	})
+}
+
+// allowHeaders reports whether all the requested headers are allowed.
+func (c *CORS) allowHeaders(requested string) bool {
+	if slices.Contains(c.AllowedHeaders, "*") {
+		return true
+	}
+
+	for _, h := range strings.Split(requested, ",") {
+		h = strings.TrimSpace(h)
+		if h == "" {
+			continue
+		}
+
+		if !slices.ContainsFunc(c.AllowedHeaders, func(allowed string) bool { return strings.EqualFold(allowed, h) }) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// handleCORS wraps the routes. Preflight requests are answered before they
+// reach the router, which doesn't route OPTIONS requests, and without
+// authentication, since browsers don't send credentials with them.
+func (s *Server) handleCORS(next http.Handler) http.Handler {
+	cors := s.cors
+	if cors == nil {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Add("Vary", "Origin")
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+
+		allowOrigin, ok := cors.allowOrigin(origin)
+		if !ok {
+			if preflight {
+				http.Error(w, "origin not allowed", http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if !preflight {
+			w.Header().Set("Access-Control-Allow-Origin", allowOrigin)
+			if cors.AllowCredentials {
+				w.Header().Set("Access-Control-Allow-Credentials", "true")
+			}
+			w.Header().Set("Access-Control-Expose-Headers", strings.Join(cors.ExposedHeaders, ", "))
+
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Add("Vary", "Access-Control-Request-Method")
+		w.Header().Add("Vary", "Access-Control-Request-Headers")
+
+		method := r.Header.Get("Access-Control-Request-Method")
+		requested := r.Header.Get("Access-Control-Request-Headers")
+		if !slices.Contains(cors.AllowedMethods, method) || !cors.allowHeaders(requested) {
+			http.Error(w, "method or headers not allowed", http.StatusForbidden)
+			return
+		}
+
+		w.Header().Set("Access-Control-Allow-Origin", allowOrigin)
+		w.Header().Set("Access-Control-Allow-Methods", strings.Join(cors.AllowedMethods, ", "))
+		if requested != "" {
+			// the requested headers are echoed, which also covers the * wildcard
+			// that browsers don't honor together with credentials
+			w.Header().Set("Access-Control-Allow-Headers", requested)
+		}
+		if cors.AllowCredentials {
+			w.Header().Set("Access-Control-Allow-Credentials", "true")
+		}
+		if cors.MaxAge > 0 {
+			w.Header().Set("Access-Control-Max-Age", strconv.Itoa(int(time.Duration(cors.MaxAge).Seconds())))
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
@@ -0,0 +1,151 @@
+package pot
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type CORSSuite struct {
+	suite.Suite
+}
+
+func (s *CORSSuite) server(cors CORS) http.Handler {
+	srv := &Server{}
+	WithCORS(cors)(srv)
+
+	return srv.Routes()
+}
+
+func (s *CORSSuite) TestMatchOrigin() {
+	cases := []struct {
+		caseName string
+		allowed  string
+		origin   string
+		match    bool
+	}{
+		{"exact", "https://admin.example.com", "https://admin.example.com", true},
+		{"case insensitive", "https://Admin.example.com", "https://admin.EXAMPLE.com", true},
+		{"other scheme", "https://admin.example.com", "http://admin.example.com", false},
+		{"subdomain", "https://*.example.com", "https://admin.example.com", true},
+		{"nested subdomain", "https://*.example.com", "https://a.b.example.com", true},
+		{"bare domain", "https://*.example.com", "https://example.com", false},
+		{"other domain", "https://*.example.com", "https://example.org", false},
+		{"smuggled host", "https://*.example.com", "https://evil.org/.example.com", false},
+		{"port", "http://localhost:*", "http://localhost:3000", true},
+	}
+
+	for _, c := range cases {
+		s.Run(c.caseName, func() {
+			s.Equal(c.match, matchOrigin(c.allowed, c.origin))
+		})
+	}
+}
+
+func (s *CORSSuite) TestPreflight() {
+	handler := s.server(CORS{
+		AllowedOrigins:   []string{"https://admin.example.com"},
+		AllowCredentials: true,
+		MaxAge:           Duration(10 * time.Minute),
+	})
+
+	preflight := func(origin, method, headers string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodOptions, "/teams/red", nil)
+		r.Header.Set("Origin", origin)
+		r.Header.Set("Access-Control-Request-Method", method)
+		if headers != "" {
+			r.Header.Set("Access-Control-Request-Headers", headers)
+		}
+
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, r)
+		return rec
+	}
+
+	for _, method := range []string{http.MethodGet, http.MethodPost, http.MethodDelete, http.MethodPatch} {
+		s.Run(method, func() {
+			rec := preflight("https://admin.example.com", method, "authorization, content-type")
+			s.Equal(http.StatusNoContent, rec.Code)
+			s.Equal("https://admin.example.com", rec.Header().Get("Access-Control-Allow-Origin"))
+			s.Contains(rec.Header().Get("Access-Control-Allow-Methods"), method)
+			s.Equal("authorization, content-type", rec.Header().Get("Access-Control-Allow-Headers"))
+			s.Equal("true", rec.Header().Get("Access-Control-Allow-Credentials"))
+			s.Equal("600", rec.Header().Get("Access-Control-Max-Age"))
+			s.Contains(rec.Header().Values("Vary"), "Origin")
+		})
+	}
+
+	s.Equal(http.StatusForbidden, preflight("https://evil.example.org", http.MethodGet, "").Code)
+	s.Equal(http.StatusForbidden, preflight("https://admin.example.com", http.MethodPut, "").Code)
+	s.Equal(http.StatusForbidden, preflight("https://admin.example.com", http.MethodGet, "x-custom").Code)
+}
+
+func (s *CORSSuite) TestPreflightSkipsAuth() {
+	keys, err := NewAPIKeys()
+	s.Require().NoError(err)
+
+	srv := &Server{}
+	WithCORS(CORS{AllowedOrigins: []string{"*"}})(srv)
+	WithAuthenticator(keys)(srv)
+
+	r := httptest.NewRequest(http.MethodOptions, "/teams/red", nil)
+	r.Header.Set("Origin", "https://admin.example.com")
+	r.Header.Set("Access-Control-Request-Method", http.MethodPost)
+
+	rec := httptest.NewRecorder()
+	srv.Routes().ServeHTTP(rec, r)
+	s.Equal(http.StatusNoContent, rec.Code)
+	s.Equal("*", rec.Header().Get("Access-Control-Allow-Origin"))
+
+	// rejected requests still carry the headers, so browsers can read the error
+	r = httptest.NewRequest(http.MethodGet, "/teams/red", nil)
+	r.Header.Set("Origin", "https://admin.example.com")
+
+	rec = httptest.NewRecorder()
+	srv.Routes().ServeHTTP(rec, r)
+	s.Equal(http.StatusUnauthorized, rec.Code)
+	s.Equal("*", rec.Header().Get("Access-Control-Allow-Origin"))
+}
+
+func (s *CORSSuite) TestRequest() {
+	handler := s.server(CORS{AllowedOrigins: []string{"https://*.example.com"}})
+
+	get := func(origin string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/:healthz", nil)
+		if origin != "" {
+			r.Header.Set("Origin", origin)
+		}
+
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, r)
+		return rec
+	}
+
+	rec := get("https://admin.example.com")
+	s.Equal(http.StatusOK, rec.Code)
+	s.Equal("https://admin.example.com", rec.Header().Get("Access-Control-Allow-Origin"))
+	s.Contains(rec.Header().Get("Access-Control-Expose-Headers"), requestIDHeader)
+	s.Empty(rec.Header().Get("Access-Control-Allow-Credentials"))
+
+	rec = get("https://example.org")
+	s.Equal(http.StatusOK, rec.Code)
+	s.Empty(rec.Header().Get("Access-Control-Allow-Origin"))
+
+	rec = get("")
+	s.Equal(http.StatusOK, rec.Code)
+	s.Empty(rec.Header().Get("Access-Control-Allow-Origin"))
+	s.Empty(rec.Header().Values("Vary"))
+}
+
+func (s *CORSSuite) TestValidate() {
+	s.Error(CORS{}.validate())
+	s.Error(CORS{AllowedOrigins: []string{"*"}, AllowCredentials: true}.validate())
+	s.NoError(CORS{AllowedOrigins: []string{"https://admin.example.com"}, AllowCredentials: true}.validate())
+}
+
+func TestCORSSuite(t *testing.T) {
+	suite.Run(t, new(CORSSuite))
+}
@@ -0,0 +1,209 @@
+package pot
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+var (
+	ErrNotNumeric = errors.New("field is not numeric")
+)
+
+// WithMin clamps the result of Increment to the given minimum.
+func WithMin(min float64) CallOpt {
+	return func(o *CallOpts) {
+		o.min = &min
+	}
+}
+
+// WithMax clamps the result of Increment to the given maximum.
+func WithMax(max float64) CallOpt {
+	return func(o *CallOpts) {
+		o.max = &max
+	}
+}
+
+// IncrementResponse is the response returned by the Increment method.
+type IncrementResponse struct {
+	Value      float64 `json:"value"`
+	Generation int64   `json:"generation"`
+}
+
+// Increment atomically adds the given amount to the numeric field of the document
+// with the given key. The field is created if it doesn't exist, as is the document.
+// Nested fields are separated by dots. The whole operation is executed while
+// holding the lock of the pot, so concurrent increments never get lost.
+func (s *Server) Increment(ctx context.Context, dir, key, field string, by float64, callOpts ...CallOpt) (*IncrementResponse, error) {
+	ctx, fullEnd := s.trace(ctx, "increment", attribute.String("path", dir))
+	defer fullEnd()
+
+	opts := &CallOpts{}
+	for _, opt := range callOpts {
+		opt(opts)
+	}
+
+	unlock, err := s.lockPath(ctx, dir, "increment")
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	ctx, end := s.trace(ctx, "read-write", attribute.String("path", dir))
+	defer end()
+
+	reader, err := s.openPot(ctx, dir)
+	if err != nil {
+		return nil, err
+	}
+	if reader != nil {
+		defer reader.Close()
+	}
+
+	writer, err := s.newPotWriter(ctx, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var previous, next json.RawMessage
+	var value float64
+
+	if reader != nil {
+		err := reader.Each(func(k string, doc json.RawMessage) error {
+			if k != key {
+				return writer.Encode(k, doc)
+			}
+
+			previous = doc
+
+			var err error
+			next, value, err = incrementDocument(doc, field, by, opts)
+			if err != nil {
+				return err
+			}
+
+			return writer.Encode(k, next)
+		})
+		if err != nil {
+			writer.Abort()
+			return nil, err
+		}
+	}
+
+	// the document didn't exist yet, so it is appended to the pot
+	if next == nil {
+		next, value, err = incrementDocument(nil, field, by, opts)
+		if err != nil {
+			writer.Abort()
+			return nil, err
+		}
+
+		if err := writer.Encode(key, next); err != nil {
+			writer.Abort()
+			return nil, err
+		}
+	}
+
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+
+	s.updateIndexes(ctx, dir, map[string]json.RawMessage{key: previous}, map[string]json.RawMessage{key: next})
+	s.updateCache(dir, reader, writer, map[string]json.RawMessage{key: next}, nil)
+	s.watchers.notify(dir)
+
+	s.recordAudit(ctx, &AuditEvent{
+		Action:     AuditIncrement,
+		Path:       dir,
+		Keys:       []string{key},
+		Before:     auditHashes(map[string]json.RawMessage{key: previous}),
+		After:      auditHashes(map[string]json.RawMessage{key: next}),
+		Generation: writer.Attrs().Generation,
+	})
+
+	return &IncrementResponse{
+		Value:      value,
+		Generation: writer.Attrs().Generation,
+	}, nil
+}
+
+// incrementDocument adds the amount to the field of the document and returns
+// the updated document with the new value. Other fields keep their values and
+// numbers keep their precision, but the document is re-encoded, so the keys of
+// its objects end up sorted.
+func incrementDocument(doc json.RawMessage, field string, by float64, opts *CallOpts) (json.RawMessage, float64, error) {
+	obj := map[string]any{}
+	if doc != nil {
+		dec := json.NewDecoder(bytes.NewReader(doc))
+		dec.UseNumber()
+		if err := dec.Decode(&obj); err != nil {
+			return nil, 0, fmt.Errorf("%w: document is not an object", ErrNotNumeric)
+		}
+	}
+
+	// a null document decodes into a nil map, it is incremented as an empty one
+	if obj == nil {
+		obj = map[string]any{}
+	}
+
+	// walk the nested objects, creating the missing ones
+	parent := obj
+	parts := strings.Split(field, ".")
+	for _, part := range parts[:len(parts)-1] {
+		child, ok := parent[part]
+		if !ok {
+			child = map[string]any{}
+			parent[part] = child
+		}
+
+		childObj, ok := child.(map[string]any)
+		if !ok {
+			return nil, 0, fmt.Errorf("%w: %s", ErrNotNumeric, field)
+		}
+		parent = childObj
+	}
+
+	last := parts[len(parts)-1]
+	current := 0.0
+	if v, ok := parent[last]; ok {
+		num, ok := v.(json.Number)
+		if !ok {
+			return nil, 0, fmt.Errorf("%w: %s", ErrNotNumeric, field)
+		}
+
+		var err error
+		current, err = num.Float64()
+		if err != nil {
+			return nil, 0, fmt.Errorf("%w: %s", ErrNotNumeric, field)
+		}
+	}
+
+	value := current + by
+	if opts.min != nil && value < *opts.min {
+		value = *opts.min
+	}
+	if opts.max != nil && value > *opts.max {
+		value = *opts.max
+	}
+
+	// JSON has no representation of infinities and NaN
+	if math.IsInf(value, 0) || math.IsNaN(value) {
+		return nil, 0, fmt.Errorf("%w: %s would not be finite", ErrNotNumeric, field)
+	}
+
+	parent[last] = json.Number(strconv.FormatFloat(value, 'f', -1, 64))
+
+	b, err := json.Marshal(obj)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return b, value, nil
+}
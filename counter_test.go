@@ -0,0 +1,67 @@
+package pot
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type CounterSuite struct {
+	suite.Suite
+}
+
+func (s *CounterSuite) TestIncrementDocument() {
+	min, max := 0.0, 10.0
+
+	cases := []struct {
+		caseName string
+		doc      string
+		field    string
+		by       float64
+		opts     *CallOpts
+		expected string
+		value    float64
+		err      error
+	}{
+		{"new document", ``, "count", 1, &CallOpts{}, `{"count":1}`, 1, nil},
+		{"null document", `null`, "quota.used", 1, &CallOpts{}, `{"quota":{"used":1}}`, 1, nil},
+		{"null parent", `{"quota":null}`, "quota.used", 1, &CallOpts{}, ``, 0, ErrNotNumeric},
+		{"existing field", `{"id":"a","count":41}`, "count", 1, &CallOpts{}, `{"count":42,"id":"a"}`, 42, nil},
+		{"decrement", `{"count":1}`, "count", -3, &CallOpts{}, `{"count":-2}`, -2, nil},
+		{"fraction", `{"count":1}`, "count", 0.5, &CallOpts{}, `{"count":1.5}`, 1.5, nil},
+		{"nested new field", `{"id":"a"}`, "quota.used", 2, &CallOpts{}, `{"id":"a","quota":{"used":2}}`, 2, nil},
+		{"clamp min", `{"count":1}`, "count", -3, &CallOpts{min: &min}, `{"count":0}`, 0, nil},
+		{"clamp max", `{"count":9}`, "count", 3, &CallOpts{max: &max}, `{"count":10}`, 10, nil},
+		{"preserves big numbers", `{"big":12345678901234567890,"count":1}`, "count", 1, &CallOpts{}, `{"big":12345678901234567890,"count":2}`, 2, nil},
+		{"not numeric", `{"count":"a"}`, "count", 1, &CallOpts{}, ``, 0, ErrNotNumeric},
+		{"parent not an object", `{"quota":1}`, "quota.used", 1, &CallOpts{}, ``, 0, ErrNotNumeric},
+		{"document not an object", `"a"`, "count", 1, &CallOpts{}, ``, 0, ErrNotNumeric},
+		{"overflow", `{"count":1e308}`, "count", 1e308, &CallOpts{}, ``, 0, ErrNotNumeric},
+		{"not a number", `{"count":1}`, "count", math.NaN(), &CallOpts{}, ``, 0, ErrNotNumeric},
+	}
+
+	for _, c := range cases {
+		s.Run(c.caseName, func() {
+			var doc json.RawMessage
+			if c.doc != "" {
+				doc = json.RawMessage(c.doc)
+			}
+
+			next, value, err := incrementDocument(doc, c.field, c.by, c.opts)
+			if c.err != nil {
+				s.ErrorIs(err, c.err)
+				return
+			}
+
+			s.Require().NoError(err)
+			s.Equal(c.expected, string(next))
+			s.Equal(c.value, value)
+		})
+	}
+}
+
+func TestCounterSuite(t *testing.T) {
+	suite.Run(t, new(CounterSuite))
+}
@@ -0,0 +1,480 @@
+package pot
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+var (
+	ErrUnknownKey        = errors.New("unknown key encryption key")
+	ErrDecryptionFailed  = errors.New("failed to decrypt the pot")
+	ErrEncryptedPot      = errors.New("pot is encrypted, but no key source is configured")
+	ErrMalformedEnvelope = errors.New("malformed encryption envelope")
+)
+
+const (
+	// contentTypeEncrypted marks pots that are encrypted as a whole. Their content
+	// encoding is stored in metadata, since the stored bytes are not compressed.
+	contentTypeEncrypted = "application/vnd.pot.encrypted"
+
+	// contentTypeEncryptedFields marks pots that are stored as JSON with some of
+	// the document fields encrypted.
+	contentTypeEncryptedFields = "application/vnd.pot.encrypted-fields+json"
+
+	metadataKeyID           = "pot-key-id"
+	metadataDataKey         = "pot-data-key"
+	metadataCompression     = "pot-compression"
+	metadataEncryptedFields = "pot-encrypted-fields"
+
+	// encryptedFieldPrefix prefixes encrypted field values, which are stored as
+	// base64 encoded strings.
+	encryptedFieldPrefix = "pot:enc:"
+
+	// encryptionChunkSize is the size of plaintext chunks sealed separately, so
+	// pots can be encrypted and decrypted while streaming.
+	encryptionChunkSize = 64 << 10
+
+	dataKeySize = 32
+)
+
+// KeySource wraps and unwraps data keys used to encrypt pots. Every write of
+// a pot uses a fresh data key, which is wrapped by the current key encryption
+// key and stored in the object metadata with the id of that key.
+//
+// Implementations typically delegate to a KMS, so the key encryption keys never
+// leave it. Rotating the key encryption key only requires the source to wrap
+// new data keys with a new key while still being able to unwrap the old ones;
+// pots are re-encrypted with the new key on their next write.
+type KeySource interface {
+	// WrapKey encrypts the data key with the current key encryption key and
+	// returns the id of the key that was used.
+	WrapKey(ctx context.Context, dataKey []byte) (keyID string, wrapped []byte, err error)
+
+	// UnwrapKey decrypts the data key with the key encryption key of the given id.
+	UnwrapKey(ctx context.Context, keyID string, wrapped []byte) ([]byte, error)
+}
+
+// LocalKeySource is a KeySource holding the key encryption keys in memory. It is
+// intended for tests and local development, production deployments should use
+// a KMS backed KeySource.
+type LocalKeySource struct {
+	current string
+	keys    map[string]cipher.AEAD
+}
+
+// localKeyfile is the format of the file loaded by LoadLocalKeySource.
+type localKeyfile struct {
+	// Current is the id of the key used to wrap new data keys
+	Current string `json:"current"`
+
+	// Keys are base64 encoded AES-256 keys by their ids
+	Keys map[string]string `json:"keys"`
+}
+
+// NewLocalKeySource creates a key source from AES-256 keys by their ids. New
+// data keys are wrapped with the current key.
+func NewLocalKeySource(current string, keys map[string][]byte) (*LocalKeySource, error) {
+	src := &LocalKeySource{
+		current: current,
+		keys:    map[string]cipher.AEAD{},
+	}
+
+	for id, key := range keys {
+		aead, err := newAEAD(key)
+		if err != nil {
+			return nil, fmt.Errorf("invalid key %s: %w", id, err)
+		}
+		src.keys[id] = aead
+	}
+
+	if _, ok := src.keys[current]; !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownKey, current)
+	}
+
+	return src, nil
+}
+
+// LoadLocalKeySource loads the key source from a JSON keyfile in the format:
+//
+//	{"current": "key-2", "keys": {"key-1": "<base64>", "key-2": "<base64>"}}
+func LoadLocalKeySource(path string) (*LocalKeySource, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	kf := localKeyfile{}
+	if err := json.Unmarshal(b, &kf); err != nil {
+		return nil, err
+	}
+
+	keys := map[string][]byte{}
+	for id, encoded := range kf.Keys {
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("invalid key %s: %w", id, err)
+		}
+		keys[id] = key
+	}
+
+	return NewLocalKeySource(kf.Current, keys)
+}
+
+func (s *LocalKeySource) WrapKey(_ context.Context, dataKey []byte) (string, []byte, error) {
+	wrapped, err := seal(s.keys[s.current], dataKey, []byte(s.current))
+	if err != nil {
+		return "", nil, err
+	}
+
+	return s.current, wrapped, nil
+}
+
+func (s *LocalKeySource) UnwrapKey(_ context.Context, keyID string, wrapped []byte) ([]byte, error) {
+	aead, ok := s.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownKey, keyID)
+	}
+
+	return open(aead, wrapped, []byte(keyID))
+}
+
+// envelope encrypts the content of a single pot with its data key. The object
+// name is used as additional data, so encrypted content can't be moved between
+// paths.
+type envelope struct {
+	aead cipher.AEAD
+	name []byte
+
+	// fields are the encrypted document fields of pots with encrypted fields.
+	// They are recorded in the metadata of the pot, so only the fields that
+	// were encrypted are decrypted, regardless of the current server setting.
+	fields []string
+}
+
+// newEnvelope generates a data key for a new pot and returns the envelope with
+// the metadata that must be stored alongside the pot.
+func newEnvelope(ctx context.Context, keys KeySource, name string) (*envelope, map[string]string, error) {
+	dataKey := make([]byte, dataKeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, nil, err
+	}
+
+	keyID, wrapped, err := keys.WrapKey(ctx, dataKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	metadata := map[string]string{
+		metadataKeyID:   keyID,
+		metadataDataKey: base64.StdEncoding.EncodeToString(wrapped),
+	}
+
+	return &envelope{aead: aead, name: []byte(name)}, metadata, nil
+}
+
+// encryptFields makes the envelope encrypt the given fields of the documents
+// and records them in the metadata of the pot.
+func (e *envelope) encryptFields(fields []string, metadata map[string]string) error {
+	b, err := json.Marshal(fields)
+	if err != nil {
+		return err
+	}
+
+	e.fields = fields
+	metadata[metadataEncryptedFields] = string(b)
+	return nil
+}
+
+// openEnvelope unwraps the data key stored in the pot metadata.
+func openEnvelope(ctx context.Context, keys KeySource, name string, metadata map[string]string) (*envelope, error) {
+	if keys == nil {
+		return nil, ErrEncryptedPot
+	}
+
+	wrapped, err := base64.StdEncoding.DecodeString(metadata[metadataDataKey])
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrMalformedEnvelope, err)
+	}
+
+	dataKey, err := keys.UnwrapKey(ctx, metadata[metadataKeyID], wrapped)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	env := &envelope{aead: aead, name: []byte(name)}
+	if fields, ok := metadata[metadataEncryptedFields]; ok {
+		if err := json.Unmarshal([]byte(fields), &env.fields); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrMalformedEnvelope, err)
+		}
+	}
+
+	return env, nil
+}
+
+// sealFields encrypts the encrypted top-level fields of the document.
+func (e *envelope) sealFields(key string, doc json.RawMessage) (json.RawMessage, error) {
+	obj := map[string]json.RawMessage{}
+	if err := json.Unmarshal(doc, &obj); err != nil {
+		// documents that are not objects don't have any fields to encrypt
+		return doc, nil
+	}
+
+	for _, field := range e.fields {
+		value, ok := obj[field]
+		if !ok {
+			continue
+		}
+
+		ciphertext, err := seal(e.aead, value, e.fieldData(key, field))
+		if err != nil {
+			return nil, err
+		}
+
+		obj[field], err = json.Marshal(encryptedFieldPrefix + base64.StdEncoding.EncodeToString(ciphertext))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return json.Marshal(obj)
+}
+
+// openFields decrypts the encrypted fields of the document. Other fields are
+// returned as stored, even if their values look encrypted.
+func (e *envelope) openFields(key string, doc json.RawMessage) (json.RawMessage, error) {
+	obj := map[string]json.RawMessage{}
+	if err := json.Unmarshal(doc, &obj); err != nil {
+		return doc, nil
+	}
+
+	for _, field := range e.fields {
+		value, ok := obj[field]
+		if !ok {
+			continue
+		}
+
+		var str string
+		if err := json.Unmarshal(value, &str); err != nil || !strings.HasPrefix(str, encryptedFieldPrefix) {
+			return nil, fmt.Errorf("%w: field %s of %s is not encrypted", ErrMalformedEnvelope, field, key)
+		}
+
+		ciphertext, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(str, encryptedFieldPrefix))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrMalformedEnvelope, err)
+		}
+
+		obj[field], err = open(e.aead, ciphertext, e.fieldData(key, field))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return json.Marshal(obj)
+}
+
+// fieldData is the additional data of an encrypted field. It binds the value
+// to the object name, the document key and the field, so encrypted values
+// can't be moved between documents or fields of the same pot. Every part is
+// length prefixed, so the parts can't be shifted into each other.
+func (e *envelope) fieldData(key, field string) []byte {
+	data := []byte{}
+	for _, part := range []string{string(e.name), key, field} {
+		data = binary.BigEndian.AppendUint32(data, uint32(len(part)))
+		data = append(data, part...)
+	}
+
+	return data
+}
+
+// sealWriter encrypts the content in chunks of encryptionChunkSize. Each chunk
+// is prefixed by a flag marking the final chunk and the length of the sealed
+// chunk. The chunk counter and the flag are part of the nonce, so chunks can't
+// be reordered, dropped or truncated without failing the decryption.
+type sealWriter struct {
+	w       io.Writer
+	env     *envelope
+	buf     []byte
+	counter uint64
+}
+
+func (e *envelope) newSealWriter(w io.Writer) *sealWriter {
+	return &sealWriter{
+		w:   w,
+		env: e,
+		buf: make([]byte, 0, encryptionChunkSize),
+	}
+}
+
+func (s *sealWriter) Write(p []byte) (int, error) {
+	n := 0
+	for len(p) > 0 {
+		// full chunks are only sealed once more data arrives, since the last
+		// chunk must be sealed as final
+		if len(s.buf) == encryptionChunkSize {
+			if err := s.seal(false); err != nil {
+				return n, err
+			}
+		}
+
+		m := copy(s.buf[len(s.buf):encryptionChunkSize], p)
+		s.buf = s.buf[:len(s.buf)+m]
+		p = p[m:]
+		n += m
+	}
+
+	return n, nil
+}
+
+// Close seals the final chunk. It doesn't close the underlying writer.
+func (s *sealWriter) Close() error {
+	return s.seal(true)
+}
+
+func (s *sealWriter) seal(final bool) error {
+	sealed := s.env.aead.Seal(nil, chunkNonce(s.counter, final), s.buf, s.env.name)
+
+	hdr := make([]byte, 5)
+	if final {
+		hdr[0] = 1
+	}
+	binary.BigEndian.PutUint32(hdr[1:], uint32(len(sealed)))
+
+	if _, err := s.w.Write(hdr); err != nil {
+		return err
+	}
+	if _, err := s.w.Write(sealed); err != nil {
+		return err
+	}
+
+	s.counter++
+	s.buf = s.buf[:0]
+	return nil
+}
+
+// openReader decrypts the content written by sealWriter.
+type openReader struct {
+	r       io.Reader
+	env     *envelope
+	plain   []byte
+	counter uint64
+	done    bool
+}
+
+func (e *envelope) newOpenReader(r io.Reader) *openReader {
+	return &openReader{r: r, env: e}
+}
+
+func (o *openReader) Read(p []byte) (int, error) {
+	for len(o.plain) == 0 {
+		if o.done {
+			return 0, io.EOF
+		}
+
+		if err := o.open(); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, o.plain)
+	o.plain = o.plain[n:]
+	return n, nil
+}
+
+func (o *openReader) open() error {
+	hdr := make([]byte, 5)
+	if _, err := io.ReadFull(o.r, hdr); err != nil {
+		return fmt.Errorf("%w: %w", ErrDecryptionFailed, err)
+	}
+
+	final := hdr[0] == 1
+	size := binary.BigEndian.Uint32(hdr[1:])
+	if size > encryptionChunkSize+uint32(o.env.aead.Overhead()) {
+		return ErrMalformedEnvelope
+	}
+
+	sealed := make([]byte, size)
+	if _, err := io.ReadFull(o.r, sealed); err != nil {
+		return fmt.Errorf("%w: %w", ErrDecryptionFailed, err)
+	}
+
+	plain, err := o.env.aead.Open(sealed[:0], chunkNonce(o.counter, final), sealed, o.env.name)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrDecryptionFailed, err)
+	}
+
+	o.plain = plain
+	o.counter++
+	o.done = final
+	return nil
+}
+
+// chunkNonce derives the nonce of a chunk. Data keys are never reused between
+// pots, so a counter based nonce is unique.
+func chunkNonce(counter uint64, final bool) []byte {
+	nonce := make([]byte, 12)
+	binary.BigEndian.PutUint64(nonce, counter)
+	if final {
+		nonce[11] = 1
+	}
+
+	return nonce
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// seal encrypts the plaintext with a random nonce prepended to the result.
+func seal(aead cipher.AEAD, plaintext, additionalData []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	return aead.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+// open decrypts the ciphertext created by seal.
+func open(aead cipher.AEAD, ciphertext, additionalData []byte) ([]byte, error) {
+	if len(ciphertext) < aead.NonceSize() {
+		return nil, ErrMalformedEnvelope
+	}
+
+	nonce, sealed := ciphertext[:aead.NonceSize()], ciphertext[aead.NonceSize():]
+	plain, err := aead.Open(nil, nonce, sealed, additionalData)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDecryptionFailed, err)
+	}
+
+	return plain, nil
+}
+
+// isEncrypted checks whether the content type marks an encrypted pot.
+func isEncrypted(contentType string) bool {
+	return contentType == contentTypeEncrypted || contentType == contentTypeEncryptedFields
+}
@@ -0,0 +1,199 @@
+package pot
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type EncryptionSuite struct {
+	suite.Suite
+
+	keys *LocalKeySource
+}
+
+func (s *EncryptionSuite) SetupTest() {
+	keys, err := NewLocalKeySource("k1", map[string][]byte{"k1": s.randomBytes(32)})
+	s.Require().NoError(err)
+	s.keys = keys
+}
+
+func (s *EncryptionSuite) randomBytes(n int) []byte {
+	b := make([]byte, n)
+	_, err := rand.Read(b)
+	s.Require().NoError(err)
+	return b
+}
+
+func (s *EncryptionSuite) TestStreamRoundTrip() {
+	sizes := []int{0, 1, encryptionChunkSize - 1, encryptionChunkSize, encryptionChunkSize + 1, 3*encryptionChunkSize + 7}
+
+	for _, size := range sizes {
+		plain := s.randomBytes(size)
+
+		env, metadata, err := newEnvelope(context.Background(), s.keys, "a/data.json")
+		s.Require().NoError(err)
+
+		var buf bytes.Buffer
+		sw := env.newSealWriter(&buf)
+		_, err = sw.Write(plain)
+		s.Require().NoError(err)
+		s.Require().NoError(sw.Close())
+
+		opened, err := openEnvelope(context.Background(), s.keys, "a/data.json", metadata)
+		s.Require().NoError(err)
+
+		decrypted, err := io.ReadAll(opened.newOpenReader(&buf))
+		s.Require().NoError(err)
+		s.Equal(plain, decrypted, "size %d", size)
+	}
+}
+
+func (s *EncryptionSuite) TestStreamDetectsTampering() {
+	env, metadata, err := newEnvelope(context.Background(), s.keys, "a/data.json")
+	s.Require().NoError(err)
+
+	var buf bytes.Buffer
+	sw := env.newSealWriter(&buf)
+	_, err = sw.Write(s.randomBytes(2*encryptionChunkSize + 10))
+	s.Require().NoError(err)
+	s.Require().NoError(sw.Close())
+	sealed := buf.Bytes()
+
+	s.Run("truncated", func() {
+		opened, err := openEnvelope(context.Background(), s.keys, "a/data.json", metadata)
+		s.Require().NoError(err)
+
+		// drop the final chunk
+		truncated := sealed[:2*(5+encryptionChunkSize+opened.aead.Overhead())]
+		_, err = io.ReadAll(opened.newOpenReader(bytes.NewReader(truncated)))
+		s.ErrorIs(err, ErrDecryptionFailed)
+	})
+
+	s.Run("modified", func() {
+		opened, err := openEnvelope(context.Background(), s.keys, "a/data.json", metadata)
+		s.Require().NoError(err)
+
+		modified := bytes.Clone(sealed)
+		modified[100] ^= 1
+		_, err = io.ReadAll(opened.newOpenReader(bytes.NewReader(modified)))
+		s.ErrorIs(err, ErrDecryptionFailed)
+	})
+
+	s.Run("moved to another path", func() {
+		opened, err := openEnvelope(context.Background(), s.keys, "b/data.json", metadata)
+		s.Require().NoError(err)
+
+		_, err = io.ReadAll(opened.newOpenReader(bytes.NewReader(sealed)))
+		s.ErrorIs(err, ErrDecryptionFailed)
+	})
+}
+
+func (s *EncryptionSuite) TestFields() {
+	env, metadata, err := newEnvelope(context.Background(), s.keys, "a/data.json")
+	s.Require().NoError(err)
+	s.Require().NoError(env.encryptFields([]string{"secret", "missing"}, metadata))
+
+	doc := json.RawMessage(`{"id":"test","secret":{"token":"abc"},"age":42}`)
+	sealed, err := env.sealFields("test", doc)
+	s.Require().NoError(err)
+
+	obj := map[string]any{}
+	s.Require().NoError(json.Unmarshal(sealed, &obj))
+	s.Equal("test", obj["id"])
+	s.Equal(42.0, obj["age"])
+	s.Contains(obj["secret"], encryptedFieldPrefix)
+
+	// the fields are read from the metadata of the pot
+	opened, err := openEnvelope(context.Background(), s.keys, "a/data.json", metadata)
+	s.Require().NoError(err)
+	s.Equal([]string{"secret", "missing"}, opened.fields)
+
+	plain, err := opened.openFields("test", sealed)
+	s.Require().NoError(err)
+	s.JSONEq(string(doc), string(plain))
+}
+
+func (s *EncryptionSuite) TestFieldsPlaintextPrefix() {
+	env, metadata, err := newEnvelope(context.Background(), s.keys, "a/data.json")
+	s.Require().NoError(err)
+	s.Require().NoError(env.encryptFields([]string{"secret"}, metadata))
+
+	// values of other fields are never decrypted, even with the prefix
+	doc := json.RawMessage(`{"note":"pot:enc:not encrypted","secret":"abc"}`)
+	sealed, err := env.sealFields("test", doc)
+	s.Require().NoError(err)
+
+	plain, err := env.openFields("test", sealed)
+	s.Require().NoError(err)
+	s.JSONEq(string(doc), string(plain))
+}
+
+func (s *EncryptionSuite) TestFieldsSwapped() {
+	env, metadata, err := newEnvelope(context.Background(), s.keys, "a/data.json")
+	s.Require().NoError(err)
+	s.Require().NoError(env.encryptFields([]string{"password", "token"}, metadata))
+
+	sealed, err := env.sealFields("alice", json.RawMessage(`{"password":"p","token":"t"}`))
+	s.Require().NoError(err)
+
+	obj := map[string]json.RawMessage{}
+	s.Require().NoError(json.Unmarshal(sealed, &obj))
+
+	s.Run("between fields", func() {
+		swapped, err := json.Marshal(map[string]json.RawMessage{"password": obj["token"], "token": obj["password"]})
+		s.Require().NoError(err)
+
+		_, err = env.openFields("alice", swapped)
+		s.ErrorIs(err, ErrDecryptionFailed)
+	})
+
+	s.Run("between documents", func() {
+		_, err := env.openFields("bob", sealed)
+		s.ErrorIs(err, ErrDecryptionFailed)
+	})
+
+	s.Run("replaced by plaintext", func() {
+		_, err := env.openFields("alice", json.RawMessage(`{"password":"p"}`))
+		s.ErrorIs(err, ErrMalformedEnvelope)
+	})
+}
+
+func (s *EncryptionSuite) TestKeyRotation() {
+	oldKey, newKey := s.randomBytes(32), s.randomBytes(32)
+
+	before, err := NewLocalKeySource("k1", map[string][]byte{"k1": oldKey})
+	s.Require().NoError(err)
+
+	_, metadata, err := newEnvelope(context.Background(), before, "a/data.json")
+	s.Require().NoError(err)
+	s.Equal("k1", metadata[metadataKeyID])
+
+	// the rotated source wraps new keys with k2 while still unwrapping k1
+	after, err := NewLocalKeySource("k2", map[string][]byte{"k1": oldKey, "k2": newKey})
+	s.Require().NoError(err)
+
+	_, err = openEnvelope(context.Background(), after, "a/data.json", metadata)
+	s.NoError(err)
+
+	_, metadata, err = newEnvelope(context.Background(), after, "a/data.json")
+	s.Require().NoError(err)
+	s.Equal("k2", metadata[metadataKeyID])
+
+	_, err = openEnvelope(context.Background(), before, "a/data.json", metadata)
+	s.ErrorIs(err, ErrUnknownKey)
+}
+
+func (s *EncryptionSuite) TestNoKeySource() {
+	_, err := openEnvelope(context.Background(), nil, "a/data.json", map[string]string{})
+	s.ErrorIs(err, ErrEncryptedPot)
+}
+
+func TestEncryptionSuite(t *testing.T) {
+	suite.Run(t, new(EncryptionSuite))
+}
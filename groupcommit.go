@@ -0,0 +1,158 @@
+package pot
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// pendingWrite is a single Create call waiting to be committed to the pot.
+type pendingWrite struct {
+	objs map[string]any
+	docs map[string]json.RawMessage
+	opts *CallOpts
+
+	res *CreateResponse
+	err error
+
+	// before are the hashes of the documents replaced by the write, recorded
+	// in the audit events
+	before map[string]string
+
+	// done receives false once the write is committed, or true if the write
+	// was handed the leadership and should commit the next batch itself
+	done chan bool
+}
+
+// groupCommitter coalesces concurrent writes to the same path. Writes arriving
+// while the path is being written to are queued and committed together by a
+// single leader in one read-merge-write cycle.
+type groupCommitter struct {
+	mux sync.Mutex
+
+	// maxBatch is the maximum number of writes committed together, unlimited
+	// if zero
+	maxBatch int
+
+	// queues are the writes waiting for each path. A path is present while
+	// it has a leader, even if its queue is empty.
+	queues map[string][]*pendingWrite
+}
+
+func newGroupCommitter(maxBatch int) *groupCommitter {
+	return &groupCommitter{
+		maxBatch: maxBatch,
+		queues:   map[string][]*pendingWrite{},
+	}
+}
+
+// WithGroupCommit coalesces concurrent writes to the same path. Instead of
+// each write reading and writing the pot on its own, writes waiting for the
+// path are merged and committed at once, up to maxBatch writes per commit or
+// unlimited if zero. Every write still gets its own result, so a write that
+// violates its no-rewrite rule fails without affecting the others.
+func WithGroupCommit(maxBatch int) Option {
+	return func(c *Server) {
+		c.groupCommit = newGroupCommitter(maxBatch)
+	}
+}
+
+// setMaxBatch changes the maximum number of writes committed together.
+func (g *groupCommitter) setMaxBatch(maxBatch int) {
+	g.mux.Lock()
+	defer g.mux.Unlock()
+
+	g.maxBatch = maxBatch
+}
+
+// enqueue adds the write to the queue of the path and reports whether the
+// write became the leader of the path.
+func (g *groupCommitter) enqueue(dir string, w *pendingWrite) bool {
+	g.mux.Lock()
+	defer g.mux.Unlock()
+
+	queue, active := g.queues[dir]
+	g.queues[dir] = append(queue, w)
+
+	return !active
+}
+
+// next takes the next batch of writes from the queue of the path.
+func (g *groupCommitter) next(dir string) []*pendingWrite {
+	g.mux.Lock()
+	defer g.mux.Unlock()
+
+	queue := g.queues[dir]
+	n := len(queue)
+	if g.maxBatch > 0 && n > g.maxBatch {
+		n = g.maxBatch
+	}
+
+	batch := queue[:n:n]
+	g.queues[dir] = queue[n:]
+
+	return batch
+}
+
+// handOff passes the leadership of the path to the first waiting write, or
+// releases the path if there are no writes waiting.
+func (g *groupCommitter) handOff(dir string) {
+	g.mux.Lock()
+	defer g.mux.Unlock()
+
+	queue := g.queues[dir]
+	if len(queue) == 0 {
+		delete(g.queues, dir)
+		return
+	}
+
+	queue[0].done <- true
+}
+
+// submitWrite commits the write together with other writes waiting for the
+// path. The write either waits for the current leader to commit it, or becomes
+// the leader and commits the batch it is part of.
+func (s *Server) submitWrite(ctx context.Context, dir string, w *pendingWrite) {
+	w.done = make(chan bool, 1)
+
+	if !s.groupCommit.enqueue(dir, w) {
+		if lead := <-w.done; !lead {
+			return
+		}
+	}
+
+	batch := s.groupCommit.next(dir)
+
+	// the batch is committed even if the leader's request is canceled, since
+	// the other writes depend on it
+	s.commitWrites(context.WithoutCancel(ctx), dir, batch)
+	s.groupCommit.handOff(dir)
+
+	if s.MetricsOptions.Enabled {
+		s.MetricsOptions.PotGroupCommitSize.Record(ctx, int64(len(batch)), metric.WithAttributes(attribute.String("path", dir)))
+	}
+
+	for _, other := range batch {
+		if other != w {
+			other.done <- false
+		}
+	}
+}
+
+// storedKeys reads the keys of all documents in the pot.
+func storedKeys(reader *potReader) (map[string]bool, error) {
+	keys := map[string]bool{}
+	if reader == nil {
+		return keys, nil
+	}
+
+	err := eachDocument(reader, func(key string, _ json.RawMessage) error {
+		keys[key] = true
+		return nil
+	})
+
+	return keys, err
+}
@@ -0,0 +1,89 @@
+package pot
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"github.com/stretchr/testify/suite"
+)
+
+type GroupCommitSuite struct {
+	suite.Suite
+}
+
+func (s *GroupCommitSuite) write(opts *CallOpts, keys ...string) *pendingWrite {
+	docs := map[string]json.RawMessage{}
+	for _, key := range keys {
+		docs[key] = json.RawMessage(`{}`)
+	}
+
+	return &pendingWrite{docs: docs, opts: opts, done: make(chan bool, 1)}
+}
+
+func (s *GroupCommitSuite) TestLeadership() {
+	g := newGroupCommitter(2)
+	a, b, c, d := s.write(&CallOpts{}), s.write(&CallOpts{}), s.write(&CallOpts{}), s.write(&CallOpts{})
+
+	s.True(g.enqueue("path", a))
+	s.Equal([]*pendingWrite{a}, g.next("path"))
+
+	// writes arriving while the leader commits are queued
+	s.False(g.enqueue("path", b))
+	s.False(g.enqueue("path", c))
+	s.False(g.enqueue("path", d))
+	s.True(g.enqueue("other", s.write(&CallOpts{})))
+
+	g.handOff("path")
+	s.True(<-b.done)
+	s.Equal([]*pendingWrite{b, c}, g.next("path"))
+
+	g.handOff("path")
+	s.True(<-d.done)
+	s.Equal([]*pendingWrite{d}, g.next("path"))
+
+	// the path is released once its queue is empty
+	g.handOff("path")
+	s.True(g.enqueue("path", s.write(&CallOpts{})))
+}
+
+func (s *GroupCommitSuite) TestAllowRewrite() {
+	now := time.Now()
+	attrs := storage.ReaderObjectAttrs{Generation: 5, LastModified: now.Add(-time.Minute)}
+
+	s.True(allowRewrite(attrs, &CallOpts{}, now))
+	s.True(allowRewrite(attrs, &CallOpts{norewrite: true}, now))
+	s.False(allowRewrite(attrs, &CallOpts{norewrite: true, norewriteDuration: time.Hour}, now))
+	s.True(allowRewrite(attrs, &CallOpts{norewrite: true, norewriteDuration: time.Second}, now))
+	s.True(allowRewrite(attrs, &CallOpts{norewrite: true, norewriteDuration: time.Hour, lastKnownGeneration: 5}, now))
+}
+
+func (s *GroupCommitSuite) TestViolatedKey() {
+	norewrite := &CallOpts{norewrite: true, norewriteDuration: time.Hour}
+	stored := map[string]bool{"a": true}
+	written := map[string]json.RawMessage{"b": json.RawMessage(`{}`)}
+
+	key, ok := violatedKey(s.write(norewrite, "c", "a"), false, stored, written)
+	s.True(ok)
+	s.Equal("a", key)
+
+	_, ok = violatedKey(s.write(norewrite, "a"), true, stored, written)
+	s.False(ok)
+
+	// documents written earlier in the batch can't be known by the client
+	key, ok = violatedKey(s.write(norewrite, "b"), true, stored, written)
+	s.True(ok)
+	s.Equal("b", key)
+
+	_, ok = violatedKey(s.write(&CallOpts{norewrite: true}, "b"), true, stored, written)
+	s.False(ok)
+
+	// the stored keys are asserted while merging if not known upfront
+	_, ok = violatedKey(s.write(norewrite, "a"), false, nil, written)
+	s.False(ok)
+}
+
+func TestGroupCommitSuite(t *testing.T) {
+	suite.Run(t, new(GroupCommitSuite))
+}
@@ -0,0 +1,362 @@
+package pot
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"runtime/debug"
+	"slices"
+	"strconv"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	potv1 "github.com/petomalina/pot/proto/pot/v1"
+)
+
+// NewGRPCServer returns the gRPC server serving the pot.v1.Pot service of the
+// server. Requests pass the same authentication, rate limits, access control
+// and policies as the HTTP routes.
+func (s *Server) NewGRPCServer(opts ...grpc.ServerOption) *grpc.Server {
+	opts = append([]grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(grpcRecoverUnary),
+		grpc.ChainStreamInterceptor(grpcRecoverStream),
+	}, opts...)
+
+	srv := grpc.NewServer(opts...)
+	potv1.RegisterPotServer(srv, &grpcService{server: s})
+
+	return srv
+}
+
+// grpcRecoverUnary turns a panic of a unary call into an internal error, so a
+// single call can't take the whole server down.
+func grpcRecoverUnary(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (res any, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = grpcPanic(info.FullMethod, r)
+		}
+	}()
+
+	return handler(ctx, req)
+}
+
+// grpcRecoverStream turns a panic of a streaming call into an internal error.
+func grpcRecoverStream(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = grpcPanic(info.FullMethod, r)
+		}
+	}()
+
+	return handler(srv, ss)
+}
+
+func grpcPanic(method string, r any) error {
+	slog.Error("recovered from a panic of a grpc call",
+		slog.String("method", method),
+		slog.Any("panic", r),
+		slog.String("stack", string(debug.Stack())),
+	)
+
+	return status.Error(codes.Internal, "internal error")
+}
+
+// grpcService implements the gRPC service on top of the methods of the server.
+type grpcService struct {
+	potv1.UnimplementedPotServer
+
+	server *Server
+}
+
+func (g *grpcService) Get(ctx context.Context, req *potv1.GetRequest) (*potv1.GetResponse, error) {
+	ctx, err := g.server.grpcRequest(ctx, http.MethodGet, req.GetPath(), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := g.server.Get(ctx, req.GetPath())
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	docs, err := grpcDocuments(content)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	if g.server.MetricsOptions.Enabled {
+		g.server.MetricsOptions.PotReads.Add(ctx, 1, metric.WithAttributes(attribute.String("path", req.GetPath())))
+	}
+
+	return &potv1.GetResponse{Documents: docs}, nil
+}
+
+func (g *grpcService) Create(ctx context.Context, req *potv1.CreateRequest) (*potv1.CreateResponse, error) {
+	query := url.Values{}
+	callOpts := []CallOpt{}
+	if req.GetBatch() {
+		query.Set("batch", "")
+		callOpts = append(callOpts, WithBatch())
+	}
+	if req.GetNorewrite() != nil {
+		query.Set("norewrite", req.GetNorewrite().AsDuration().String())
+		query.Set("generation", strconv.FormatInt(req.GetGeneration(), 10))
+		callOpts = append(callOpts, WithNoRewrite(req.GetNorewrite().AsDuration()), WithRewriteGeneration(req.GetGeneration()))
+	}
+
+	ctx, err := g.server.grpcRequest(ctx, http.MethodPost, req.GetPath(), query, req.GetBody())
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := g.server.Create(ctx, req.GetPath(), bytes.NewReader(req.GetBody()), callOpts...)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	if err := g.server.triggerZip(ctx); err != nil {
+		return nil, grpcError(err)
+	}
+
+	docs, err := grpcDocuments(content.Content)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	if g.server.MetricsOptions.Enabled {
+		g.server.MetricsOptions.PotWrites.Add(ctx, 1, metric.WithAttributes(attribute.String("path", req.GetPath())))
+	}
+
+	return &potv1.CreateResponse{Documents: docs, Generation: content.Generation}, nil
+}
+
+func (g *grpcService) Remove(ctx context.Context, req *potv1.RemoveRequest) (*potv1.RemoveResponse, error) {
+	ctx, err := g.server.grpcRequest(ctx, http.MethodDelete, req.GetPath(), url.Values{"key": req.GetKeys()}, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := g.server.Remove(ctx, req.GetPath(), req.GetKeys()...); err != nil {
+		return nil, grpcError(err)
+	}
+
+	if err := g.server.triggerZip(ctx); err != nil {
+		return nil, grpcError(err)
+	}
+
+	if g.server.MetricsOptions.Enabled {
+		g.server.MetricsOptions.PotRemoves.Add(ctx, 1, metric.WithAttributes(attribute.String("path", req.GetPath())))
+	}
+
+	return &potv1.RemoveResponse{}, nil
+}
+
+func (g *grpcService) ListPaths(ctx context.Context, req *potv1.ListPathsRequest) (*potv1.ListPathsResponse, error) {
+	ctx, err := g.server.grpcRequest(ctx, http.MethodGet, req.GetPath()+":list", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := g.server.ListPaths(ctx, req.GetPath())
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	// only the paths the caller may list are returned
+	content.Paths = slices.DeleteFunc(content.Paths, func(dir string) bool {
+		return !g.server.permitted(ctx, PermissionList, dir)
+	})
+
+	if g.server.MetricsOptions.Enabled {
+		g.server.MetricsOptions.PotLists.Add(ctx, 1, metric.WithAttributes(attribute.String("path", req.GetPath())))
+	}
+
+	return &potv1.ListPathsResponse{Paths: content.Paths}, nil
+}
+
+func (g *grpcService) Watch(req *potv1.WatchRequest, stream potv1.Pot_WatchServer) error {
+	ctx, err := g.server.grpcRequest(stream.Context(), http.MethodGet, req.GetPath(), nil, nil)
+	if err != nil {
+		return err
+	}
+
+	err = g.server.Watch(ctx, req.GetPath(), req.GetInterval().AsDuration(), func(events []WatchEvent, generation int64) error {
+		res := &potv1.WatchResponse{Generation: generation}
+		for _, event := range events {
+			res.Events = append(res.Events, &potv1.WatchEvent{
+				Action:   grpcWatchActions[event.Action],
+				Key:      event.Key,
+				Document: event.Document,
+			})
+		}
+
+		return stream.Send(res)
+	})
+	if err != nil {
+		if _, ok := status.FromError(err); ok {
+			return err
+		}
+
+		return grpcError(err)
+	}
+
+	return nil
+}
+
+var grpcWatchActions = map[string]potv1.WatchAction{
+	WatchAdded:    potv1.WatchAction_WATCH_ACTION_ADDED,
+	WatchModified: potv1.WatchAction_WATCH_ACTION_MODIFIED,
+	WatchRemoved:  potv1.WatchAction_WATCH_ACTION_REMOVED,
+}
+
+// grpcRequest passes the call through the middlewares of the HTTP routes as
+// the equivalent HTTP request with the query and the JSON body of the call,
+// so both APIs share the authentication, rate limits, access control and
+// policies. The returned context carries the principal and the request id.
+func (s *Server) grpcRequest(ctx context.Context, method, relPath string, query url.Values, body []byte) (context.Context, error) {
+	if err := validatePath(strings.TrimSuffix(relPath, ":list")); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	r := (&http.Request{
+		Method:        method,
+		URL:           &url.URL{Path: "/" + relPath, RawQuery: query.Encode()},
+		Proto:         "HTTP/2.0",
+		ProtoMajor:    2,
+		Header:        http.Header{},
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Host:          "pot",
+	}).WithContext(ctx)
+
+	// the credentials are sent as metadata, e.g. authorization or x-api-key
+	md, _ := metadata.FromIncomingContext(ctx)
+	for key, values := range md {
+		if strings.HasPrefix(key, ":") || strings.HasSuffix(key, "-bin") {
+			continue
+		}
+
+		for _, v := range values {
+			r.Header.Add(key, v)
+		}
+	}
+
+	// the metadata can't change how the body is decoded
+	r.Header.Set("Content-Type", CodecJSON.ContentType())
+
+	if p, ok := peer.FromContext(ctx); ok {
+		r.RemoteAddr = p.Addr.String()
+		if info, ok := p.AuthInfo.(credentials.TLSInfo); ok {
+			r.TLS = &info.State
+		}
+	}
+
+	var next context.Context
+	handler := s.requestID(s.authenticate(s.rateLimit(s.authorize(s.evaluatePolicy(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next = r.Context()
+		}),
+	)))))
+
+	w := &grpcResponse{header: http.Header{}}
+	handler.ServeHTTP(w, r)
+
+	// the request id is returned as in the HTTP responses, failures to set it
+	// only mean the call was already answered
+	_ = grpc.SetHeader(ctx, metadata.Pairs(strings.ToLower(requestIDHeader), w.header.Get(requestIDHeader)))
+
+	if next == nil {
+		return nil, status.Error(grpcCode(w.status), strings.TrimSpace(w.body.String()))
+	}
+
+	return next, nil
+}
+
+// grpcResponse records the responses of the middlewares rejecting gRPC calls.
+type grpcResponse struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (w *grpcResponse) Header() http.Header {
+	return w.header
+}
+
+func (w *grpcResponse) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+
+	return w.body.Write(b)
+}
+
+func (w *grpcResponse) WriteHeader(status int) {
+	w.status = status
+}
+
+// grpcCode maps the statuses of the HTTP routes to the gRPC codes.
+func grpcCode(status int) codes.Code {
+	switch status {
+	case http.StatusBadRequest:
+		return codes.InvalidArgument
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusNotFound:
+		return codes.NotFound
+	case http.StatusLocked:
+		return codes.FailedPrecondition
+	case http.StatusRequestEntityTooLarge, http.StatusUnprocessableEntity, http.StatusTooManyRequests:
+		return codes.ResourceExhausted
+	}
+
+	return codes.Internal
+}
+
+// grpcError maps the errors of the server methods to the gRPC statuses the
+// same way the HTTP routes map them to their statuses.
+func grpcError(err error) error {
+	switch {
+	case errors.Is(err, ErrReservedPath), errors.Is(err, ErrInvalidDocument):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, ErrNoRewriteViolated):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, ErrForbidden):
+		return status.Error(codes.PermissionDenied, err.Error())
+	}
+
+	if code, ok := limitStatus(err); ok {
+		return status.Error(grpcCode(code), err.Error())
+	}
+
+	return status.Error(codes.Internal, err.Error())
+}
+
+// grpcDocuments encodes the documents as JSON.
+func grpcDocuments(content map[string]any) (map[string][]byte, error) {
+	docs, err := marshalDocuments(content)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make(map[string][]byte, len(docs))
+	for key, doc := range docs {
+		res[key] = doc
+	}
+
+	return res, nil
+}
@@ -0,0 +1,249 @@
+package pot
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	potv1 "github.com/petomalina/pot/proto/pot/v1"
+)
+
+type GRPCSuite struct {
+	suite.Suite
+}
+
+// client serves the server over an in-memory listener and returns its client.
+func (s *GRPCSuite) client(srv *Server) potv1.PotClient {
+	l := bufconn.Listen(1 << 20)
+	grpcSrv := srv.NewGRPCServer()
+	go grpcSrv.Serve(l)
+	s.T().Cleanup(grpcSrv.Stop)
+
+	conn, err := grpc.DialContext(context.Background(), "bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return l.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	s.Require().NoError(err)
+	s.T().Cleanup(func() { conn.Close() })
+
+	return potv1.NewPotClient(conn)
+}
+
+// denyAll returns the server whose callers may do nothing.
+func (s *GRPCSuite) denyAll() *Server {
+	acl, err := NewACL()
+	s.Require().NoError(err)
+
+	srv := &Server{}
+	srv.acl.Store(acl)
+	return srv
+}
+
+func (s *GRPCSuite) TestReservedPath() {
+	client := s.client(&Server{})
+
+	_, err := client.Get(context.Background(), &potv1.GetRequest{Path: ":snapshot"})
+	s.Equal(codes.InvalidArgument, status.Code(err))
+
+	_, err = client.ListPaths(context.Background(), &potv1.ListPathsRequest{Path: ":index"})
+	s.Equal(codes.InvalidArgument, status.Code(err))
+}
+
+func (s *GRPCSuite) TestInvalidDocument() {
+	client := s.client(&Server{})
+
+	_, err := client.Create(context.Background(), &potv1.CreateRequest{Path: "teams/red", Body: []byte(`{"id":5}`)})
+	s.Equal(codes.InvalidArgument, status.Code(err))
+
+	_, err = client.Create(context.Background(), &potv1.CreateRequest{Path: "teams/red", Body: []byte(`{"name":["a"]}`)})
+	s.Equal(codes.InvalidArgument, status.Code(err))
+}
+
+func (s *GRPCSuite) TestRecover() {
+	panics := func(context.Context, any) (any, error) { panic("boom") }
+	_, err := grpcRecoverUnary(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: "/pot.v1.Pot/Get"}, panics)
+	s.Equal(codes.Internal, status.Code(err))
+
+	err = grpcRecoverStream(nil, nil, &grpc.StreamServerInfo{FullMethod: "/pot.v1.Pot/Watch"}, func(any, grpc.ServerStream) error { panic("boom") })
+	s.Equal(codes.Internal, status.Code(err))
+}
+
+func (s *GRPCSuite) TestAuthentication() {
+	keys, err := NewAPIKeys(APIKey{Name: "alice", Hash: HashAPIKey("secret")})
+	s.Require().NoError(err)
+
+	srv := s.denyAll()
+	srv.authenticators = []Authenticator{keys}
+	client := s.client(srv)
+
+	_, err = client.Get(context.Background(), &potv1.GetRequest{Path: "teams/red"})
+	s.Equal(codes.Unauthenticated, status.Code(err))
+
+	// the key is accepted, so the call reaches the access control
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "x-api-key", "secret", "x-request-id", "req-1")
+	header := metadata.MD{}
+	_, err = client.Create(ctx, &potv1.CreateRequest{Path: "teams/red", Body: []byte(`{"id":"a"}`)}, grpc.Header(&header))
+	s.Equal(codes.PermissionDenied, status.Code(err))
+	s.Contains(status.Convert(err).Message(), "no write permission on /teams/red")
+	s.Equal([]string{"req-1"}, header.Get("x-request-id"))
+}
+
+func (s *GRPCSuite) TestRateLimit() {
+	limiter, err := NewRateLimiter(RateLimitRule{Rate: 0.001, Burst: 1})
+	s.Require().NoError(err)
+
+	srv := s.denyAll()
+	srv.rateLimiter.Store(limiter)
+	client := s.client(srv)
+
+	_, err = client.Remove(context.Background(), &potv1.RemoveRequest{Path: "teams/red", Keys: []string{"a"}})
+	s.Equal(codes.PermissionDenied, status.Code(err))
+
+	_, err = client.Remove(context.Background(), &potv1.RemoveRequest{Path: "teams/red", Keys: []string{"a"}})
+	s.Equal(codes.ResourceExhausted, status.Code(err))
+}
+
+func (s *GRPCSuite) TestWatchAuthorized() {
+	client := s.client(s.denyAll())
+
+	stream, err := client.Watch(context.Background(), &potv1.WatchRequest{Path: "teams/red"})
+	s.Require().NoError(err)
+
+	_, err = stream.Recv()
+	s.Equal(codes.PermissionDenied, status.Code(err))
+}
+
+func (s *GRPCSuite) TestPolicy() {
+	keys, err := NewAPIKeys(APIKey{Name: "alice", Hash: HashAPIKey("secret")})
+	s.Require().NoError(err)
+
+	policy, err := NewPolicy(context.Background(), "", map[string]string{"pot.rego": `package pot
+
+default allow := false
+
+# documents are written by their owners
+allow {
+	input.method == "POST"
+	input.body.owner == input.principal.name
+}
+
+# batches are limited to the a and b documents
+allow {
+	input.method == "POST"
+	input.keys == ["a", "b"]
+}
+
+allow {
+	input.method == "DELETE"
+	not removes_root
+}
+
+removes_root {
+	input.keys[_] == "root"
+}
+`})
+	s.Require().NoError(err)
+
+	// the limits fail the allowed writes before they reach the bucket
+	srv := &Server{authenticators: []Authenticator{keys}, limits: Limits{MaxDocumentSize: 8, MaxBatchKeys: 1}}
+	srv.policy.Store(policy)
+	client := s.client(srv)
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "x-api-key", "secret")
+
+	_, err = client.Create(ctx, &potv1.CreateRequest{Path: "teams/red", Body: []byte(`{"id":"a","owner":"bob"}`)})
+	s.Equal(codes.PermissionDenied, status.Code(err))
+
+	_, err = client.Create(ctx, &potv1.CreateRequest{Path: "teams/red", Body: []byte(`{"id":"a","owner":"alice"}`)})
+	s.Equal(codes.ResourceExhausted, status.Code(err))
+
+	_, err = client.Create(ctx, &potv1.CreateRequest{Path: "teams/red", Body: []byte(`{"a":{},"c":{}}`), Batch: true})
+	s.Equal(codes.PermissionDenied, status.Code(err))
+
+	_, err = client.Create(ctx, &potv1.CreateRequest{Path: "teams/red", Body: []byte(`{"a":{},"b":{}}`), Batch: true})
+	s.Equal(codes.ResourceExhausted, status.Code(err))
+
+	_, err = client.Remove(ctx, &potv1.RemoveRequest{Path: "teams/red", Keys: []string{"a", "root"}})
+	s.Equal(codes.PermissionDenied, status.Code(err))
+}
+
+func (s *GRPCSuite) TestErrors() {
+	cases := []struct {
+		caseName string
+		err      error
+		code     codes.Code
+	}{
+		{"reserved path", ErrReservedPath, codes.InvalidArgument},
+		{"invalid document", ErrInvalidDocument, codes.InvalidArgument},
+		{"norewrite", ErrNoRewriteViolated, codes.FailedPrecondition},
+		{"forbidden", ErrForbidden, codes.PermissionDenied},
+		{"body too large", ErrBodyTooLarge, codes.ResourceExhausted},
+		{"pot too large", ErrPotTooLarge, codes.ResourceExhausted},
+		{"other", context.DeadlineExceeded, codes.Internal},
+	}
+
+	for _, c := range cases {
+		s.Run(c.caseName, func() {
+			s.Equal(c.code, status.Code(grpcError(c.err)))
+		})
+	}
+}
+
+func (s *GRPCSuite) TestWatchEvents() {
+	previous := map[string]json.RawMessage{
+		"a": json.RawMessage(`{"n":1}`),
+		"b": json.RawMessage(`{"n":2}`),
+		"c": json.RawMessage(`{"n":3}`),
+	}
+	current := map[string]json.RawMessage{
+		"a": json.RawMessage(`{"n":1}`),
+		"b": json.RawMessage(`{"n":20}`),
+		"d": json.RawMessage(`{"n":4}`),
+	}
+
+	s.Equal([]WatchEvent{
+		{Action: WatchModified, Key: "b", Document: json.RawMessage(`{"n":20}`)},
+		{Action: WatchRemoved, Key: "c"},
+		{Action: WatchAdded, Key: "d", Document: json.RawMessage(`{"n":4}`)},
+	}, WatchEvents(previous, current))
+
+	s.Empty(WatchEvents(current, current))
+}
+
+func (s *GRPCSuite) TestWatchHub() {
+	hub := &watchHub{}
+
+	wake, unsubscribe := hub.subscribe("teams/red")
+	other, unsubscribeOther := hub.subscribe("teams/blue")
+	defer unsubscribeOther()
+
+	// notifications never block, pending ones are coalesced
+	hub.notify("teams/red")
+	hub.notify("teams/red")
+
+	select {
+	case <-wake:
+	case <-time.After(time.Second):
+		s.Fail("watch was not woken up")
+	}
+	s.Empty(wake)
+	s.Empty(other)
+
+	unsubscribe()
+	hub.notify("teams/red")
+	s.Empty(wake)
+	s.NotContains(hub.subs, "teams/red")
+}
+
+func TestGRPCSuite(t *testing.T) {
+	suite.Run(t, new(GRPCSuite))
+}
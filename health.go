@@ -0,0 +1,156 @@
+package pot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrReservedPath = errors.New("paths starting with : are reserved")
+)
+
+const (
+	// backendCheckTimeout limits the duration of the bucket check of readiness
+	backendCheckTimeout = 2 * time.Second
+
+	// otelErrorWindow is how long an OTEL exporter error marks the server as
+	// not ready
+	otelErrorWindow = time.Minute
+)
+
+// HealthStatus is the result of a health or readiness check.
+type HealthStatus string
+
+const (
+	HealthOK       HealthStatus = "ok"
+	HealthFailed   HealthStatus = "failed"
+	HealthDraining HealthStatus = "draining"
+)
+
+// HealthResponse is the response of the health and readiness endpoints.
+type HealthResponse struct {
+	Status HealthStatus      `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+// Healthy returns whether the server and all of its checks are healthy.
+func (r *HealthResponse) Healthy() bool {
+	return r.Status == HealthOK
+}
+
+// Health reports whether the process is up. It doesn't check any dependencies,
+// so it is meant to be used by liveness probes.
+func (s *Server) Health(context.Context) *HealthResponse {
+	return &HealthResponse{Status: HealthOK}
+}
+
+// Ready reports whether the server can serve requests: it is not shutting
+// down, the bucket is reachable and the OTEL exporters don't fail. It is meant
+// to be used by readiness probes.
+func (s *Server) Ready(ctx context.Context) *HealthResponse {
+	// a draining server is not ready regardless of its dependencies, so the
+	// bucket is not checked at all
+	if s.draining.Load() {
+		return &HealthResponse{Status: HealthDraining}
+	}
+
+	res := &HealthResponse{Status: HealthOK, Checks: map[string]string{}}
+	check := func(name string, err error) {
+		if err != nil {
+			res.Status = HealthFailed
+			res.Checks[name] = err.Error()
+			return
+		}
+
+		res.Checks[name] = string(HealthOK)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, backendCheckTimeout)
+	defer cancel()
+
+	_, err := s.bucket.Attrs(ctx)
+	check("bucket", err)
+
+	if s.MetricsOptions.Enabled || s.TracingOptions.Enabled {
+		check("otel", otelErrors.recent(time.Now()))
+	}
+
+	return res
+}
+
+// Drain marks the server as not ready, so load balancers stop routing new
+// requests to it while the running ones finish. It is meant to be called
+// before http.Server.Shutdown.
+func (s *Server) Drain() {
+	s.draining.Store(true)
+}
+
+func (s *Server) routeHealthFunc(w http.ResponseWriter, r *http.Request) {
+	writeHealth(w, s.Health(r.Context()))
+}
+
+func (s *Server) routeReadyFunc(w http.ResponseWriter, r *http.Request) {
+	writeHealth(w, s.Ready(r.Context()))
+}
+
+func writeHealth(w http.ResponseWriter, res *HealthResponse) {
+	// probes must not be cached by proxies in between
+	w.Header().Set("Cache-Control", "no-store")
+
+	status := http.StatusOK
+	if !res.Healthy() {
+		status = http.StatusServiceUnavailable
+	}
+
+	writeContent(w, CodecJSON, status, res)
+}
+
+// validatePath asserts the pot path doesn't collide with the reserved routes,
+// which all start with a colon.
+func validatePath(relPath string) error {
+	if strings.HasPrefix(relPath, ":") {
+		return fmt.Errorf("%w: %s", ErrReservedPath, relPath)
+	}
+
+	return nil
+}
+
+// exporterErrors records the last error reported by the OTEL exporters.
+type exporterErrors struct {
+	mux  sync.Mutex
+	err  error
+	when time.Time
+}
+
+// otelErrors collects the errors of the OTEL exporters, it is registered as
+// the global OTEL error handler by BootstrapOTEL.
+var otelErrors = &exporterErrors{}
+
+// Handle records and logs the error, it implements otel.ErrorHandler.
+func (e *exporterErrors) Handle(err error) {
+	slog.Error("otel error", slog.String("error", err.Error()))
+
+	e.mux.Lock()
+	defer e.mux.Unlock()
+
+	e.err = err
+	e.when = time.Now()
+}
+
+// recent returns the last error if it was reported within the error window.
+func (e *exporterErrors) recent(now time.Time) error {
+	e.mux.Lock()
+	defer e.mux.Unlock()
+
+	if e.err == nil || now.Sub(e.when) > otelErrorWindow {
+		return nil
+	}
+
+	return e.err
+}
@@ -0,0 +1,96 @@
+package pot
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type HealthSuite struct {
+	suite.Suite
+}
+
+func (s *HealthSuite) TestHealth() {
+	srv := &Server{}
+
+	rec := httptest.NewRecorder()
+	srv.Routes().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/:healthz", nil))
+
+	s.Equal(http.StatusOK, rec.Code)
+	s.Equal("no-store", rec.Header().Get("Cache-Control"))
+
+	res := &HealthResponse{}
+	s.NoError(json.NewDecoder(rec.Body).Decode(res))
+	s.Equal(HealthOK, res.Status)
+}
+
+func (s *HealthSuite) TestReadyDraining() {
+	srv := &Server{}
+	srv.Drain()
+
+	rec := httptest.NewRecorder()
+	srv.Routes().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/:readyz", nil))
+
+	s.Equal(http.StatusServiceUnavailable, rec.Code)
+
+	res := &HealthResponse{}
+	s.NoError(json.NewDecoder(rec.Body).Decode(res))
+	s.Equal(HealthDraining, res.Status)
+}
+
+func (s *HealthSuite) TestReservedPaths() {
+	srv := &Server{}
+
+	cases := []struct {
+		caseName string
+		method   string
+		target   string
+	}{
+		{"read", http.MethodGet, "/:readyz/nested"},
+		{"list", http.MethodGet, "/:reserved:list"},
+		{"export", http.MethodGet, "/:reserved:export"},
+		{"write", http.MethodPost, "/:healthz"},
+		{"increment", http.MethodPost, "/:reserved/key:increment?field=a"},
+		{"import", http.MethodPost, "/:reserved:import"},
+		{"remove", http.MethodDelete, "/:readyz"},
+	}
+
+	for _, c := range cases {
+		s.Run(c.caseName, func() {
+			rec := httptest.NewRecorder()
+			srv.Routes().ServeHTTP(rec, httptest.NewRequest(c.method, c.target, strings.NewReader("{}")))
+
+			s.Equal(http.StatusBadRequest, rec.Code)
+			s.Contains(rec.Body.String(), ErrReservedPath.Error())
+		})
+	}
+}
+
+func (s *HealthSuite) TestParseRecordReservedPath() {
+	_, _, err := parseRecord("", []byte(`{"path":":healthz","key":"a","value":{}}`))
+	s.ErrorIs(err, ErrInvalidRecord)
+	s.ErrorIs(err, ErrReservedPath)
+}
+
+func (s *HealthSuite) TestExporterErrors() {
+	errs := &exporterErrors{}
+	now := time.Now()
+
+	s.NoError(errs.recent(now))
+
+	errs.Handle(errors.New("exporter unavailable"))
+	s.EqualError(errs.recent(now), "exporter unavailable")
+
+	// errors older than the window no longer fail readiness
+	s.NoError(errs.recent(now.Add(otelErrorWindow + time.Second)))
+}
+
+func TestHealthSuite(t *testing.T) {
+	suite.Run(t, new(HealthSuite))
+}
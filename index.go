@@ -0,0 +1,446 @@
+package pot
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/iterator"
+)
+
+var (
+	ErrUnknownIndex = errors.New("unknown index")
+)
+
+const (
+	// indexDir is the bucket directory where index objects are stored. Index
+	// objects are not named data.json, so they never show up as pots.
+	indexDir = ".potindex"
+
+	// indexUpdateAttempts is the number of attempts to update an index object
+	// when it is concurrently modified by another process.
+	indexUpdateAttempts = 10
+)
+
+// indexNamePattern restricts index names to a single segment of the index
+// object paths.
+var indexNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// Index is a secondary index of documents stored under the path prefix by
+// the value of the given field.
+type Index struct {
+	// Name identifies the index in queries
+	Name string `json:"name" yaml:"name" toml:"name"`
+
+	// Prefix limits the index to pots under the given path, all pots are
+	// indexed if empty
+	Prefix string `json:"prefix" yaml:"prefix" toml:"prefix"`
+
+	// Field is the document field to index. Nested fields are separated by dots.
+	Field string `json:"field" yaml:"field" toml:"field"`
+}
+
+// matches checks whether the pot on the given path is covered by the index.
+func (i Index) matches(dir string) bool {
+	prefix := strings.Trim(i.Prefix, "/")
+	return prefix == "" || dir == prefix || strings.HasPrefix(dir, prefix+"/")
+}
+
+// values returns the indexed values of the document. Scalars are indexed by
+// their string representation and arrays by each of their scalar elements.
+func (i Index) values(doc json.RawMessage) []string {
+	if doc == nil {
+		return nil
+	}
+
+	var v any
+	if err := json.Unmarshal(doc, &v); err != nil {
+		return nil
+	}
+
+	for _, field := range strings.Split(i.Field, ".") {
+		obj, ok := v.(map[string]any)
+		if !ok {
+			return nil
+		}
+		v = obj[field]
+	}
+
+	if arr, ok := v.([]any); ok {
+		values := []string{}
+		for _, elem := range arr {
+			if s, ok := indexValue(elem); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+
+	if s, ok := indexValue(v); ok {
+		return []string{s}
+	}
+
+	return nil
+}
+
+// indexValue returns the string representation of a scalar value.
+func indexValue(v any) (string, bool) {
+	switch t := v.(type) {
+	case string:
+		return t, true
+	case float64, bool:
+		b, _ := json.Marshal(t)
+		return string(b), true
+	}
+
+	return "", false
+}
+
+// objectName returns the name of the index object holding the given value.
+func (i Index) objectName(value string) string {
+	return path.Join(indexDir, i.Name, url.PathEscape(value)+".json")
+}
+
+// IndexMatch is a pot path and the keys of its documents matching the query.
+type IndexMatch struct {
+	Path string   `json:"path"`
+	Keys []string `json:"keys"`
+}
+
+// IndexResponse is the response returned by the Query method.
+type IndexResponse struct {
+	Matches []IndexMatch `json:"matches"`
+}
+
+// IndexRebuildResponse is the response returned by the RebuildIndex method.
+type IndexRebuildResponse struct {
+	// Pots is the number of pots covered by the index
+	Pots int `json:"pots"`
+
+	// Values is the number of distinct indexed values
+	Values int `json:"values"`
+}
+
+// indexEntries are the contents of an index object, the document keys by
+// their pot paths.
+type indexEntries map[string][]string
+
+// WithIndex maintains a secondary index of documents stored under the path
+// prefix by the value of the given field. Indexes are updated on every write
+// and can be queried by their name. Documents written before the index was
+// configured are only indexed by RebuildIndex.
+func WithIndex(index Index) Option {
+	return func(c *Server) {
+		c.indexes = append(c.indexes, index)
+	}
+}
+
+// validateIndexes checks the index definitions against the server options.
+func (s *Server) validateIndexes() error {
+	names := map[string]bool{}
+	for _, index := range s.indexes {
+		if index.Name == "" || index.Field == "" {
+			return fmt.Errorf("index must have a name and a field: %+v", index)
+		}
+		if !indexNamePattern.MatchString(index.Name) {
+			return fmt.Errorf("invalid index name %s, only letters, digits, dots, dashes and underscores are allowed", index.Name)
+		}
+		if names[index.Name] {
+			return fmt.Errorf("duplicate index: %s", index.Name)
+		}
+		names[index.Name] = true
+
+		// index objects are stored in plaintext, so they would leak the values
+		// of encrypted documents
+		if s.encryption.keys != nil {
+			field := strings.Split(index.Field, ".")[0]
+			if len(s.encryption.fields) == 0 || slices.Contains(s.encryption.fields, field) {
+				return fmt.Errorf("index %s can't be defined on an encrypted field", index.Name)
+			}
+		}
+	}
+
+	return nil
+}
+
+// indexChange is an addition or removal of a document key on the index object.
+type indexChange struct {
+	path string
+	key  string
+	add  bool
+}
+
+// updateIndexes updates all indexes covering the path with the changed
+// documents. Before holds the previous content of changed documents and after
+// the new content, a missing document means it didn't exist or was removed.
+// Failures don't fail the write, the entries missed by them are restored by
+// RebuildIndex.
+func (s *Server) updateIndexes(ctx context.Context, dir string, before, after map[string]json.RawMessage) {
+	for _, index := range s.indexes {
+		if !index.matches(dir) {
+			continue
+		}
+
+		changes := map[string][]indexChange{}
+		for _, key := range unionKeys(before, after) {
+			oldValues, newValues := index.values(before[key]), index.values(after[key])
+
+			for _, v := range oldValues {
+				if !slices.Contains(newValues, v) {
+					changes[v] = append(changes[v], indexChange{path: dir, key: key, add: false})
+				}
+			}
+			for _, v := range newValues {
+				if !slices.Contains(oldValues, v) {
+					changes[v] = append(changes[v], indexChange{path: dir, key: key, add: true})
+				}
+			}
+		}
+
+		for value, valueChanges := range changes {
+			if err := s.updateIndexObject(ctx, index.objectName(value), valueChanges); err != nil {
+				slog.Error(
+					"failed to update index, rebuild the index to restore the missing entries",
+					slog.String("index", index.Name),
+					slog.String("dir", dir),
+					slog.String("error", err.Error()),
+				)
+			}
+		}
+	}
+}
+
+// updateIndexObject applies the changes to the index object. The object is
+// updated using generation preconditions and the update is retried if another
+// process modified the object in the meantime.
+func (s *Server) updateIndexObject(ctx context.Context, name string, changes []indexChange) error {
+	var err error
+	for attempt := 0; attempt < indexUpdateAttempts; attempt++ {
+		err = s.tryUpdateIndexObject(ctx, name, changes)
+
+		var gerr *googleapi.Error
+		if errors.As(err, &gerr) && gerr.Code == http.StatusPreconditionFailed {
+			continue
+		}
+
+		return err
+	}
+
+	return err
+}
+
+func (s *Server) tryUpdateIndexObject(ctx context.Context, name string, changes []indexChange) error {
+	obj := s.bucket.Object(name)
+	entries := indexEntries{}
+	conds := storage.Conditions{DoesNotExist: true}
+
+	reader, err := obj.NewReader(ctx)
+	if err != nil && !errors.Is(err, storage.ErrObjectNotExist) {
+		return err
+	}
+	if err == nil {
+		err := json.NewDecoder(reader).Decode(&entries)
+		reader.Close()
+		if err != nil {
+			return err
+		}
+
+		conds = storage.Conditions{GenerationMatch: reader.Attrs.Generation}
+	}
+
+	for _, change := range changes {
+		keys := entries[change.path]
+		if change.add && !slices.Contains(keys, change.key) {
+			keys = append(keys, change.key)
+			sort.Strings(keys)
+		}
+		if !change.add {
+			keys = slices.DeleteFunc(keys, func(k string) bool { return k == change.key })
+		}
+
+		if len(keys) == 0 {
+			delete(entries, change.path)
+		} else {
+			entries[change.path] = keys
+		}
+	}
+
+	if len(entries) == 0 {
+		if conds.DoesNotExist {
+			return nil
+		}
+
+		err := obj.If(conds).Delete(ctx)
+		if errors.Is(err, storage.ErrObjectNotExist) {
+			return nil
+		}
+		return err
+	}
+
+	writeCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	w := obj.If(conds).NewWriter(writeCtx)
+	w.ContentType = "application/json"
+	if err := json.NewEncoder(w).Encode(entries); err != nil {
+		return err
+	}
+
+	return w.Close()
+}
+
+// findIndex returns the index of the given name.
+func (s *Server) findIndex(name string) (*Index, error) {
+	for i := range s.indexes {
+		if s.indexes[i].Name == name {
+			return &s.indexes[i], nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: %s", ErrUnknownIndex, name)
+}
+
+// RebuildIndex recreates the index objects from the documents of all pots
+// covered by the index, and removes the objects of values no document has
+// anymore. This backfills the pots written before the index was configured
+// and restores the entries missed by failed updates. Writes made while the
+// index is rebuilt may be missed, so it should be rebuilt while its pots are
+// not written.
+func (s *Server) RebuildIndex(ctx context.Context, name string) (*IndexRebuildResponse, error) {
+	index, err := s.findIndex(name)
+	if err != nil {
+		return nil, err
+	}
+
+	paths, err := s.ListPaths(ctx, strings.Trim(index.Prefix, "/"))
+	if err != nil {
+		return nil, err
+	}
+
+	res := &IndexRebuildResponse{}
+	objects := map[string]indexEntries{}
+	for _, dir := range paths.Paths {
+		if !index.matches(dir) {
+			continue
+		}
+
+		docs, _, err := s.readDocuments(ctx, dir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", dir, err)
+		}
+		res.Pots++
+
+		for _, key := range sortedKeys(docs) {
+			for _, value := range index.values(docs[key]) {
+				name := index.objectName(value)
+				if objects[name] == nil {
+					objects[name] = indexEntries{}
+				}
+				objects[name][dir] = append(objects[name][dir], key)
+			}
+		}
+	}
+	res.Values = len(objects)
+
+	// objects of values that are no longer indexed are removed first, so the
+	// listing doesn't include the objects written below
+	objList := s.bucket.Objects(ctx, &storage.Query{Prefix: path.Join(indexDir, index.Name) + "/"})
+	for {
+		attrs, err := objList.Next()
+		if errors.Is(err, iterator.Done) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if _, ok := objects[attrs.Name]; ok {
+			continue
+		}
+
+		err = s.bucket.Object(attrs.Name).Delete(ctx)
+		if err != nil && !errors.Is(err, storage.ErrObjectNotExist) {
+			return nil, err
+		}
+	}
+
+	for _, name := range sortedKeys(objects) {
+		if err := s.writeIndexObject(ctx, name, objects[name]); err != nil {
+			return nil, err
+		}
+	}
+
+	return res, nil
+}
+
+// writeIndexObject replaces the index object with the entries.
+func (s *Server) writeIndexObject(ctx context.Context, name string, entries indexEntries) error {
+	writeCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	w := s.bucket.Object(name).NewWriter(writeCtx)
+	w.ContentType = "application/json"
+	if err := json.NewEncoder(w).Encode(entries); err != nil {
+		return err
+	}
+
+	return w.Close()
+}
+
+// Query returns the paths and keys of documents whose indexed field has the
+// given value.
+func (s *Server) Query(ctx context.Context, name, value string) (*IndexResponse, error) {
+	index, err := s.findIndex(name)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &IndexResponse{
+		Matches: []IndexMatch{},
+	}
+
+	reader, err := s.bucket.Object(index.objectName(value)).NewReader(ctx)
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return res, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	entries := indexEntries{}
+	if err := json.NewDecoder(reader).Decode(&entries); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+
+	for _, p := range sortedKeys(entries) {
+		res.Matches = append(res.Matches, IndexMatch{Path: p, Keys: entries[p]})
+	}
+
+	return res, nil
+}
+
+// unionKeys returns the sorted keys present in either of the maps.
+func unionKeys(a, b map[string]json.RawMessage) []string {
+	union := map[string]bool{}
+	for k := range a {
+		union[k] = true
+	}
+	for k := range b {
+		union[k] = true
+	}
+
+	return sortedKeys(union)
+}
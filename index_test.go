@@ -0,0 +1,103 @@
+package pot
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type IndexSuite struct {
+	suite.Suite
+}
+
+func (s *IndexSuite) TestMatches() {
+	cases := []struct {
+		caseName string
+		prefix   string
+		dir      string
+		expected bool
+	}{
+		{"empty prefix", "", "projects/a", true},
+		{"same path", "projects", "projects", true},
+		{"nested path", "projects/", "projects/a/b", true},
+		{"sibling path", "projects", "projects-old/a", false},
+		{"other path", "projects", "users/a", false},
+	}
+
+	for _, c := range cases {
+		s.Run(c.caseName, func() {
+			s.Equal(c.expected, Index{Name: "i", Prefix: c.prefix, Field: "f"}.matches(c.dir))
+		})
+	}
+}
+
+func (s *IndexSuite) TestValues() {
+	cases := []struct {
+		caseName string
+		field    string
+		doc      string
+		expected []string
+	}{
+		{"string", "subject", `{"subject":"user:a"}`, []string{"user:a"}},
+		{"number", "age", `{"age":42}`, []string{"42"}},
+		{"bool", "admin", `{"admin":true}`, []string{"true"}},
+		{"nested", "subject.id", `{"subject":{"id":"a"}}`, []string{"a"}},
+		{"array", "subjects", `{"subjects":["a","b",{"c":1}]}`, []string{"a", "b"}},
+		{"missing", "subject", `{"id":"a"}`, nil},
+		{"object", "subject", `{"subject":{"id":"a"}}`, nil},
+		{"not an object", "subject", `"a"`, nil},
+		{"no document", "subject", ``, nil},
+	}
+
+	for _, c := range cases {
+		s.Run(c.caseName, func() {
+			var doc json.RawMessage
+			if c.doc != "" {
+				doc = json.RawMessage(c.doc)
+			}
+
+			s.Equal(c.expected, Index{Name: "i", Field: c.field}.values(doc))
+		})
+	}
+}
+
+func (s *IndexSuite) TestObjectName() {
+	s.Equal(".potindex/subjects/user:a%2Fb.json", Index{Name: "subjects", Field: "subject"}.objectName("user:a/b"))
+}
+
+func (s *IndexSuite) TestValidate() {
+	keys, err := NewLocalKeySource("k", map[string][]byte{"k": make([]byte, 32)})
+	s.Require().NoError(err)
+
+	cases := []struct {
+		caseName string
+		server   *Server
+		err      bool
+	}{
+		{"valid", &Server{indexes: []Index{{Name: "a", Field: "f"}, {Name: "b", Field: "f"}}}, false},
+		{"missing field", &Server{indexes: []Index{{Name: "a"}}}, true},
+		{"dotted name", &Server{indexes: []Index{{Name: "by.owner_v2", Field: "f"}}}, false},
+		{"name with slash", &Server{indexes: []Index{{Name: "a/b", Field: "f"}}}, true},
+		{"name with dots only", &Server{indexes: []Index{{Name: "..", Field: "f"}}}, true},
+		{"duplicate", &Server{indexes: []Index{{Name: "a", Field: "f"}, {Name: "a", Field: "g"}}}, true},
+		{"whole pot encrypted", &Server{indexes: []Index{{Name: "a", Field: "f"}}, encryption: encryptionOptions{keys: keys}}, true},
+		{"encrypted field", &Server{indexes: []Index{{Name: "a", Field: "f.g"}}, encryption: encryptionOptions{keys: keys, fields: []string{"f"}}}, true},
+		{"plaintext field", &Server{indexes: []Index{{Name: "a", Field: "g"}}, encryption: encryptionOptions{keys: keys, fields: []string{"f"}}}, false},
+	}
+
+	for _, c := range cases {
+		s.Run(c.caseName, func() {
+			err := c.server.validateIndexes()
+			if c.err {
+				s.Error(err)
+			} else {
+				s.NoError(err)
+			}
+		})
+	}
+}
+
+func TestIndexSuite(t *testing.T) {
+	suite.Run(t, new(IndexSuite))
+}
@@ -0,0 +1,289 @@
+package pot
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/go-jose/go-jose/v4/jwt"
+)
+
+var (
+	ErrInvalidToken      = errors.New("invalid token")
+	ErrUnknownSigningKey = errors.New("unknown signing key")
+)
+
+const (
+	// AuthMethodJWT is the authentication method of principals authenticated
+	// by a JWT
+	AuthMethodJWT = "jwt"
+
+	// defaultJWKSCacheTTL is how long fetched keys are used before they are
+	// fetched again
+	defaultJWKSCacheTTL = time.Hour
+
+	// jwksMinRefresh is the minimal interval between fetches triggered by
+	// tokens signed with unknown keys, so such tokens can't flood the issuer
+	jwksMinRefresh = time.Minute
+
+	// jwksMaxSize limits the size of fetched key sets
+	jwksMaxSize = 1 << 20
+)
+
+// jwtAlgorithms are the accepted signature algorithms. Symmetric algorithms
+// are not accepted, as their keys can't be published in a key set.
+var jwtAlgorithms = []jose.SignatureAlgorithm{
+	jose.RS256, jose.RS384, jose.RS512,
+	jose.PS256, jose.PS384, jose.PS512,
+	jose.ES256, jose.ES384, jose.ES512,
+	jose.EdDSA,
+}
+
+// JWKS is a source of the public keys verifying JWT signatures.
+type JWKS interface {
+	// Key returns the keys with the key ID.
+	Key(ctx context.Context, kid string) ([]jose.JSONWebKey, error)
+}
+
+// StaticJWKS is a fixed key set, e.g. loaded from a local file in tests.
+type StaticJWKS struct {
+	keys jose.JSONWebKeySet
+}
+
+// NewStaticJWKS creates the key set of the keys.
+func NewStaticJWKS(keys ...jose.JSONWebKey) *StaticJWKS {
+	return &StaticJWKS{keys: jose.JSONWebKeySet{Keys: keys}}
+}
+
+// LoadJWKSFile reads the key set from the JSON file.
+func LoadJWKSFile(path string) (*StaticJWKS, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &StaticJWKS{}
+	if err := json.Unmarshal(b, &s.keys); err != nil {
+		return nil, fmt.Errorf("invalid key set %s: %w", path, err)
+	}
+
+	return s, nil
+}
+
+func (s *StaticJWKS) Key(_ context.Context, kid string) ([]jose.JSONWebKey, error) {
+	return s.keys.Key(kid), nil
+}
+
+// RemoteJWKS is a key set fetched from a URL, e.g. the jwks_uri of an OIDC
+// issuer. Keys are cached and fetched again once the cache expires, or earlier
+// if a token is signed with an unknown key after the issuer rotated its keys.
+type RemoteJWKS struct {
+	url    string
+	ttl    time.Duration
+	client *http.Client
+
+	mux     sync.Mutex
+	keys    *jose.JSONWebKeySet
+	fetched time.Time
+}
+
+// NewRemoteJWKS creates the key set fetched from the URL and cached for the
+// ttl, or an hour if zero.
+func NewRemoteJWKS(url string, ttl time.Duration) *RemoteJWKS {
+	if ttl <= 0 {
+		ttl = defaultJWKSCacheTTL
+	}
+
+	return &RemoteJWKS{
+		url:    url,
+		ttl:    ttl,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (r *RemoteJWKS) Key(ctx context.Context, kid string) ([]jose.JSONWebKey, error) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	if r.keys == nil || time.Since(r.fetched) > r.ttl {
+		if err := r.fetch(ctx); err != nil {
+			// stale keys are better than no keys while the issuer is down
+			if r.keys == nil {
+				return nil, err
+			}
+
+			slog.Error("failed to fetch the key set", slog.String("url", r.url), slog.String("error", err.Error()))
+		}
+	}
+
+	keys := r.keys.Key(kid)
+	if len(keys) == 0 && time.Since(r.fetched) > jwksMinRefresh {
+		if err := r.fetch(ctx); err != nil {
+			return nil, err
+		}
+
+		keys = r.keys.Key(kid)
+	}
+
+	return keys, nil
+}
+
+// fetch downloads the key set and replaces the cached keys.
+func (r *RemoteJWKS) fetch(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.url, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return unexpectedStatus(resp)
+	}
+
+	keys := &jose.JSONWebKeySet{}
+	if err := json.NewDecoder(http.MaxBytesReader(nil, resp.Body, jwksMaxSize)).Decode(keys); err != nil {
+		return fmt.Errorf("invalid key set %s: %w", r.url, err)
+	}
+
+	r.keys = keys
+	r.fetched = time.Now()
+	return nil
+}
+
+// JWTOptions configure the validation of tokens and their mapping onto
+// principals.
+type JWTOptions struct {
+	// Issuer must match the iss claim
+	Issuer string
+
+	// Audience must contain one of the aud claims
+	Audience []string
+
+	// NameClaim is the claim used as the principal name, sub if empty
+	NameClaim string
+
+	// GroupsClaim is the claim holding the groups of the principal, either a
+	// string or a list of strings
+	GroupsClaim string
+}
+
+// JWTAuthenticator authenticates requests carrying a signed JWT as a bearer
+// token, e.g. an OIDC ID token of a workload identity.
+type JWTAuthenticator struct {
+	keys JWKS
+	opts JWTOptions
+}
+
+// NewJWTAuthenticator creates the authenticator verifying tokens with the keys.
+func NewJWTAuthenticator(keys JWKS, opts JWTOptions) *JWTAuthenticator {
+	if opts.NameClaim == "" {
+		opts.NameClaim = "sub"
+	}
+
+	return &JWTAuthenticator{keys: keys, opts: opts}
+}
+
+func (a *JWTAuthenticator) Authenticate(r *http.Request) (*Principal, error) {
+	token, ok := bearerToken(r)
+
+	// bearer tokens that are not JWTs are left to the other authenticators
+	if !ok || strings.Count(token, ".") != 2 {
+		return nil, nil
+	}
+
+	claims, err := a.verify(r.Context(), token, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+
+	return a.principal(claims)
+}
+
+// verify checks the signature and the registered claims of the token and
+// returns all of its claims.
+func (a *JWTAuthenticator) verify(ctx context.Context, token string, now time.Time) (map[string]any, error) {
+	parsed, err := jwt.ParseSigned(token, jwtAlgorithms)
+	if err != nil {
+		return nil, err
+	}
+
+	kid := parsed.Headers[0].KeyID
+	keys, err := a.keys.Key(ctx, kid)
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownSigningKey, kid)
+	}
+
+	registered := jwt.Claims{}
+	claims := map[string]any{}
+	for _, key := range keys {
+		if err = parsed.Claims(key, &registered, &claims); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// tokens that never expire are not accepted
+	if registered.Expiry == nil {
+		return nil, errors.New("missing exp claim")
+	}
+
+	err = registered.Validate(jwt.Expected{
+		Issuer:      a.opts.Issuer,
+		AnyAudience: a.opts.Audience,
+		Time:        now,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
+
+// principal maps the claims onto the principal.
+func (a *JWTAuthenticator) principal(claims map[string]any) (*Principal, error) {
+	name, _ := claims[a.opts.NameClaim].(string)
+	if name == "" {
+		return nil, fmt.Errorf("%w: missing %s claim", ErrInvalidToken, a.opts.NameClaim)
+	}
+
+	p := &Principal{
+		Name:   name,
+		Method: AuthMethodJWT,
+		Claims: claims,
+	}
+	p.Subject, _ = claims["sub"].(string)
+	p.Issuer, _ = claims["iss"].(string)
+
+	if a.opts.GroupsClaim != "" {
+		switch groups := claims[a.opts.GroupsClaim].(type) {
+		case string:
+			p.Groups = []string{groups}
+		case []any:
+			for _, group := range groups {
+				if g, ok := group.(string); ok {
+					p.Groups = append(p.Groups, g)
+				}
+			}
+		}
+	}
+
+	return p, nil
+}
@@ -0,0 +1,193 @@
+package pot
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/go-jose/go-jose/v4/jwt"
+	"github.com/stretchr/testify/suite"
+)
+
+type JWTSuite struct {
+	suite.Suite
+
+	key *jose.JSONWebKey
+}
+
+func (s *JWTSuite) SetupTest() {
+	s.key = s.newKey("key-1")
+}
+
+func (s *JWTSuite) newKey(kid string) *jose.JSONWebKey {
+	private, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	s.Require().NoError(err)
+
+	return &jose.JSONWebKey{Key: private, KeyID: kid, Algorithm: string(jose.ES256), Use: "sig"}
+}
+
+func (s *JWTSuite) sign(key *jose.JSONWebKey, claims map[string]any) string {
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.ES256, Key: key}, (&jose.SignerOptions{}).WithType("JWT"))
+	s.Require().NoError(err)
+
+	token, err := jwt.Signed(signer).Claims(claims).Serialize()
+	s.Require().NoError(err)
+
+	return token
+}
+
+func (s *JWTSuite) claims(overrides map[string]any) map[string]any {
+	claims := map[string]any{
+		"iss":    "https://issuer.example.com",
+		"aud":    "pot",
+		"sub":    "service-a",
+		"email":  "service-a@example.com",
+		"groups": []string{"readers", "writers"},
+		"exp":    time.Now().Add(time.Hour).Unix(),
+	}
+	for k, v := range overrides {
+		if v == nil {
+			delete(claims, k)
+			continue
+		}
+		claims[k] = v
+	}
+
+	return claims
+}
+
+func (s *JWTSuite) authenticate(a Authenticator, token string) (*Principal, error) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	return a.Authenticate(r)
+}
+
+func (s *JWTSuite) TestAuthenticate() {
+	a := NewJWTAuthenticator(NewStaticJWKS(s.key.Public()), JWTOptions{
+		Issuer:      "https://issuer.example.com",
+		Audience:    []string{"pot", "other"},
+		GroupsClaim: "groups",
+	})
+
+	cases := []struct {
+		caseName string
+		token    string
+		err      bool
+		name     string
+	}{
+		{"valid", s.sign(s.key, s.claims(nil)), false, "service-a"},
+		{"wrong issuer", s.sign(s.key, s.claims(map[string]any{"iss": "https://evil.example.com"})), true, ""},
+		{"wrong audience", s.sign(s.key, s.claims(map[string]any{"aud": "else"})), true, ""},
+		{"expired", s.sign(s.key, s.claims(map[string]any{"exp": time.Now().Add(-time.Hour).Unix()})), true, ""},
+		{"missing expiry", s.sign(s.key, s.claims(map[string]any{"exp": nil})), true, ""},
+		{"unknown key", s.sign(s.newKey("key-2"), s.claims(nil)), true, ""},
+		{"forged signature", s.sign(s.newKey("key-1"), s.claims(nil)), true, ""},
+		{"not a jwt", "api-key", false, ""},
+		{"no token", "", false, ""},
+	}
+
+	for _, c := range cases {
+		s.Run(c.caseName, func() {
+			p, err := s.authenticate(a, c.token)
+			if c.err {
+				s.ErrorIs(err, ErrInvalidToken)
+				return
+			}
+
+			s.NoError(err)
+			if c.name == "" {
+				s.Nil(p)
+				return
+			}
+
+			s.Equal(c.name, p.Name)
+			s.Equal(AuthMethodJWT, p.Method)
+			s.Equal("service-a", p.Subject)
+			s.Equal("https://issuer.example.com", p.Issuer)
+			s.Equal([]string{"readers", "writers"}, p.Groups)
+			s.Equal("service-a@example.com", p.Claims["email"])
+		})
+	}
+}
+
+func (s *JWTSuite) TestNameClaim() {
+	a := NewJWTAuthenticator(NewStaticJWKS(s.key.Public()), JWTOptions{
+		Issuer:    "https://issuer.example.com",
+		Audience:  []string{"pot"},
+		NameClaim: "email",
+	})
+
+	p, err := s.authenticate(a, s.sign(s.key, s.claims(nil)))
+	s.NoError(err)
+	s.Equal("service-a@example.com", p.Name)
+
+	_, err = s.authenticate(a, s.sign(s.key, s.claims(map[string]any{"email": nil})))
+	s.ErrorIs(err, ErrInvalidToken)
+}
+
+func (s *JWTSuite) TestLoadJWKSFile() {
+	b, err := json.Marshal(jose.JSONWebKeySet{Keys: []jose.JSONWebKey{s.key.Public()}})
+	s.NoError(err)
+
+	file := filepath.Join(s.T().TempDir(), "jwks.json")
+	s.NoError(os.WriteFile(file, b, 0o600))
+
+	keys, err := LoadJWKSFile(file)
+	s.NoError(err)
+
+	found, err := keys.Key(context.Background(), "key-1")
+	s.NoError(err)
+	s.Len(found, 1)
+}
+
+func (s *JWTSuite) TestRemoteJWKSRotation() {
+	rotated := s.newKey("key-2")
+
+	var fetches atomic.Int32
+	var current atomic.Pointer[jose.JSONWebKey]
+	current.Store(s.key)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		json.NewEncoder(w).Encode(jose.JSONWebKeySet{Keys: []jose.JSONWebKey{current.Load().Public()}})
+	}))
+	defer ts.Close()
+
+	keys := NewRemoteJWKS(ts.URL, time.Hour)
+	a := NewJWTAuthenticator(keys, JWTOptions{Issuer: "https://issuer.example.com", Audience: []string{"pot"}})
+
+	_, err := s.authenticate(a, s.sign(s.key, s.claims(nil)))
+	s.NoError(err)
+	_, err = s.authenticate(a, s.sign(s.key, s.claims(nil)))
+	s.NoError(err)
+	s.Equal(int32(1), fetches.Load(), "keys are cached")
+
+	// the issuer rotated its key, which is fetched once the cached keys are
+	// old enough
+	current.Store(rotated)
+	_, err = s.authenticate(a, s.sign(rotated, s.claims(nil)))
+	s.ErrorIs(err, ErrInvalidToken)
+	s.Equal(int32(1), fetches.Load(), "refetch is rate limited")
+
+	keys.fetched = keys.fetched.Add(-jwksMinRefresh - time.Second)
+	_, err = s.authenticate(a, s.sign(rotated, s.claims(nil)))
+	s.NoError(err)
+	s.Equal(int32(2), fetches.Load())
+}
+
+func TestJWTSuite(t *testing.T) {
+	suite.Run(t, new(JWTSuite))
+}
@@ -0,0 +1,166 @@
+package pot
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+var (
+	ErrBodyTooLarge     = errors.New("request body too large")
+	ErrDocumentTooLarge = errors.New("document too large")
+	ErrTooManyKeys      = errors.New("too many keys")
+	ErrPotTooLarge      = errors.New("pot too large")
+)
+
+// Limits caps the size of writes and pots. Zero values are not limited.
+type Limits struct {
+	// MaxBodySize is the largest body of a write, in bytes
+	MaxBodySize int64 `json:"maxBodySize,omitempty" yaml:"maxBodySize,omitempty" toml:"maxBodySize,omitempty"`
+
+	// MaxBatchKeys is the largest number of documents written by a batch
+	MaxBatchKeys int `json:"maxBatchKeys,omitempty" yaml:"maxBatchKeys,omitempty" toml:"maxBatchKeys,omitempty"`
+
+	// MaxDocumentSize is the largest JSON encoded document, in bytes
+	MaxDocumentSize int64 `json:"maxDocumentSize,omitempty" yaml:"maxDocumentSize,omitempty" toml:"maxDocumentSize,omitempty"`
+
+	// MaxPotSize is the largest JSON encoded pot, in bytes, before it is
+	// compressed or encrypted
+	MaxPotSize int64 `json:"maxPotSize,omitempty" yaml:"maxPotSize,omitempty" toml:"maxPotSize,omitempty"`
+
+	// MaxPotKeys is the largest number of documents in a pot
+	MaxPotKeys int `json:"maxPotKeys,omitempty" yaml:"maxPotKeys,omitempty" toml:"maxPotKeys,omitempty"`
+}
+
+// validate asserts that none of the limits is negative.
+func (l Limits) validate() error {
+	if l.MaxBodySize < 0 || l.MaxBatchKeys < 0 || l.MaxDocumentSize < 0 || l.MaxPotSize < 0 || l.MaxPotKeys < 0 {
+		return errors.New("limits must not be negative")
+	}
+
+	return nil
+}
+
+// WithLimits caps the size of writes and pots. Writes exceeding the limits
+// fail as a whole and leave the pot untouched. Pots that exceed the limits
+// already can still be shrunk by removing documents.
+func WithLimits(limits Limits) Option {
+	return func(c *Server) {
+		c.limits = limits
+	}
+}
+
+// bodyReader fails reads once more than max bytes were read.
+type bodyReader struct {
+	r        io.Reader
+	max      int64
+	n        int64
+	exceeded bool
+}
+
+func (b *bodyReader) Read(p []byte) (int, error) {
+	if b.exceeded {
+		return 0, b.err()
+	}
+
+	n, err := b.r.Read(p)
+	b.n += int64(n)
+	if b.n > b.max {
+		b.exceeded = true
+		return 0, b.err()
+	}
+
+	return n, err
+}
+
+func (b *bodyReader) err() error {
+	return fmt.Errorf("%w: more than %d bytes", ErrBodyTooLarge, b.max)
+}
+
+// limitBody returns the reader of the body that fails once the body exceeds
+// the limit, along with a function that replaces decoding errors by the
+// limit error. Codecs may not pass on the errors of the reader as is.
+func (l Limits) limitBody(r io.Reader) (io.Reader, func(error) error) {
+	if l.MaxBodySize <= 0 {
+		return r, func(err error) error { return err }
+	}
+
+	body := &bodyReader{r: r, max: l.MaxBodySize}
+	return body, func(err error) error {
+		if err != nil && body.exceeded {
+			return body.err()
+		}
+		return err
+	}
+}
+
+// checkWrite asserts that the documents of the write are within the limits.
+func (l Limits) checkWrite(docs map[string]json.RawMessage, batch bool) error {
+	if batch && l.MaxBatchKeys > 0 && len(docs) > l.MaxBatchKeys {
+		return fmt.Errorf("%w: batch of %d documents exceeds %d", ErrTooManyKeys, len(docs), l.MaxBatchKeys)
+	}
+
+	for _, key := range sortedKeys(docs) {
+		if err := l.checkDocument(key, docs[key]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// checkDocument asserts that the document is within the size limit.
+func (l Limits) checkDocument(key string, doc json.RawMessage) error {
+	if l.MaxDocumentSize > 0 && int64(len(doc)) > l.MaxDocumentSize {
+		return fmt.Errorf("%w: %s has %d bytes, exceeding %d", ErrDocumentTooLarge, key, len(doc), l.MaxDocumentSize)
+	}
+
+	return nil
+}
+
+// potLimiter counts the documents written to a pot and fails once the pot
+// exceeds the limits.
+type potLimiter struct {
+	limits Limits
+	keys   int
+	size   int64
+}
+
+func (p *potLimiter) add(key string, doc json.RawMessage) error {
+	p.keys++
+	// the key, its quotes and separators are counted along with the document
+	p.size += int64(len(key) + len(doc) + 4)
+
+	if p.limits.MaxPotKeys > 0 && p.keys > p.limits.MaxPotKeys {
+		return fmt.Errorf("%w: more than %d documents", ErrPotTooLarge, p.limits.MaxPotKeys)
+	}
+	if p.limits.MaxPotSize > 0 && p.size > p.limits.MaxPotSize {
+		return fmt.Errorf("%w: more than %d bytes", ErrPotTooLarge, p.limits.MaxPotSize)
+	}
+
+	return nil
+}
+
+// limitStatus returns the status of the errors reporting exceeded limits.
+func limitStatus(err error) (int, bool) {
+	switch {
+	case errors.Is(err, ErrBodyTooLarge), errors.Is(err, ErrDocumentTooLarge):
+		return http.StatusRequestEntityTooLarge, true
+	case errors.Is(err, ErrTooManyKeys), errors.Is(err, ErrPotTooLarge):
+		return http.StatusUnprocessableEntity, true
+	}
+
+	return 0, false
+}
+
+// potLimiter returns the limiter of the pots written by Create and Import, nil
+// if the pots are not limited.
+func (s *Server) potLimiter() *potLimiter {
+	if s.limits.MaxPotKeys <= 0 && s.limits.MaxPotSize <= 0 {
+		return nil
+	}
+
+	return &potLimiter{limits: s.limits}
+}
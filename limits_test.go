@@ -0,0 +1,94 @@
+package pot
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type LimitsSuite struct {
+	suite.Suite
+}
+
+func (s *LimitsSuite) TestCreateRejectsWrites() {
+	srv := &Server{limits: Limits{MaxBodySize: 64, MaxBatchKeys: 2, MaxDocumentSize: 24}}
+
+	cases := []struct {
+		caseName string
+		body     string
+		batch    bool
+		err      error
+	}{
+		{"body too large", `{"id":"a","text":"` + strings.Repeat("x", 64) + `"}`, false, ErrBodyTooLarge},
+		{"document too large", `{"id":"a","text":"` + strings.Repeat("x", 16) + `"}`, false, ErrDocumentTooLarge},
+		{"too many keys", `{"a":{},"b":{},"c":{}}`, true, ErrTooManyKeys},
+		{"batch document too large", `{"a":{},"b":{"text":"` + strings.Repeat("x", 16) + `"}}`, true, ErrDocumentTooLarge},
+	}
+
+	for _, c := range cases {
+		s.Run(c.caseName, func() {
+			opts := []CallOpt{}
+			if c.batch {
+				opts = append(opts, WithBatch())
+			}
+
+			_, err := srv.Create(context.Background(), "limits", strings.NewReader(c.body), opts...)
+			s.ErrorIs(err, c.err)
+		})
+	}
+}
+
+func (s *LimitsSuite) TestBodyLimitOfCodecs() {
+	srv := &Server{limits: Limits{MaxBodySize: 16}}
+
+	for _, codec := range []Codec{CodecJSON, CodecYAML, CodecCBOR, CodecMessagePack} {
+		s.Run(codec.ContentType(), func() {
+			body := &strings.Builder{}
+			s.Require().NoError(codec.Encode(body, map[string]any{"id": "a", "text": strings.Repeat("x", 32)}))
+
+			_, err := srv.Create(context.Background(), "limits", strings.NewReader(body.String()), WithRequestCodec(codec))
+			s.ErrorIs(err, ErrBodyTooLarge)
+		})
+	}
+}
+
+func (s *LimitsSuite) TestPotLimiter() {
+	doc := json.RawMessage(`{"n":1}`)
+
+	keys := &potLimiter{limits: Limits{MaxPotKeys: 2}}
+	s.NoError(keys.add("a", doc))
+	s.NoError(keys.add("b", doc))
+	s.ErrorIs(keys.add("c", doc), ErrPotTooLarge)
+
+	// every document takes the key, the document and 4 bytes of quotes and
+	// separators
+	size := &potLimiter{limits: Limits{MaxPotSize: 24}}
+	s.NoError(size.add("a", doc))
+	s.NoError(size.add("b", doc))
+	s.ErrorIs(size.add("c", doc), ErrPotTooLarge)
+}
+
+func (s *LimitsSuite) TestRouteStatus() {
+	srv := &Server{limits: Limits{MaxBodySize: 16, MaxBatchKeys: 1}}
+
+	post := func(target, body string) int {
+		r := httptest.NewRequest(http.MethodPost, target, strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+
+		rec := httptest.NewRecorder()
+		srv.routePostFunc(rec, r)
+		return rec.Code
+	}
+
+	s.Equal(http.StatusRequestEntityTooLarge, post("/limits", `{"id":"a","text":"too long"}`))
+	s.Equal(http.StatusUnprocessableEntity, post("/limits?batch", `{"a":{},"b":{}}`))
+}
+
+func TestLimitsSuite(t *testing.T) {
+	suite.Run(t, new(LimitsSuite))
+}
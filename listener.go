@@ -0,0 +1,311 @@
+package pot
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// unixPrefix marks listen addresses of unix domain sockets
+	unixPrefix = "unix:"
+
+	// defaultListen is the address used if no other address is configured
+	defaultListen = ":8080"
+)
+
+// Client authentication modes of TLSConfig.ClientAuth.
+const (
+	ClientAuthRequire  = "require"
+	ClientAuthOptional = "optional"
+)
+
+// TLSConfig configures the TLS of TCP listeners. The certificate and key are
+// read again whenever the files change.
+type TLSConfig struct {
+	CertFile string `json:"certFile" yaml:"certFile" toml:"certFile"`
+	KeyFile  string `json:"keyFile" yaml:"keyFile" toml:"keyFile"`
+
+	// ClientCAFile is the CA bundle verifying client certificates, which are
+	// not requested if empty
+	ClientCAFile string `json:"clientCAFile,omitempty" yaml:"clientCAFile,omitempty" toml:"clientCAFile,omitempty"`
+
+	// ClientAuth is either require, the default, or optional to also accept
+	// clients without a certificate
+	ClientAuth string `json:"clientAuth,omitempty" yaml:"clientAuth,omitempty" toml:"clientAuth,omitempty"`
+}
+
+// CertOptions returns the options of the certificate reloader.
+func (c *TLSConfig) CertOptions() []CertOption {
+	if c.ClientCAFile == "" {
+		return nil
+	}
+
+	return []CertOption{WithClientCA(c.ClientCAFile, c.ClientAuth == ClientAuthOptional)}
+}
+
+// parseListenAddress splits the listen address into its network and address.
+// Unix domain sockets are written as unix:/path/to.sock, everything else is a
+// TCP host:port.
+func parseListenAddress(addr string) (string, string, error) {
+	if path, ok := strings.CutPrefix(addr, unixPrefix); ok {
+		// unix:///path/to.sock is accepted as well
+		path = strings.TrimPrefix(path, "//")
+		if path == "" {
+			return "", "", fmt.Errorf("missing socket path: %s", addr)
+		}
+		return "unix", path, nil
+	}
+
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		return "", "", err
+	}
+
+	return "tcp", addr, nil
+}
+
+// Listen listens on the address, which is either a TCP host:port or a unix
+// domain socket written as unix:/path/to.sock. A socket file left behind by a
+// previous process is removed first.
+func Listen(ctx context.Context, addr string) (net.Listener, error) {
+	network, address, err := parseListenAddress(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	if network == "unix" {
+		if err := removeStaleSocket(address); err != nil {
+			return nil, err
+		}
+	}
+
+	lc := net.ListenConfig{}
+	return lc.Listen(ctx, network, address)
+}
+
+// removeStaleSocket removes the socket file if no process listens on it. Files
+// that are not sockets are never removed.
+func removeStaleSocket(path string) error {
+	info, err := os.Stat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if info.Mode()&fs.ModeSocket == 0 {
+		return fmt.Errorf("%s exists and is not a socket", path)
+	}
+
+	conn, err := net.Dial("unix", path)
+	if err == nil {
+		conn.Close()
+		return fmt.Errorf("%s is in use", path)
+	}
+
+	return os.Remove(path)
+}
+
+// CertReloader serves the TLS certificate loaded from the files and reloads
+// it when the files change, so renewed certificates are picked up without a
+// restart.
+type CertReloader struct {
+	certFile string
+	keyFile  string
+
+	// clientCAFile is the CA bundle verifying client certificates, client
+	// certificates are not requested if empty
+	clientCAFile string
+	clientAuth   tls.ClientAuthType
+
+	mux       sync.RWMutex
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+	modTime   time.Time
+}
+
+// CertOption is a functional option of the CertReloader.
+type CertOption func(*CertReloader)
+
+// WithClientCA requests client certificates and verifies them by the CA
+// bundle, which is reloaded together with the certificate. Clients without a
+// certificate are rejected unless the certificate is optional.
+func WithClientCA(caFile string, optional bool) CertOption {
+	return func(r *CertReloader) {
+		r.clientCAFile = caFile
+		r.clientAuth = tls.RequireAndVerifyClientCert
+		if optional {
+			r.clientAuth = tls.VerifyClientCertIfGiven
+		}
+	}
+}
+
+// NewCertReloader loads the certificate and its key from the files.
+func NewCertReloader(certFile, keyFile string, opts ...CertOption) (*CertReloader, error) {
+	r := &CertReloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// Reload loads the certificate from the files. The previous certificate is
+// kept if the files can't be loaded.
+func (r *CertReloader) Reload() error {
+	modTime, err := r.latestModTime()
+	if err != nil {
+		return err
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+
+	var clientCAs *x509.CertPool
+	if r.clientCAFile != "" {
+		clientCAs, err = loadCertPool(r.clientCAFile)
+		if err != nil {
+			return err
+		}
+	}
+
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	r.cert = &cert
+	r.clientCAs = clientCAs
+	r.modTime = modTime
+	return nil
+}
+
+// loadCertPool reads the PEM encoded CA bundle.
+func loadCertPool(caFile string) (*x509.CertPool, error) {
+	b, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(b) {
+		return nil, fmt.Errorf("no certificates found in %s", caFile)
+	}
+
+	return pool, nil
+}
+
+// GetCertificate returns the current certificate, it is meant to be used as
+// tls.Config.GetCertificate.
+func (r *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mux.RLock()
+	defer r.mux.RUnlock()
+
+	return r.cert, nil
+}
+
+// TLSConfig returns the TLS config serving the reloaded certificate and
+// verifying client certificates by the reloaded CA bundle.
+func (r *CertReloader) TLSConfig() *tls.Config {
+	cfg := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: r.GetCertificate,
+	}
+
+	if r.clientCAFile != "" {
+		cfg.ClientAuth = r.clientAuth
+
+		// the CA bundle can change, so each connection gets the current one
+		cfg.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			r.mux.RLock()
+			defer r.mux.RUnlock()
+
+			// the config replaces the one of the server, so it advertises
+			// HTTP/2 on its own, which gRPC clients require
+			return &tls.Config{
+				MinVersion:     tls.VersionTLS12,
+				GetCertificate: r.GetCertificate,
+				ClientAuth:     r.clientAuth,
+				ClientCAs:      r.clientCAs,
+				NextProtos:     []string{"h2", "http/1.1"},
+			}, nil
+		}
+	}
+
+	return cfg
+}
+
+// Watch checks the files for changes on every interval and reloads the
+// certificate when they change, until the context is done.
+func (r *CertReloader) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		modTime, err := r.latestModTime()
+		if err != nil {
+			slog.Error("failed to check the certificate", slog.String("error", err.Error()))
+			continue
+		}
+
+		r.mux.RLock()
+		changed := modTime.After(r.modTime)
+		r.mux.RUnlock()
+
+		if !changed {
+			continue
+		}
+
+		if err := r.Reload(); err != nil {
+			slog.Error("failed to reload the certificate", slog.String("error", err.Error()))
+			continue
+		}
+
+		slog.Info("certificate reloaded", slog.String("cert", r.certFile))
+	}
+}
+
+// latestModTime returns the latest of the modification times of the files.
+func (r *CertReloader) latestModTime() (time.Time, error) {
+	var latest time.Time
+	names := []string{r.certFile, r.keyFile}
+	if r.clientCAFile != "" {
+		names = append(names, r.clientCAFile)
+	}
+
+	for _, name := range names {
+		info, err := os.Stat(name)
+		if err != nil {
+			return time.Time{}, err
+		}
+
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+
+	return latest, nil
+}
@@ -0,0 +1,133 @@
+package pot
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type ListenerSuite struct {
+	suite.Suite
+}
+
+func (s *ListenerSuite) TestParseListenAddress() {
+	cases := []struct {
+		addr, network, address string
+	}{
+		{":8080", "tcp", ":8080"},
+		{"127.0.0.1:9000", "tcp", "127.0.0.1:9000"},
+		{"unix:/run/pot.sock", "unix", "/run/pot.sock"},
+		{"unix:///run/pot.sock", "unix", "/run/pot.sock"},
+	}
+	for _, c := range cases {
+		network, address, err := parseListenAddress(c.addr)
+		s.Require().NoError(err, c.addr)
+		s.Equal(c.network, network, c.addr)
+		s.Equal(c.address, address, c.addr)
+	}
+
+	for _, addr := range []string{"8080", "unix:", "localhost"} {
+		_, _, err := parseListenAddress(addr)
+		s.Error(err, addr)
+	}
+}
+
+func (s *ListenerSuite) TestListenUnix() {
+	sock := filepath.Join(s.T().TempDir(), "pot.sock")
+
+	// a socket left behind by a crashed process
+	stale, err := net.Listen("unix", sock)
+	s.Require().NoError(err)
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	s.Require().NoError(stale.Close())
+
+	l, err := Listen(context.Background(), "unix:"+sock)
+	s.Require().NoError(err)
+	defer l.Close()
+
+	// the socket is in use now
+	_, err = Listen(context.Background(), "unix:"+sock)
+	s.Error(err)
+
+	// regular files are never removed
+	file := filepath.Join(s.T().TempDir(), "file")
+	s.Require().NoError(os.WriteFile(file, nil, 0o600))
+	_, err = Listen(context.Background(), "unix:"+file)
+	s.Error(err)
+	s.FileExists(file)
+}
+
+// writeCert writes a self-signed certificate for the host name to the files.
+func (s *ListenerSuite) writeCert(certFile, keyFile, host string, modTime time.Time) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	s.Require().NoError(err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: host},
+		DNSNames:     []string{host},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	s.Require().NoError(err)
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	s.Require().NoError(err)
+
+	s.Require().NoError(os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	s.Require().NoError(os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600))
+	s.Require().NoError(os.Chtimes(certFile, modTime, modTime))
+	s.Require().NoError(os.Chtimes(keyFile, modTime, modTime))
+}
+
+func (s *ListenerSuite) commonName(r *CertReloader) string {
+	cert, err := r.GetCertificate(&tls.ClientHelloInfo{})
+	s.Require().NoError(err)
+
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	s.Require().NoError(err)
+	return leaf.Subject.CommonName
+}
+
+func (s *ListenerSuite) TestCertReloader() {
+	dir := s.T().TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	now := time.Now()
+
+	s.writeCert(certFile, keyFile, "old.example.com", now.Add(-time.Minute))
+	r, err := NewCertReloader(certFile, keyFile)
+	s.Require().NoError(err)
+	s.Equal("old.example.com", s.commonName(r))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go r.Watch(ctx, 10*time.Millisecond)
+
+	s.writeCert(certFile, keyFile, "new.example.com", now)
+	s.Eventually(func() bool {
+		return s.commonName(r) == "new.example.com"
+	}, time.Second, 10*time.Millisecond)
+
+	// broken files keep the previous certificate
+	s.Require().NoError(os.WriteFile(keyFile, []byte("broken"), 0o600))
+	s.Error(r.Reload())
+	s.Equal("new.example.com", s.commonName(r))
+}
+
+func TestListenerSuite(t *testing.T) {
+	suite.Run(t, new(ListenerSuite))
+}
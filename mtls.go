@@ -0,0 +1,216 @@
+package pot
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+)
+
+var (
+	ErrInvalidCertificate = errors.New("invalid client certificate")
+)
+
+// AuthMethodMTLS is the authentication method of principals identified by
+// their client certificate.
+const AuthMethodMTLS = "mtls"
+
+// CertMapping maps the identities of client certificates onto principals. The
+// identity is a pattern of literal text, * wildcards and {name} variables,
+// which are used in the name and groups of the principal.
+type CertMapping struct {
+	// Identity is matched against the SPIFFE ID, DNS names, emails and the
+	// common name of the certificate, in this order
+	Identity string `json:"identity" yaml:"identity" toml:"identity"`
+
+	// Name is the name of the principal, the matched identity if empty
+	Name string `json:"name,omitempty" yaml:"name,omitempty" toml:"name,omitempty"`
+
+	// Groups are the groups of the principal
+	Groups []string `json:"groups,omitempty" yaml:"groups,omitempty" toml:"groups,omitempty"`
+}
+
+// MTLSOptions configure how client certificates map onto principals.
+type MTLSOptions struct {
+	// TrustDomains are the accepted SPIFFE trust domains, if set the
+	// certificate must carry a SPIFFE ID of one of them
+	TrustDomains []string
+
+	// Mappings map the certificate identities onto principals, the first
+	// matching mapping is used. Without mappings the principal is named by
+	// the first identity of the certificate.
+	Mappings []CertMapping
+}
+
+// CertAuthenticator authenticates callers by the client certificates verified
+// by the TLS listener.
+type CertAuthenticator struct {
+	trustDomains []string
+	mappings     []*certMapping
+}
+
+type certMapping struct {
+	identity *pattern
+	name     *pattern
+	groups   []*pattern
+}
+
+// NewCertAuthenticator compiles the certificate mappings.
+func NewCertAuthenticator(opts MTLSOptions) (*CertAuthenticator, error) {
+	a := &CertAuthenticator{trustDomains: opts.TrustDomains}
+
+	for _, m := range opts.Mappings {
+		mapping, err := compileCertMapping(m)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidCertificate, err)
+		}
+
+		a.mappings = append(a.mappings, mapping)
+	}
+
+	return a, nil
+}
+
+func compileCertMapping(m CertMapping) (*certMapping, error) {
+	if m.Identity == "" {
+		return nil, errors.New("certificate mapping requires an identity")
+	}
+
+	identity, err := compilePattern(m.Identity)
+	if err != nil {
+		return nil, err
+	}
+	mapping := &certMapping{identity: identity}
+
+	templates := m.Groups
+	if m.Name != "" {
+		templates = append([]string{m.Name}, templates...)
+	}
+
+	for i, t := range templates {
+		p, err := compilePattern(t)
+		if err != nil {
+			return nil, err
+		}
+
+		// the principal can't be named by variables the identity doesn't bind
+		for _, v := range p.vars {
+			if !slices.Contains(identity.vars, v) {
+				return nil, fmt.Errorf("variable %s of %s is not bound by %s", v, t, m.Identity)
+			}
+		}
+
+		if i == 0 && m.Name != "" {
+			mapping.name = p
+			continue
+		}
+		mapping.groups = append(mapping.groups, p)
+	}
+
+	return mapping, nil
+}
+
+// Authenticate identifies the caller by the verified client certificate.
+// Requests without one, e.g. on unix sockets, are left to the other
+// authenticators.
+func (a *CertAuthenticator) Authenticate(r *http.Request) (*Principal, error) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return nil, nil
+	}
+
+	cert := r.TLS.VerifiedChains[0][0]
+	spiffeID := certSPIFFEID(cert)
+
+	if len(a.trustDomains) > 0 {
+		if spiffeID == nil || !slices.Contains(a.trustDomains, spiffeID.Host) {
+			return nil, fmt.Errorf("%w: no SPIFFE ID of a trusted domain", ErrInvalidCertificate)
+		}
+	}
+
+	identities := certIdentities(cert, spiffeID)
+	if len(identities) == 0 {
+		return nil, fmt.Errorf("%w: no identity", ErrInvalidCertificate)
+	}
+
+	p := &Principal{
+		Name:    identities[0],
+		Method:  AuthMethodMTLS,
+		Subject: identities[0],
+		Issuer:  cert.Issuer.String(),
+		Claims:  certClaims(cert, spiffeID),
+	}
+	if len(a.mappings) == 0 {
+		return p, nil
+	}
+
+	for _, m := range a.mappings {
+		for _, identity := range identities {
+			vars, ok := m.identity.match(identity, nil)
+			if !ok {
+				continue
+			}
+
+			p.Name = identity
+			p.Subject = identity
+			if m.name != nil {
+				p.Name = m.name.render(vars)
+			}
+			for _, g := range m.groups {
+				p.Groups = append(p.Groups, g.render(vars))
+			}
+
+			return p, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: %s is not mapped to a principal", ErrInvalidCertificate, identities[0])
+}
+
+// certSPIFFEID returns the SPIFFE ID of the certificate, which is its only
+// URI SAN with the spiffe scheme.
+func certSPIFFEID(cert *x509.Certificate) *url.URL {
+	for _, uri := range cert.URIs {
+		if uri.Scheme == "spiffe" {
+			return uri
+		}
+	}
+
+	return nil
+}
+
+// certIdentities returns the identities of the certificate in the order
+// they are matched.
+func certIdentities(cert *x509.Certificate, spiffeID *url.URL) []string {
+	identities := []string{}
+	if spiffeID != nil {
+		identities = append(identities, spiffeID.String())
+	}
+	identities = append(identities, cert.DNSNames...)
+	identities = append(identities, cert.EmailAddresses...)
+	if cert.Subject.CommonName != "" {
+		identities = append(identities, cert.Subject.CommonName)
+	}
+
+	return identities
+}
+
+// certClaims exposes the identities of the certificate to policies.
+func certClaims(cert *x509.Certificate, spiffeID *url.URL) map[string]any {
+	claims := map[string]any{
+		"cn":     cert.Subject.CommonName,
+		"serial": cert.SerialNumber.String(),
+	}
+	if spiffeID != nil {
+		claims["spiffe"] = spiffeID.String()
+	}
+	if len(cert.DNSNames) > 0 {
+		claims["dns"] = cert.DNSNames
+	}
+	if len(cert.EmailAddresses) > 0 {
+		claims["email"] = cert.EmailAddresses
+	}
+
+	return claims
+}
@@ -0,0 +1,208 @@
+package pot
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type MTLSSuite struct {
+	suite.Suite
+
+	ca    *x509.Certificate
+	caKey *ecdsa.PrivateKey
+}
+
+func (s *MTLSSuite) SetupTest() {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	s.Require().NoError(err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "pot test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	s.Require().NoError(err)
+
+	s.ca, err = x509.ParseCertificate(der)
+	s.Require().NoError(err)
+	s.caKey = key
+}
+
+// issue creates a certificate signed by the test CA.
+func (s *MTLSSuite) issue(tmpl *x509.Certificate) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	s.Require().NoError(err)
+
+	tmpl.SerialNumber = big.NewInt(time.Now().UnixNano())
+	tmpl.NotBefore = time.Now().Add(-time.Hour)
+	tmpl.NotAfter = time.Now().Add(time.Hour)
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, s.ca, &key.PublicKey, s.caKey)
+	s.Require().NoError(err)
+
+	leaf, err := x509.ParseCertificate(der)
+	s.Require().NoError(err)
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
+func (s *MTLSSuite) clientCert(cn string, uris ...string) tls.Certificate {
+	tmpl := &x509.Certificate{
+		Subject:     pkix.Name{CommonName: cn},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	for _, raw := range uris {
+		u, err := url.Parse(raw)
+		s.Require().NoError(err)
+		tmpl.URIs = append(tmpl.URIs, u)
+	}
+
+	return s.issue(tmpl)
+}
+
+// verified returns the request as if the certificate was verified by the
+// listener.
+func (s *MTLSSuite) verified(cert tls.Certificate) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert.Leaf, s.ca}}}
+	return r
+}
+
+func (s *MTLSSuite) TestAuthenticate() {
+	a, err := NewCertAuthenticator(MTLSOptions{
+		TrustDomains: []string{"example.org"},
+		Mappings: []CertMapping{
+			{Identity: "spiffe://example.org/ns/{ns}/sa/{sa}", Name: "{sa}", Groups: []string{"{ns}", "services"}},
+			{Identity: "spiffe://example.org/admin", Name: "admin"},
+		},
+	})
+	s.Require().NoError(err)
+
+	cases := []struct {
+		caseName string
+		cert     tls.Certificate
+		err      bool
+		name     string
+		groups   []string
+	}{
+		{"service", s.clientCert("a", "spiffe://example.org/ns/billing/sa/invoices"), false, "invoices", []string{"billing", "services"}},
+		{"admin", s.clientCert("a", "spiffe://example.org/admin"), false, "admin", nil},
+		{"untrusted domain", s.clientCert("a", "spiffe://evil.org/ns/billing/sa/invoices"), true, "", nil},
+		{"no spiffe id", s.clientCert("invoices"), true, "", nil},
+		{"unmapped", s.clientCert("a", "spiffe://example.org/other"), true, "", nil},
+	}
+
+	for _, c := range cases {
+		s.Run(c.caseName, func() {
+			p, err := a.Authenticate(s.verified(c.cert))
+			if c.err {
+				s.ErrorIs(err, ErrInvalidCertificate)
+				return
+			}
+
+			s.NoError(err)
+			s.Equal(c.name, p.Name)
+			s.Equal(AuthMethodMTLS, p.Method)
+			s.Equal(c.groups, p.Groups)
+			s.Equal(c.cert.Leaf.URIs[0].String(), p.Claims["spiffe"])
+		})
+	}
+
+	// requests without a verified certificate are left to other authenticators
+	p, err := a.Authenticate(httptest.NewRequest(http.MethodGet, "/", nil))
+	s.NoError(err)
+	s.Nil(p)
+}
+
+func (s *MTLSSuite) TestDefaultIdentity() {
+	a, err := NewCertAuthenticator(MTLSOptions{})
+	s.Require().NoError(err)
+
+	p, err := a.Authenticate(s.verified(s.clientCert("worker")))
+	s.NoError(err)
+	s.Equal("worker", p.Name)
+	s.Equal("CN=pot test ca", p.Issuer)
+}
+
+func (s *MTLSSuite) TestInvalidMappings() {
+	_, err := NewCertAuthenticator(MTLSOptions{Mappings: []CertMapping{{Identity: "spiffe://example.org/{sa}", Name: "{team}"}}})
+	s.ErrorIs(err, ErrInvalidCertificate)
+
+	_, err = NewCertAuthenticator(MTLSOptions{Mappings: []CertMapping{{Name: "admin"}}})
+	s.ErrorIs(err, ErrInvalidCertificate)
+}
+
+func (s *MTLSSuite) TestMutualTLS() {
+	dir := s.T().TempDir()
+	certFile, keyFile, caFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key"), filepath.Join(dir, "ca.crt")
+
+	server := s.issue(&x509.Certificate{
+		Subject:     pkix.Name{CommonName: "pot"},
+		IPAddresses: []net.IP{net.IPv4(127, 0, 0, 1)},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	})
+	keyDER, err := x509.MarshalECPrivateKey(server.PrivateKey.(*ecdsa.PrivateKey))
+	s.Require().NoError(err)
+	s.Require().NoError(os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate[0]}), 0o600))
+	s.Require().NoError(os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600))
+	s.Require().NoError(os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: s.ca.Raw}), 0o600))
+
+	certs, err := NewCertReloader(certFile, keyFile, WithClientCA(caFile, false))
+	s.Require().NoError(err)
+
+	a, err := NewCertAuthenticator(MTLSOptions{})
+	s.Require().NoError(err)
+	srv := &Server{authenticators: []Authenticator{a}}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	s.Require().NoError(err)
+	hs := &http.Server{Handler: srv.authenticate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, _ := PrincipalFromContext(r.Context())
+		w.Write([]byte(p.Name))
+	}))}
+	go hs.Serve(tls.NewListener(l, certs.TLSConfig()))
+	defer hs.Shutdown(context.Background())
+
+	roots := x509.NewCertPool()
+	roots.AddCert(s.ca)
+	baseURL := "https://" + l.Addr().String() + "/"
+
+	client := NewClient[*testStruct](baseURL,
+		WithTLSConfig(&tls.Config{RootCAs: roots}),
+		WithClientCertificate(s.clientCert("worker")),
+	)
+	res, err := client.client.Get(baseURL)
+	s.Require().NoError(err)
+	defer res.Body.Close()
+	s.Equal(http.StatusOK, res.StatusCode)
+
+	// clients without a certificate fail the handshake
+	client = NewClient[*testStruct](baseURL, WithTLSConfig(&tls.Config{RootCAs: roots}))
+	_, err = client.client.Get(baseURL)
+	s.Error(err)
+}
+
+func TestMTLSSuite(t *testing.T) {
+	suite.Run(t, new(MTLSSuite))
+}
@@ -0,0 +1,51 @@
+package pot
+
+import (
+	"bytes"
+	_ "embed"
+	"net/http"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// openAPIDocument is the OpenAPI 3 document describing the HTTP routes. It is
+// kept next to the routes, so changes of the routes update it in the same
+// commit.
+//
+//go:embed openapi.yaml
+var openAPIDocument []byte
+
+// openAPISpec returns the decoded OpenAPI document, which is decoded once.
+var openAPISpec = sync.OnceValues(func() (map[string]any, error) {
+	spec := map[string]any{}
+	if err := yaml.NewDecoder(bytes.NewReader(openAPIDocument)).Decode(&spec); err != nil {
+		return nil, err
+	}
+
+	return spec, nil
+})
+
+func (s *Server) routeOpenAPIFunc(w http.ResponseWriter, r *http.Request) {
+	codec, err := negotiateCodec(r.Header.Get("Accept"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotAcceptable)
+		return
+	}
+
+	// the YAML document is served as written, which keeps its order and
+	// descriptions readable
+	if codec == CodecYAML {
+		w.Header().Set("Content-Type", codec.ContentType())
+		w.Write(openAPIDocument)
+		return
+	}
+
+	spec, err := openAPISpec()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeContent(w, codec, http.StatusOK, spec)
+}
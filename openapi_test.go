@@ -0,0 +1,228 @@
+package pot
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/suite"
+)
+
+type OpenAPISuite struct {
+	suite.Suite
+
+	paths map[string]any
+}
+
+func (s *OpenAPISuite) SetupSuite() {
+	spec, err := openAPISpec()
+	s.Require().NoError(err)
+
+	s.paths = spec["paths"].(map[string]any)
+}
+
+// operation returns the operation of the spec path and the parameters of both
+// the path and the operation.
+func (s *OpenAPISuite) operation(specPath, method string) (map[string]any, []any) {
+	item, ok := s.paths[specPath].(map[string]any)
+	s.Require().True(ok, "%s is not documented", specPath)
+
+	op, ok := item[strings.ToLower(method)].(map[string]any)
+	s.Require().True(ok, "%s %s is not documented", method, specPath)
+
+	params, _ := item["parameters"].([]any)
+	opParams, _ := op["parameters"].([]any)
+	return op, append(params, opParams...)
+}
+
+// specTarget fills the parameters of the spec path by example values.
+func specTarget(specPath string) string {
+	return strings.NewReplacer("{path}", "teams/red", "{key}", "task-1", "{name}", "by-owner").Replace(specPath)
+}
+
+func (s *OpenAPISuite) TestServed() {
+	srv := &Server{}
+
+	rec := httptest.NewRecorder()
+	srv.Routes().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/:openapi", nil))
+	s.Equal(http.StatusOK, rec.Code)
+	s.Equal("application/json", rec.Header().Get("Content-Type"))
+
+	spec := map[string]any{}
+	s.Require().NoError(json.NewDecoder(rec.Body).Decode(&spec))
+	s.Equal("3.1.0", spec["openapi"])
+	s.Contains(spec["paths"], "/{path}")
+
+	r := httptest.NewRequest(http.MethodGet, "/:openapi", nil)
+	r.Header.Set("Accept", "application/yaml")
+	rec = httptest.NewRecorder()
+	srv.Routes().ServeHTTP(rec, r)
+	s.Equal(http.StatusOK, rec.Code)
+	s.Equal(openAPIDocument, rec.Body.Bytes())
+}
+
+// TestOperationsRouted asserts that every documented operation is served by
+// a route of the server.
+func (s *OpenAPISuite) TestOperationsRouted() {
+	router := (&Server{}).Routes().(*mux.Router)
+
+	for specPath, item := range s.paths {
+		for method, op := range item.(map[string]any) {
+			if method == "parameters" {
+				continue
+			}
+
+			s.Run(method+" "+specPath, func() {
+				s.NotEmpty(op.(map[string]any)["operationId"])
+				s.NotEmpty(op.(map[string]any)["responses"])
+
+				match := &mux.RouteMatch{}
+				r := httptest.NewRequest(strings.ToUpper(method), specTarget(specPath), nil)
+				s.True(router.Match(r, match), "no route serves %s %s", method, specPath)
+			})
+		}
+	}
+}
+
+// TestRoutesDocumented asserts that every route of the server is documented.
+// The prefix routes are documented as the operations on pot paths.
+func (s *OpenAPISuite) TestRoutesDocumented() {
+	router := (&Server{}).Routes().(*mux.Router)
+
+	err := router.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		tpl, err := route.GetPathTemplate()
+		if err != nil {
+			return err
+		}
+		if tpl == "/" {
+			tpl = "/{path}"
+		}
+
+		methods, err := route.GetMethods()
+		if err != nil {
+			return err
+		}
+
+		for _, method := range methods {
+			s.operation(tpl, method)
+		}
+
+		return nil
+	})
+	s.NoError(err)
+}
+
+// TestStatusesDocumented asserts that the statuses and query parameters of
+// the requests served by the handlers are documented by their operations.
+// Only the requests answered before the bucket is accessed are served.
+func (s *OpenAPISuite) TestStatusesDocumented() {
+	keys, err := NewAPIKeys(APIKey{Name: "alice", Hash: HashAPIKey("secret")})
+	s.Require().NoError(err)
+
+	acl, err := NewACL(ACLRule{Path: "public/**", Principals: []string{"*"}, Permissions: []Permission{PermissionRead}})
+	s.Require().NoError(err)
+
+	limiter, err := NewRateLimiter(RateLimitRule{Rate: 0.001, Burst: 1})
+	s.Require().NoError(err)
+
+	sink, err := NewFileAuditSink(filepath.Join(s.T().TempDir(), "audit.log"))
+	s.Require().NoError(err)
+	defer sink.Close()
+
+	plain := func() *Server { return &Server{} }
+	cases := []struct {
+		caseName string
+		server   func() *Server
+		method   string
+		target   string
+		header   map[string]string
+		body     string
+		specPath string
+		status   int
+	}{
+		{"health", plain, http.MethodGet, "/:healthz", nil, "", "/:healthz", http.StatusOK},
+		{"health head", plain, http.MethodHead, "/:healthz", nil, "", "/:healthz", http.StatusOK},
+		{"openapi not acceptable", plain, http.MethodGet, "/:openapi", map[string]string{"Accept": "text/html"}, "", "/:openapi", http.StatusNotAcceptable},
+		{"get reserved path", plain, http.MethodGet, "/:unknown", nil, "", "/{path}", http.StatusBadRequest},
+		{"get not acceptable", plain, http.MethodGet, "/teams/red", map[string]string{"Accept": "text/html"}, "", "/{path}", http.StatusNotAcceptable},
+		{"list not acceptable", plain, http.MethodGet, "/teams:list", map[string]string{"Accept": "text/html"}, "", "/{path}:list", http.StatusNotAcceptable},
+		{"export reserved path", plain, http.MethodGet, "/:unknown:export", nil, "", "/{path}:export", http.StatusBadRequest},
+		{"audit invalid limit", func() *Server { return &Server{audit: sink} }, http.MethodGet, "/teams:audit?limit=0", nil, "", "/{path}:audit", http.StatusBadRequest},
+		{"audit without trail", func() *Server { return &Server{audit: NewWriterAuditSink(&bytes.Buffer{})} }, http.MethodGet, "/teams:audit?limit=5", nil, "", "/{path}:audit", http.StatusNotImplemented},
+		{"index without value", plain, http.MethodGet, "/:index/by-owner", nil, "", "/:index/{name}", http.StatusBadRequest},
+		{"unknown index", plain, http.MethodGet, "/:index/by-owner?value=alice", nil, "", "/:index/{name}", http.StatusNotFound},
+		{"rebuild unknown index", plain, http.MethodPost, "/:index/by-owner", nil, "", "/:index/{name}", http.StatusNotFound},
+		{"permissions without acl", plain, http.MethodGet, "/:admin/permissions?principal=alice&group=red", nil, "", "/:admin/permissions", http.StatusNotFound},
+		{"restore invalid snapshot", plain, http.MethodPost, "/:snapshot?dryrun", nil, "not a snapshot", "/:snapshot", http.StatusBadRequest},
+		{"create not acceptable", plain, http.MethodPost, "/teams/red?norewrite=10s&generation=1", map[string]string{"Accept": "text/html"}, "{}", "/{path}", http.StatusNotAcceptable},
+		{"create key not a string", plain, http.MethodPost, "/teams/red", nil, `{"id":5}`, "/{path}", http.StatusBadRequest},
+		{"create too large", func() *Server { return &Server{limits: Limits{MaxBodySize: 8}} }, http.MethodPost, "/teams/red", nil, `{"id":"task-1"}`, "/{path}", http.StatusRequestEntityTooLarge},
+		{"create too many keys", func() *Server { return &Server{limits: Limits{MaxBatchKeys: 1}} }, http.MethodPost, "/teams/red?batch", nil, `{"a":{},"b":{}}`, "/{path}", http.StatusUnprocessableEntity},
+		{"create form as json", func() *Server { return &Server{limits: Limits{MaxBatchKeys: 1}} }, http.MethodPost, "/teams/red?batch", map[string]string{"Content-Type": "application/x-www-form-urlencoded"}, `{"a":{},"b":{}}`, "/{path}", http.StatusUnprocessableEntity},
+		{"increment without field", plain, http.MethodPost, "/teams/red/task-1:increment?by=2&min=0&max=10", nil, "", "/{path}/{key}:increment", http.StatusBadRequest},
+		{"increment by infinity", plain, http.MethodPost, "/teams/red/task-1:increment?field=count&by=Inf", nil, "", "/{path}/{key}:increment", http.StatusBadRequest},
+		{"increment with nan", plain, http.MethodPost, "/teams/red/task-1:increment?field=count&max=NaN", nil, "", "/{path}/{key}:increment", http.StatusBadRequest},
+		{"import invalid conflict", plain, http.MethodPost, "/teams:import?conflict=merge", nil, "", "/{path}:import", http.StatusBadRequest},
+		{"import invalid record", plain, http.MethodPost, "/teams:import", nil, "not a record\n", "/{path}:import", http.StatusBadRequest},
+		{"delete reserved path", plain, http.MethodDelete, "/:unknown?key=a", nil, "", "/{path}", http.StatusBadRequest},
+		{"unauthenticated", func() *Server { return &Server{authenticators: []Authenticator{keys}} }, http.MethodGet, "/teams/red", nil, "", "/{path}", http.StatusUnauthorized},
+		{"unauthenticated openapi", func() *Server { return &Server{authenticators: []Authenticator{keys}} }, http.MethodGet, "/:openapi", nil, "", "/:openapi", http.StatusUnauthorized},
+		{"forbidden", func() *Server {
+			srv := &Server{}
+			srv.acl.Store(acl)
+			return srv
+		}, http.MethodDelete, "/public/red", nil, "", "/{path}", http.StatusForbidden},
+		{"rate limited", func() *Server {
+			srv := &Server{}
+			srv.rateLimiter.Store(limiter)
+			return srv
+		}, http.MethodGet, "/teams:list", map[string]string{"Accept": "text/html"}, "", "/{path}:list", http.StatusTooManyRequests},
+	}
+
+	for _, c := range cases {
+		s.Run(c.caseName, func() {
+			op, params := s.operation(c.specPath, c.method)
+
+			target, err := url.Parse(c.target)
+			s.Require().NoError(err)
+			for name := range target.Query() {
+				s.True(slices.ContainsFunc(params, func(p any) bool {
+					return p.(map[string]any)["name"] == name && p.(map[string]any)["in"] == "query"
+				}), "query parameter %s of %s %s is not documented", name, c.method, c.specPath)
+			}
+
+			handler := c.server().Routes()
+			serve := func() int {
+				r := httptest.NewRequest(c.method, c.target, strings.NewReader(c.body))
+				for k, v := range c.header {
+					r.Header.Set(k, v)
+				}
+
+				rec := httptest.NewRecorder()
+				handler.ServeHTTP(rec, r)
+				return rec.Code
+			}
+
+			status := serve()
+			if c.status == http.StatusTooManyRequests {
+				// the first request takes the burst
+				status = serve()
+			}
+
+			s.Equal(c.status, status)
+			s.Contains(op["responses"], strconv.Itoa(status), "status %d of %s %s is not documented", status, c.method, c.specPath)
+		})
+	}
+}
+
+func TestOpenAPISuite(t *testing.T) {
+	suite.Run(t, new(OpenAPISuite))
+}
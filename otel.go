@@ -94,5 +94,8 @@ func BootstrapOTEL(ctx context.Context) (func(context.Context) error, error) {
 	// set global propagator
 	otel.SetTextMapPropagator(propagator)
 
+	// collect exporter errors for the readiness check
+	otel.SetErrorHandler(otelErrors)
+
 	return meterProvider.Shutdown, nil
 }
@@ -0,0 +1,338 @@
+package pot
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/open-policy-agent/opa/rego"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+var (
+	ErrInvalidPolicy = errors.New("invalid policy")
+)
+
+const (
+	// defaultPolicyQuery is the rule deciding whether the request is allowed
+	defaultPolicyQuery = "data.pot.allow"
+
+	// policyMaxBody is the largest body of writes evaluated by the policy,
+	// larger writes are rejected
+	policyMaxBody = 1 << 20
+)
+
+// Policy decisions, as recorded in logs and metrics.
+const (
+	PolicyAllow = "allow"
+	PolicyDeny  = "deny"
+	PolicyError = "error"
+)
+
+// Policy authorizes requests by evaluating a Rego policy. The query must
+// evaluate to true for the request to be allowed, undefined results deny it.
+type Policy struct {
+	query rego.PreparedEvalQuery
+}
+
+// PolicyInput is the input document of the policy.
+type PolicyInput struct {
+	// Method is the HTTP method of the request
+	Method string `json:"method"`
+
+	// Path is the pot path of the request, without the leading slash and the
+	// :list, :export, :import or :increment suffixes
+	Path string `json:"path"`
+
+	// Permission is the permission the request requires on the path, empty
+	// for the reserved routes that are not checked on a path
+	Permission Permission `json:"permission,omitempty"`
+
+	// Keys are the keys of the documents the request writes or removes
+	Keys []string `json:"keys,omitempty"`
+
+	// Principal is the authenticated caller, nil for anonymous requests
+	Principal *Principal `json:"principal"`
+
+	// Body is the decoded body of writes
+	Body any `json:"body,omitempty"`
+}
+
+// NewPolicy compiles the Rego modules, keyed by their file names. The query is
+// data.pot.allow if empty.
+func NewPolicy(ctx context.Context, query string, modules map[string]string) (*Policy, error) {
+	if query == "" {
+		query = defaultPolicyQuery
+	}
+
+	opts := []func(*rego.Rego){rego.Query(query)}
+	for name, module := range modules {
+		opts = append(opts, rego.Module(name, module))
+	}
+
+	prepared, err := rego.New(opts...).PrepareForEval(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidPolicy, err)
+	}
+
+	return &Policy{query: prepared}, nil
+}
+
+// LoadPolicyFile compiles the Rego policy from the file.
+func LoadPolicyFile(ctx context.Context, query, name string) (*Policy, error) {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewPolicy(ctx, query, map[string]string{name: string(b)})
+}
+
+// Allowed evaluates the policy for the input.
+func (p *Policy) Allowed(ctx context.Context, input *PolicyInput) (bool, error) {
+	rs, err := p.query.Eval(ctx, rego.EvalInput(input))
+	if err != nil {
+		return false, err
+	}
+
+	if len(rs) == 0 || len(rs[0].Expressions) == 0 {
+		return false, nil
+	}
+
+	allowed, ok := rs[0].Expressions[0].Value.(bool)
+	if !ok {
+		return false, fmt.Errorf("%w: query returned %T instead of a boolean", ErrInvalidPolicy, rs[0].Expressions[0].Value)
+	}
+
+	return allowed, nil
+}
+
+// WithPolicy authorizes every request by the Rego policy, after the
+// authenticators and the ACL.
+func WithPolicy(policy *Policy) Option {
+	return func(c *Server) {
+		c.policy.Store(policy)
+	}
+}
+
+// loadPolicyObject compiles the Rego policy stored in the bucket object.
+func (s *Server) loadPolicyObject(ctx context.Context, query, object string) (*Policy, error) {
+	reader, err := s.bucket.Object(object).NewReader(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read policy from %s: %w", object, err)
+	}
+	defer reader.Close()
+
+	b, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewPolicy(ctx, query, map[string]string{object: string(b)})
+}
+
+// policyInput builds the policy input of the request. The body of writes is
+// read and replaced, so the handlers can read it again. The input is returned
+// with the error if the body of a write can't be evaluated.
+func policyInput(r *http.Request) (*PolicyInput, error) {
+	relPath := strings.TrimPrefix(r.URL.Path, "/")
+
+	input := &PolicyInput{
+		Method: r.Method,
+		Path:   relPath,
+	}
+	if p, ok := PrincipalFromContext(r.Context()); ok {
+		input.Principal = p
+	}
+
+	perm, dir, ok := requestPermission(r)
+	if ok {
+		input.Path = dir
+		input.Permission = perm
+	}
+
+	switch {
+	case r.Method == http.MethodDelete:
+		input.Keys = r.URL.Query()["key"]
+	case r.Method == http.MethodPost && strings.HasSuffix(relPath, ":increment"):
+		_, key := path.Split(strings.TrimSuffix(relPath, ":increment"))
+		input.Keys = []string{key}
+	case r.Method == http.MethodPost && ok && perm == PermissionWrite:
+		body, keys, err := writeBody(r)
+		if err != nil {
+			return input, err
+		}
+
+		input.Body = body
+		input.Keys = keys
+	}
+
+	return input, nil
+}
+
+// writeBody decodes the body of the write and returns it with the keys of the
+// written documents. Bodies that are too large or can't be decoded fail, so
+// the policy never decides without seeing the written documents.
+func writeBody(r *http.Request) (any, []string, error) {
+	b, err := io.ReadAll(io.LimitReader(r.Body, policyMaxBody+1))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// the handler reads the whole body, including the part that wasn't read
+	r.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(b), r.Body), r.Body}
+
+	if len(b) > policyMaxBody {
+		return nil, nil, fmt.Errorf("%w: policies evaluate writes up to %d bytes", ErrBodyTooLarge, policyMaxBody)
+	}
+
+	body := map[string]any{}
+	if err := codecForContentType(r.Header.Get("Content-Type")).Decode(bytes.NewReader(b), &body); err != nil {
+		return nil, nil, fmt.Errorf("%w: %w", ErrInvalidDocument, err)
+	}
+
+	if r.URL.Query().Has("batch") {
+		return body, sortedKeys(body), nil
+	}
+
+	// single documents are keyed the same way as by Create
+	key, err := documentKey(body)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return body, []string{key}, nil
+}
+
+// evaluatePolicy is the middleware rejecting requests denied by the policy.
+func (s *Server) evaluatePolicy(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		policy := s.policy.Load()
+		if policy == nil || r.URL.Path == "/:healthz" || r.URL.Path == "/:readyz" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// imports are evaluated per record by Import, as writes of the records
+		if r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, ":import") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		input, err := policyInput(r)
+		if err != nil {
+			// writes the policy can't see are denied
+			s.recordDecision(r.Context(), input, PolicyDeny, 0, nil)
+			if status, ok := limitStatus(err); ok {
+				http.Error(w, err.Error(), status)
+			} else if errors.Is(err, ErrInvalidDocument) {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+			} else {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+			}
+			return
+		}
+
+		switch s.decide(r.Context(), policy, input) {
+		case PolicyError:
+			// the policy fails closed
+			http.Error(w, "failed to evaluate policy", http.StatusInternalServerError)
+		case PolicyDeny:
+			http.Error(w, fmt.Sprintf("%s: denied by policy", ErrForbidden), http.StatusForbidden)
+		default:
+			next.ServeHTTP(w, r)
+		}
+	})
+}
+
+// allowedRecord evaluates the policy on the imported record, as on a write
+// of the single document to its pot.
+func (s *Server) allowedRecord(ctx context.Context, dir string, rec *Record) error {
+	policy := s.policy.Load()
+	if policy == nil {
+		return nil
+	}
+
+	body := map[string]any{}
+	if err := json.Unmarshal(rec.Value, &body); err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidRecord, err)
+	}
+
+	input := &PolicyInput{
+		Method:     http.MethodPost,
+		Path:       dir,
+		Permission: PermissionWrite,
+		Keys:       []string{rec.Key},
+		Body:       body,
+	}
+	if p, ok := PrincipalFromContext(ctx); ok {
+		input.Principal = p
+	}
+
+	switch s.decide(ctx, policy, input) {
+	case PolicyError:
+		return errors.New("failed to evaluate policy")
+	case PolicyDeny:
+		return fmt.Errorf("%w: %s of /%s denied by policy", ErrForbidden, rec.Key, dir)
+	}
+
+	return nil
+}
+
+// decide evaluates the policy on the input and records the decision.
+func (s *Server) decide(ctx context.Context, policy *Policy, input *PolicyInput) string {
+	start := time.Now()
+	allowed, err := policy.Allowed(ctx, input)
+
+	decision := PolicyDeny
+	switch {
+	case err != nil:
+		decision = PolicyError
+	case allowed:
+		decision = PolicyAllow
+	}
+	s.recordDecision(ctx, input, decision, time.Since(start), err)
+
+	return decision
+}
+
+// recordDecision logs the decision and records it in the metrics.
+func (s *Server) recordDecision(ctx context.Context, input *PolicyInput, decision string, duration time.Duration, err error) {
+	attrs := []any{
+		slog.String("decision", decision),
+		slog.Duration("duration", duration),
+	}
+	if input != nil {
+		attrs = append(attrs, slog.String("method", input.Method), slog.String("path", input.Path))
+		if input.Principal != nil {
+			attrs = append(attrs, slog.String("principal", input.Principal.Name))
+		}
+	}
+
+	switch decision {
+	case PolicyError:
+		slog.Error("policy decision", append(attrs, slog.String("error", err.Error()))...)
+	case PolicyDeny:
+		slog.Info("policy decision", attrs...)
+	default:
+		slog.Debug("policy decision", attrs...)
+	}
+
+	if s.MetricsOptions.Enabled {
+		s.MetricsOptions.PotPolicyDecisions.Add(ctx, 1, metric.WithAttributes(attribute.String("decision", decision)))
+		s.MetricsOptions.PotPolicyDuration.Record(ctx, float64(duration.Microseconds())/1000, metric.WithAttributes(attribute.String("decision", decision)))
+	}
+}
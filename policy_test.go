@@ -0,0 +1,181 @@
+package pot
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+const testPolicy = `package pot
+
+default allow := false
+
+# everyone can read
+allow {
+	input.method == "GET"
+}
+
+# writers can write documents they own
+allow {
+	input.permission == "write"
+	input.principal.groups[_] == "writers"
+	input.body.owner == input.principal.name
+}
+
+# only the admin removes documents, and never the root document
+allow {
+	input.method == "DELETE"
+	input.principal.name == "admin"
+	not deletes_root
+}
+
+deletes_root {
+	input.keys[_] == "root"
+}
+`
+
+type PolicySuite struct {
+	suite.Suite
+
+	policy *Policy
+}
+
+func (s *PolicySuite) SetupTest() {
+	policy, err := NewPolicy(context.Background(), "", map[string]string{"pot.rego": testPolicy})
+	s.Require().NoError(err)
+
+	s.policy = policy
+}
+
+func (s *PolicySuite) TestMiddleware() {
+	srv := &Server{}
+	srv.policy.Store(s.policy)
+
+	var body string
+	handler := srv.evaluatePolicy(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		body = string(b)
+	}))
+
+	writer := &Principal{Name: "alice", Groups: []string{"writers"}}
+	admin := &Principal{Name: "admin"}
+
+	cases := []struct {
+		caseName  string
+		principal *Principal
+		method    string
+		target    string
+		body      string
+		status    int
+	}{
+		{"anonymous read", nil, http.MethodGet, "/pots", "", http.StatusOK},
+		{"owned write", writer, http.MethodPost, "/pots", `{"id":"a","owner":"alice"}`, http.StatusOK},
+		{"foreign write", writer, http.MethodPost, "/pots", `{"id":"a","owner":"bob"}`, http.StatusForbidden},
+		{"anonymous write", nil, http.MethodPost, "/pots", `{"id":"a","owner":"alice"}`, http.StatusForbidden},
+		{"admin delete", admin, http.MethodDelete, "/pots?key=a", "", http.StatusOK},
+		{"admin delete root", admin, http.MethodDelete, "/pots?key=a&key=root", "", http.StatusForbidden},
+		{"writer delete", writer, http.MethodDelete, "/pots?key=a", "", http.StatusForbidden},
+		{"padded write", writer, http.MethodPost, "/pots", `{"id":"a","owner":"bob","pad":"` + strings.Repeat("x", policyMaxBody) + `"}`, http.StatusRequestEntityTooLarge},
+		{"undecodable write", writer, http.MethodPost, "/pots", `{"id":"a","owner":"bob"`, http.StatusBadRequest},
+		{"key not a string", writer, http.MethodPost, "/pots", `{"id":5,"owner":"alice"}`, http.StatusBadRequest},
+		{"import", writer, http.MethodPost, "/pots:import", `{"key":"a","value":{"owner":"bob"}}`, http.StatusOK},
+		{"health", nil, http.MethodPost, "/:healthz", "", http.StatusOK},
+	}
+
+	for _, c := range cases {
+		s.Run(c.caseName, func() {
+			body = ""
+
+			r := httptest.NewRequest(c.method, c.target, strings.NewReader(c.body))
+			if c.principal != nil {
+				r = r.WithContext(ContextWithPrincipal(r.Context(), c.principal))
+			}
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, r)
+
+			s.Equal(c.status, rec.Code)
+			if c.status == http.StatusOK {
+				// the body is passed on to the handler untouched
+				s.Equal(c.body, body)
+			}
+		})
+	}
+}
+
+func (s *PolicySuite) TestPolicyInput() {
+	cases := []struct {
+		caseName string
+		method   string
+		target   string
+		body     string
+		expected *PolicyInput
+	}{
+		{"read", http.MethodGet, "/a/b", "", &PolicyInput{Method: "GET", Path: "a/b", Permission: PermissionRead}},
+		{"list", http.MethodGet, "/a:list", "", &PolicyInput{Method: "GET", Path: "a", Permission: PermissionList}},
+		{"write", http.MethodPost, "/a", `{"name":"x"}`, &PolicyInput{Method: "POST", Path: "a", Permission: PermissionWrite, Keys: []string{"x"}, Body: map[string]any{"name": "x"}}},
+		{"batch", http.MethodPost, "/a?batch", `{"y":{},"x":{}}`, &PolicyInput{Method: "POST", Path: "a", Permission: PermissionWrite, Keys: []string{"x", "y"}, Body: map[string]any{"x": map[string]any{}, "y": map[string]any{}}}},
+		{"increment", http.MethodPost, "/a/x:increment?field=n", "", &PolicyInput{Method: "POST", Path: "a", Permission: PermissionWrite, Keys: []string{"x"}}},
+		{"delete", http.MethodDelete, "/a?key=x", "", &PolicyInput{Method: "DELETE", Path: "a", Permission: PermissionDelete, Keys: []string{"x"}}},
+		{"snapshot", http.MethodGet, "/:snapshot", "", &PolicyInput{Method: "GET", Path: "", Permission: PermissionAdmin}},
+		{"permissions", http.MethodGet, "/:admin/permissions", "", &PolicyInput{Method: "GET", Path: ":admin/permissions"}},
+	}
+
+	for _, c := range cases {
+		s.Run(c.caseName, func() {
+			input, err := policyInput(httptest.NewRequest(c.method, c.target, strings.NewReader(c.body)))
+			s.NoError(err)
+			s.Equal(c.expected, input)
+		})
+	}
+}
+
+func (s *PolicySuite) TestImport() {
+	srv := &Server{}
+	srv.policy.Store(s.policy)
+	ctx := ContextWithPrincipal(context.Background(), &Principal{Name: "alice", Groups: []string{"writers"}})
+
+	// the records are evaluated before any of them is written
+	records := `{"path":"red","key":"a","value":{"owner":"alice"}}
+{"path":"blue","key":"b","value":{"owner":"bob"}}
+`
+	_, err := srv.Import(ctx, "teams", strings.NewReader(records), ConflictOverwrite)
+	s.ErrorIs(err, ErrForbidden)
+	s.ErrorContains(err, "line 2")
+	s.ErrorContains(err, "/teams/blue")
+}
+
+func (s *PolicySuite) TestInvalidPolicy() {
+	_, err := NewPolicy(context.Background(), "", map[string]string{"pot.rego": "package pot\n\nallow {"})
+	s.ErrorIs(err, ErrInvalidPolicy)
+
+	// the query must evaluate to a boolean
+	policy, err := NewPolicy(context.Background(), "data.pot.name", map[string]string{"pot.rego": "package pot\n\nname := \"pot\""})
+	s.NoError(err)
+
+	_, err = policy.Allowed(context.Background(), &PolicyInput{})
+	s.ErrorIs(err, ErrInvalidPolicy)
+}
+
+func (s *PolicySuite) TestLoadPolicyFile() {
+	file := filepath.Join(s.T().TempDir(), "pot.rego")
+	s.NoError(os.WriteFile(file, []byte(testPolicy), 0o600))
+
+	policy, err := LoadPolicyFile(context.Background(), "", file)
+	s.NoError(err)
+
+	allowed, err := policy.Allowed(context.Background(), &PolicyInput{Method: http.MethodGet})
+	s.NoError(err)
+	s.True(allowed)
+}
+
+func TestPolicySuite(t *testing.T) {
+	suite.Run(t, new(PolicySuite))
+}
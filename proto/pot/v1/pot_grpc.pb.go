@@ -0,0 +1,297 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             (unknown)
+// source: pot/v1/pot.proto
+
+package potv1
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	Pot_Get_FullMethodName       = "/pot.v1.Pot/Get"
+	Pot_Create_FullMethodName    = "/pot.v1.Pot/Create"
+	Pot_Remove_FullMethodName    = "/pot.v1.Pot/Remove"
+	Pot_ListPaths_FullMethodName = "/pot.v1.Pot/ListPaths"
+	Pot_Watch_FullMethodName     = "/pot.v1.Pot/Watch"
+)
+
+// PotClient is the client API for Pot service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type PotClient interface {
+	// Get returns the documents of the pot.
+	Get(ctx context.Context, in *GetRequest, opts ...grpc.CallOption) (*GetResponse, error)
+	// Create writes documents to the pot.
+	Create(ctx context.Context, in *CreateRequest, opts ...grpc.CallOption) (*CreateResponse, error)
+	// Remove removes documents from the pot.
+	Remove(ctx context.Context, in *RemoveRequest, opts ...grpc.CallOption) (*RemoveResponse, error)
+	// ListPaths lists the paths of the pots under the path.
+	ListPaths(ctx context.Context, in *ListPathsRequest, opts ...grpc.CallOption) (*ListPathsResponse, error)
+	// Watch streams the changes of the documents of the pot. The current
+	// documents are sent as added first.
+	Watch(ctx context.Context, in *WatchRequest, opts ...grpc.CallOption) (Pot_WatchClient, error)
+}
+
+type potClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewPotClient(cc grpc.ClientConnInterface) PotClient {
+	return &potClient{cc}
+}
+
+func (c *potClient) Get(ctx context.Context, in *GetRequest, opts ...grpc.CallOption) (*GetResponse, error) {
+	out := new(GetResponse)
+	err := c.cc.Invoke(ctx, Pot_Get_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *potClient) Create(ctx context.Context, in *CreateRequest, opts ...grpc.CallOption) (*CreateResponse, error) {
+	out := new(CreateResponse)
+	err := c.cc.Invoke(ctx, Pot_Create_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *potClient) Remove(ctx context.Context, in *RemoveRequest, opts ...grpc.CallOption) (*RemoveResponse, error) {
+	out := new(RemoveResponse)
+	err := c.cc.Invoke(ctx, Pot_Remove_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *potClient) ListPaths(ctx context.Context, in *ListPathsRequest, opts ...grpc.CallOption) (*ListPathsResponse, error) {
+	out := new(ListPathsResponse)
+	err := c.cc.Invoke(ctx, Pot_ListPaths_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *potClient) Watch(ctx context.Context, in *WatchRequest, opts ...grpc.CallOption) (Pot_WatchClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Pot_ServiceDesc.Streams[0], Pot_Watch_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &potWatchClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Pot_WatchClient interface {
+	Recv() (*WatchResponse, error)
+	grpc.ClientStream
+}
+
+type potWatchClient struct {
+	grpc.ClientStream
+}
+
+func (x *potWatchClient) Recv() (*WatchResponse, error) {
+	m := new(WatchResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// PotServer is the server API for Pot service.
+// All implementations must embed UnimplementedPotServer
+// for forward compatibility
+type PotServer interface {
+	// Get returns the documents of the pot.
+	Get(context.Context, *GetRequest) (*GetResponse, error)
+	// Create writes documents to the pot.
+	Create(context.Context, *CreateRequest) (*CreateResponse, error)
+	// Remove removes documents from the pot.
+	Remove(context.Context, *RemoveRequest) (*RemoveResponse, error)
+	// ListPaths lists the paths of the pots under the path.
+	ListPaths(context.Context, *ListPathsRequest) (*ListPathsResponse, error)
+	// Watch streams the changes of the documents of the pot. The current
+	// documents are sent as added first.
+	Watch(*WatchRequest, Pot_WatchServer) error
+	mustEmbedUnimplementedPotServer()
+}
+
+// UnimplementedPotServer must be embedded to have forward compatible implementations.
+type UnimplementedPotServer struct {
+}
+
+func (UnimplementedPotServer) Get(context.Context, *GetRequest) (*GetResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Get not implemented")
+}
+func (UnimplementedPotServer) Create(context.Context, *CreateRequest) (*CreateResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Create not implemented")
+}
+func (UnimplementedPotServer) Remove(context.Context, *RemoveRequest) (*RemoveResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Remove not implemented")
+}
+func (UnimplementedPotServer) ListPaths(context.Context, *ListPathsRequest) (*ListPathsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListPaths not implemented")
+}
+func (UnimplementedPotServer) Watch(*WatchRequest, Pot_WatchServer) error {
+	return status.Errorf(codes.Unimplemented, "method Watch not implemented")
+}
+func (UnimplementedPotServer) mustEmbedUnimplementedPotServer() {}
+
+// UnsafePotServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to PotServer will
+// result in compilation errors.
+type UnsafePotServer interface {
+	mustEmbedUnimplementedPotServer()
+}
+
+func RegisterPotServer(s grpc.ServiceRegistrar, srv PotServer) {
+	s.RegisterService(&Pot_ServiceDesc, srv)
+}
+
+func _Pot_Get_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PotServer).Get(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Pot_Get_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PotServer).Get(ctx, req.(*GetRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Pot_Create_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PotServer).Create(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Pot_Create_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PotServer).Create(ctx, req.(*CreateRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Pot_Remove_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RemoveRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PotServer).Remove(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Pot_Remove_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PotServer).Remove(ctx, req.(*RemoveRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Pot_ListPaths_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListPathsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PotServer).ListPaths(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Pot_ListPaths_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PotServer).ListPaths(ctx, req.(*ListPathsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Pot_Watch_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(PotServer).Watch(m, &potWatchServer{stream})
+}
+
+type Pot_WatchServer interface {
+	Send(*WatchResponse) error
+	grpc.ServerStream
+}
+
+type potWatchServer struct {
+	grpc.ServerStream
+}
+
+func (x *potWatchServer) Send(m *WatchResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+// Pot_ServiceDesc is the grpc.ServiceDesc for Pot service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Pot_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "pot.v1.Pot",
+	HandlerType: (*PotServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Get",
+			Handler:    _Pot_Get_Handler,
+		},
+		{
+			MethodName: "Create",
+			Handler:    _Pot_Create_Handler,
+		},
+		{
+			MethodName: "Remove",
+			Handler:    _Pot_Remove_Handler,
+		},
+		{
+			MethodName: "ListPaths",
+			Handler:    _Pot_ListPaths_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Watch",
+			Handler:       _Pot_Watch_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "pot/v1/pot.proto",
+}
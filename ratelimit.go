@@ -0,0 +1,226 @@
+package pot
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"golang.org/x/time/rate"
+)
+
+var (
+	ErrRateLimited      = errors.New("rate limited")
+	ErrInvalidRateLimit = errors.New("invalid rate limit")
+)
+
+// rateLimitSweep is the interval between removals of the idle buckets
+const rateLimitSweep = time.Minute
+
+// RateLimitRule limits the rate of requests to the paths under the prefix. Each
+// client gets its own token bucket, refilled by Rate tokens per second and
+// holding up to Burst tokens.
+type RateLimitRule struct {
+	// Principal is a pattern of the principals the rule applies to, e.g.
+	// batch-* or spiffe://example.org/*, every caller if empty
+	Principal string `json:"principal,omitempty" yaml:"principal,omitempty" toml:"principal,omitempty"`
+
+	// Path is the path prefix the rule applies to, every path if empty
+	Path string `json:"path,omitempty" yaml:"path,omitempty" toml:"path,omitempty"`
+
+	// Rate is the number of requests per second
+	Rate float64 `json:"rate" yaml:"rate" toml:"rate"`
+
+	// Burst is the number of requests allowed at once, the rate rounded up if
+	// zero
+	Burst int `json:"burst,omitempty" yaml:"burst,omitempty" toml:"burst,omitempty"`
+
+	// Shared makes all clients share a single bucket, limiting the total rate
+	// of requests to the path
+	Shared bool `json:"shared,omitempty" yaml:"shared,omitempty" toml:"shared,omitempty"`
+}
+
+// RateLimiter rejects requests exceeding the rate limits. A request must be
+// allowed by every rule it matches.
+type RateLimiter struct {
+	rules []*rateLimitRule
+
+	mux       sync.Mutex
+	buckets   map[rateLimitKey]*rate.Limiter
+	lastSweep time.Time
+}
+
+type rateLimitRule struct {
+	RateLimitRule
+
+	principal *pattern
+	prefix    string
+}
+
+type rateLimitKey struct {
+	rule   int
+	client string
+}
+
+// NewRateLimiter validates the rules.
+func NewRateLimiter(rules ...RateLimitRule) (*RateLimiter, error) {
+	l := &RateLimiter{buckets: map[rateLimitKey]*rate.Limiter{}}
+
+	for _, rule := range rules {
+		if rule.Rate <= 0 || rule.Burst < 0 {
+			return nil, fmt.Errorf("%w: rate of %s must be positive", ErrInvalidRateLimit, rule.Path)
+		}
+		if rule.Burst == 0 {
+			rule.Burst = int(math.Ceil(rule.Rate))
+		}
+
+		compiled := &rateLimitRule{RateLimitRule: rule, prefix: strings.Trim(rule.Path, "/")}
+		if rule.Principal != "" {
+			p, err := compilePattern(rule.Principal)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %w", ErrInvalidRateLimit, err)
+			}
+			compiled.principal = p
+		}
+
+		l.rules = append(l.rules, compiled)
+	}
+
+	return l, nil
+}
+
+// matches reports whether the rule applies to the principal and the path.
+func (r *rateLimitRule) matches(p *Principal, dir string) bool {
+	if r.principal != nil {
+		if p == nil {
+			return false
+		}
+		if _, ok := r.principal.match(p.Name, nil); !ok {
+			return false
+		}
+	}
+
+	return r.prefix == "" || dir == r.prefix || strings.HasPrefix(dir, r.prefix+"/")
+}
+
+// Allow takes a token from the buckets of all rules matching the request. It
+// returns the rule that rejected the request and how long the client should
+// wait before retrying.
+func (l *RateLimiter) Allow(p *Principal, client, dir string, now time.Time) (*RateLimitRule, time.Duration, bool) {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	l.sweep(now)
+
+	reservations := []*rate.Reservation{}
+	for i, rule := range l.rules {
+		if !rule.matches(p, dir) {
+			continue
+		}
+
+		key := rateLimitKey{rule: i, client: client}
+		if rule.Shared {
+			key.client = ""
+		}
+
+		bucket, ok := l.buckets[key]
+		if !ok {
+			bucket = rate.NewLimiter(rate.Limit(rule.Rate), rule.Burst)
+			l.buckets[key] = bucket
+		}
+
+		reservation := bucket.ReserveN(now, 1)
+		if delay := reservation.DelayFrom(now); delay > 0 {
+			// the tokens taken by the other rules are returned, the request
+			// is not served
+			reservation.CancelAt(now)
+			for _, taken := range reservations {
+				taken.CancelAt(now)
+			}
+
+			return &rule.RateLimitRule, delay, false
+		}
+
+		reservations = append(reservations, reservation)
+	}
+
+	return nil, 0, true
+}
+
+// sweep removes the full buckets, which are the same as new ones, so the
+// buckets of clients that stopped sending requests don't pile up.
+func (l *RateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < rateLimitSweep {
+		return
+	}
+	l.lastSweep = now
+
+	for key, bucket := range l.buckets {
+		if bucket.TokensAt(now) >= float64(bucket.Burst()) {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// WithRateLimiter limits the rate of requests by the rules of the limiter.
+func WithRateLimiter(limiter *RateLimiter) Option {
+	return func(c *Server) {
+		c.rateLimiter.Store(limiter)
+	}
+}
+
+// rateLimitClient identifies the client of the request, which is the
+// principal if the request is authenticated, the remote host otherwise.
+func rateLimitClient(r *http.Request) (*Principal, string) {
+	if p, ok := PrincipalFromContext(r.Context()); ok && p != nil {
+		return p, "principal:" + p.Name
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	return nil, "addr:" + host
+}
+
+// rateLimit is the middleware rejecting requests over the rate limits with
+// 429 Too Many Requests.
+func (s *Server) rateLimit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limiter := s.rateLimiter.Load()
+		if limiter == nil || r.URL.Path == "/:healthz" || r.URL.Path == "/:readyz" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		dir := strings.TrimPrefix(r.URL.Path, "/")
+		if _, permDir, ok := requestPermission(r); ok {
+			dir = permDir
+		}
+
+		p, client := rateLimitClient(r)
+		rule, delay, ok := limiter.Allow(p, client, dir, time.Now())
+		if ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if s.MetricsOptions.Enabled {
+			s.MetricsOptions.PotThrottledRequests.Add(r.Context(), 1, metric.WithAttributes(
+				attribute.String("path", rule.Path),
+				attribute.String("principal", rule.Principal),
+			))
+		}
+
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(delay.Seconds()))))
+		http.Error(w, fmt.Sprintf("%s: retry in %s", ErrRateLimited, delay.Round(time.Millisecond)), http.StatusTooManyRequests)
+	})
+}
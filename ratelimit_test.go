@@ -0,0 +1,138 @@
+package pot
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type RateLimitSuite struct {
+	suite.Suite
+}
+
+func (s *RateLimitSuite) TestAllow() {
+	l, err := NewRateLimiter(
+		RateLimitRule{Rate: 10, Burst: 2},
+		RateLimitRule{Path: "hot", Rate: 1, Burst: 3, Shared: true},
+		RateLimitRule{Principal: "batch-*", Path: "jobs", Rate: 1, Burst: 1},
+	)
+	s.Require().NoError(err)
+
+	now := time.Now()
+	alice := &Principal{Name: "alice"}
+	bob := &Principal{Name: "bob"}
+	batch := &Principal{Name: "batch-nightly"}
+
+	// every client has its own bucket
+	for i := 0; i < 2; i++ {
+		_, _, ok := l.Allow(alice, "alice", "teams", now)
+		s.True(ok)
+	}
+	rule, delay, ok := l.Allow(alice, "alice", "teams", now)
+	s.False(ok)
+	s.Equal("", rule.Path)
+	s.Equal(100*time.Millisecond, delay)
+
+	_, _, ok = l.Allow(bob, "bob", "teams", now)
+	s.True(ok)
+
+	// the bucket refills over time
+	_, _, ok = l.Allow(alice, "alice", "teams", now.Add(100*time.Millisecond))
+	s.True(ok)
+
+	// the shared bucket limits the path across clients
+	later := now.Add(time.Second)
+	_, _, ok = l.Allow(alice, "alice", "hot/a", later)
+	s.True(ok)
+	_, _, ok = l.Allow(bob, "bob", "hot/b", later)
+	s.True(ok)
+	_, _, ok = l.Allow(batch, "batch-nightly", "hot", later)
+	s.True(ok)
+	rule, delay, ok = l.Allow(&Principal{Name: "carol"}, "carol", "hot", later)
+	s.False(ok)
+	s.Equal("hot", rule.Path)
+	s.Equal(time.Second, delay)
+
+	// rules only apply to matching principals and paths
+	later = now.Add(2 * time.Second)
+	_, _, ok = l.Allow(batch, "batch-nightly", "jobs/a", later)
+	s.True(ok)
+	rule, _, ok = l.Allow(batch, "batch-nightly", "jobs/a", later)
+	s.False(ok)
+	s.Equal("jobs", rule.Path)
+	_, _, ok = l.Allow(alice, "alice", "jobs/a", later)
+	s.True(ok)
+	_, _, ok = l.Allow(batch, "batch-nightly", "jobsx", later)
+	s.True(ok)
+}
+
+func (s *RateLimitSuite) TestRejectedRequestsTakeNoTokens() {
+	l, err := NewRateLimiter(
+		RateLimitRule{Rate: 1, Burst: 2},
+		RateLimitRule{Path: "hot", Rate: 1, Burst: 1, Shared: true},
+	)
+	s.Require().NoError(err)
+
+	now := time.Now()
+	_, _, ok := l.Allow(nil, "a", "hot", now)
+	s.True(ok)
+	_, _, ok = l.Allow(nil, "a", "hot", now)
+	s.False(ok)
+
+	// the request rejected by the shared rule returned its token
+	_, _, ok = l.Allow(nil, "a", "cold", now)
+	s.True(ok)
+}
+
+func (s *RateLimitSuite) TestSweep() {
+	l, err := NewRateLimiter(RateLimitRule{Rate: 1, Burst: 1})
+	s.Require().NoError(err)
+
+	now := time.Now()
+	l.Allow(nil, "a", "", now)
+	l.Allow(nil, "b", "", now)
+	s.Len(l.buckets, 2)
+
+	// the idle buckets refilled and are removed
+	l.Allow(nil, "c", "", now.Add(rateLimitSweep))
+	s.Len(l.buckets, 1)
+}
+
+func (s *RateLimitSuite) TestInvalidRules() {
+	_, err := NewRateLimiter(RateLimitRule{Rate: 0})
+	s.ErrorIs(err, ErrInvalidRateLimit)
+
+	_, err = NewRateLimiter(RateLimitRule{Rate: 1, Principal: "{user"})
+	s.ErrorIs(err, ErrInvalidRateLimit)
+}
+
+func (s *RateLimitSuite) TestMiddleware() {
+	l, err := NewRateLimiter(RateLimitRule{Path: "teams", Rate: 0.5, Burst: 1})
+	s.Require().NoError(err)
+
+	srv := &Server{}
+	srv.rateLimiter.Store(l)
+	handler := srv.rateLimit(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	serve := func(target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		return rec
+	}
+
+	s.Equal(http.StatusOK, serve("/teams/red").Code)
+
+	rec := serve("/teams:list")
+	s.Equal(http.StatusTooManyRequests, rec.Code)
+	s.Equal("2", rec.Header().Get("Retry-After"))
+
+	s.Equal(http.StatusOK, serve("/users").Code)
+	s.Equal(http.StatusOK, serve("/:healthz").Code)
+}
+
+func TestRateLimitSuite(t *testing.T) {
+	suite.Run(t, new(RateLimitSuite))
+}
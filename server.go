@@ -8,10 +8,13 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"maps"
+	"os"
 	"path"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"log/slog"
@@ -26,6 +29,7 @@ import (
 
 var (
 	ErrNoRewriteViolated = errors.New("no-rewrite rule was violated")
+	ErrInvalidDocument   = errors.New("invalid document")
 )
 
 // IsNoRewriteViolated checks whether the given error is the no-rewrite rule violation error.
@@ -54,6 +58,60 @@ type Server struct {
 	// the zip functionality is disabled.
 	zip string
 
+	// compression is the encoding used for newly written pots.
+	compression Compression
+
+	// encryption configures the envelope encryption of newly written pots.
+	encryption encryptionOptions
+
+	// indexes are the secondary indexes maintained on writes.
+	indexes []Index
+
+	// cache holds the decoded pots for reads. Caching is disabled if nil.
+	cache *potCache
+
+	// groupCommit coalesces concurrent writes to the same path. Writes are
+	// committed one by one if nil.
+	groupCommit *groupCommitter
+
+	// authenticators authenticate the requests to the routes, requests are
+	// not authenticated if there are none
+	authenticators []Authenticator
+
+	// acl authorizes the requests to the paths, everything is allowed if nil
+	acl atomic.Pointer[ACL]
+
+	// policy authorizes the requests by a Rego policy, if set
+	policy atomic.Pointer[Policy]
+
+	// rateLimiter rejects requests over the rate limits, if set
+	rateLimiter atomic.Pointer[RateLimiter]
+
+	// config is the config the server was created from, used to assert which
+	// sections changed on reload. It is nil if the server was created from
+	// options only.
+	config *Config
+
+	// configMux serializes reloads of the config
+	configMux sync.Mutex
+
+	// limits cap the size of writes and pots
+	limits Limits
+
+	// audit records the mutations and admin actions, nothing is recorded if
+	// nil
+	audit AuditSink
+
+	// cors answers the preflight requests of browsers, cross-origin requests
+	// are not allowed if nil
+	cors *CORS
+
+	// watchers are woken up by the writes of the watched pots
+	watchers watchHub
+
+	// draining is set once the server shuts down, readiness fails from then on
+	draining atomic.Bool
+
 	// MetricsOptions is the options for metrics reporting
 	MetricsOptions ServerMetricsOptions
 
@@ -78,6 +136,33 @@ type ServerMetricsOptions struct {
 
 	// PotRemoves is the number of removes from the pot
 	PotRemoves metric.Int64Counter
+
+	// PotCacheHits is the number of reads served from the cache
+	PotCacheHits metric.Int64Counter
+
+	// PotCacheMisses is the number of reads that missed the cache
+	PotCacheMisses metric.Int64Counter
+
+	// PotGroupCommitSize is the number of writes committed together
+	PotGroupCommitSize metric.Int64Histogram
+
+	// PotPolicyDecisions is the number of policy decisions by their result
+	PotPolicyDecisions metric.Int64Counter
+
+	// PotPolicyDuration is the duration of policy evaluations
+	PotPolicyDuration metric.Float64Histogram
+
+	// PotThrottledRequests is the number of requests rejected by rate limits
+	PotThrottledRequests metric.Int64Counter
+}
+
+type encryptionOptions struct {
+	// keys is the source of key encryption keys. Encryption is disabled if nil.
+	keys KeySource
+
+	// fields are the document fields to encrypt. The whole pot is encrypted
+	// if no fields are set.
+	fields []string
 }
 
 type ServerTracingOptions struct {
@@ -100,6 +185,14 @@ func NewServer(ctx context.Context, bucketName string, opts ...Option) (*Server,
 		opt(c)
 	}
 
+	if err := c.compression.validate(); err != nil {
+		return nil, err
+	}
+
+	if err := c.validateIndexes(); err != nil {
+		return nil, err
+	}
+
 	if c.MetricsOptions.Enabled {
 		avgLocalLockDuration, err := otel.
 			GetMeterProvider().
@@ -165,6 +258,84 @@ func NewServer(ctx context.Context, bucketName string, opts ...Option) (*Server,
 			return nil, err
 		}
 		c.MetricsOptions.PotRemoves = potRemoves
+
+		potCacheHits, err := otel.
+			GetMeterProvider().
+			Meter("pot-server").
+			Int64Counter(
+				"pot_cache_hits",
+				metric.WithDescription("pot_cache_hits is the number of reads served from the cache"),
+				metric.WithUnit("{call}"),
+			)
+		if err != nil {
+			return nil, err
+		}
+		c.MetricsOptions.PotCacheHits = potCacheHits
+
+		potCacheMisses, err := otel.
+			GetMeterProvider().
+			Meter("pot-server").
+			Int64Counter(
+				"pot_cache_misses",
+				metric.WithDescription("pot_cache_misses is the number of reads that missed the cache"),
+				metric.WithUnit("{call}"),
+			)
+		if err != nil {
+			return nil, err
+		}
+		c.MetricsOptions.PotCacheMisses = potCacheMisses
+
+		potGroupCommitSize, err := otel.
+			GetMeterProvider().
+			Meter("pot-server").
+			Int64Histogram(
+				"pot_group_commit_size",
+				metric.WithDescription("pot_group_commit_size is the number of writes committed together"),
+				metric.WithUnit("{call}"),
+			)
+		if err != nil {
+			return nil, err
+		}
+		c.MetricsOptions.PotGroupCommitSize = potGroupCommitSize
+
+		potPolicyDecisions, err := otel.
+			GetMeterProvider().
+			Meter("pot-server").
+			Int64Counter(
+				"pot_policy_decisions",
+				metric.WithDescription("pot_policy_decisions is the number of policy decisions by their result"),
+				metric.WithUnit("{decision}"),
+			)
+		if err != nil {
+			return nil, err
+		}
+		c.MetricsOptions.PotPolicyDecisions = potPolicyDecisions
+
+		potPolicyDuration, err := otel.
+			GetMeterProvider().
+			Meter("pot-server").
+			Float64Histogram(
+				"pot_policy_duration",
+				metric.WithDescription("pot_policy_duration is the duration of policy evaluations"),
+				metric.WithUnit("ms"),
+			)
+		if err != nil {
+			return nil, err
+		}
+		c.MetricsOptions.PotPolicyDuration = potPolicyDuration
+
+		potThrottledRequests, err := otel.
+			GetMeterProvider().
+			Meter("pot-server").
+			Int64Counter(
+				"pot_throttled_requests",
+				metric.WithDescription("pot_throttled_requests is the number of requests rejected by rate limits"),
+				metric.WithUnit("{request}"),
+			)
+		if err != nil {
+			return nil, err
+		}
+		c.MetricsOptions.PotThrottledRequests = potThrottledRequests
 	}
 
 	return c, nil
@@ -192,6 +363,30 @@ func WithZip(zip string) Option {
 	}
 }
 
+// WithCompression stores pots compressed with the given encoding. Pots are
+// decoded transparently on reads, including pots written with a different
+// compression setting. Only gzip compressed pots stay readable by other tools,
+// as Cloud Storage doesn't decompress zstd objects for them.
+func WithCompression(compression Compression) Option {
+	return func(c *Server) {
+		c.compression = compression
+	}
+}
+
+// WithEncryption encrypts newly written pots with AES-GCM using a fresh data key
+// for every write, wrapped by the given key source. If fields are provided, only
+// the given top-level fields of each document are encrypted and the pot stays
+// readable as JSON, otherwise the whole pot is encrypted.
+//
+// Encrypted pots are never included in the zip bundle, since the bundle is
+// readable by anyone with bucket access.
+func WithEncryption(keys KeySource, fields ...string) Option {
+	return func(c *Server) {
+		c.encryption.keys = keys
+		c.encryption.fields = fields
+	}
+}
+
 // WithMetrics enables metrics reporting on the server.
 func WithMetrics() Option {
 	return func(c *Server) {
@@ -219,6 +414,9 @@ type CallOpts struct {
 	norewrite           bool
 	norewriteDuration   time.Duration
 	lastKnownGeneration int64
+	codec               Codec
+	min                 *float64
+	max                 *float64
 }
 
 // CallOpt is a functional option for the server methods. It allows to
@@ -232,6 +430,14 @@ func WithBatch() CallOpt {
 	}
 }
 
+// WithRequestCodec sets the codec used to decode the content passed to the
+// server methods. JSON is used by default.
+func WithRequestCodec(codec Codec) CallOpt {
+	return func(o *CallOpts) {
+		o.codec = codec
+	}
+}
+
 // WithNoRewrite disables rewriting of keys that already exist in data and only
 // enables the write if either of these conditions is met:
 //   - the key doesn't exist in data.
@@ -273,144 +479,305 @@ func (s *Server) Create(ctx context.Context, dir string, r io.Reader, callOpts .
 	ctx, fullEnd := s.trace(ctx, "create", attribute.String("path", dir))
 	defer fullEnd()
 
-	slog.Debug("acquiring lock", slog.String("dir", dir), slog.String("method", "create"))
-	defer slog.Debug("releasing lock", slog.String("dir", dir), slog.String("method", "create"))
-
-	opts := &CallOpts{}
+	opts := &CallOpts{
+		codec: CodecJSON,
+	}
 	for _, opt := range callOpts {
 		opt(opts)
 	}
 
-	// acquire the lock for the given path on the current server and defer the release
-	ctx, end := s.trace(ctx, "local-lock", attribute.String("path", dir))
-	s.localLock(ctx, dir)
-	defer s.localUnlock(dir)
-	end()
+	r, bodyErr := s.limits.limitBody(r)
 
-	// if distributed locking is enabled, try to acquire the lock
-	// and defer the release of the lock
-	if s.distributedLock {
-		slog.Debug("acquiring distributed lock", slog.String("dir", dir), slog.String("method", "create"))
-		defer slog.Debug("removing distributed lock", slog.String("dir", dir), slog.String("method", "create"))
-
-		ctx, end = s.trace(ctx, "distributed-lock", attribute.String("path", dir))
+	objs := map[string]any{}
+	// if the batch option is set, decode the content as a batch request
+	if opts.batch {
+		var err error
+		objs, err = decodeBatchContent(r, opts.codec)
+		if err != nil {
+			return nil, bodyErr(err)
+		}
+	} else {
+		// decode the new object so it can be added to the content
+		obj := map[string]any{}
+		if err := opts.codec.Decode(r, &obj); err != nil {
+			return nil, bodyErr(err)
+		}
 
-		id, err := s.lockSharedPath(ctx, dir)
+		key, err := documentKey(obj)
 		if err != nil {
-			end()
 			return nil, err
 		}
-		defer func(id string) {
-			err := s.unlockSharedPath(ctx, dir, id)
-			if err != nil {
-				slog.Error("failed to unlock path", slog.String("dir", dir), slog.String("method", "create"), slog.String("error", err.Error()))
-			}
-		}(id)
 
-		end()
+		// add the new object to the content
+		objs[key] = obj
 	}
 
-	ctx, end = s.trace(ctx, "read-write", attribute.String("path", dir))
-
-	content := map[string]any{}
-	pot := s.bucket.Object(s.potPath(dir))
+	docs, err := marshalDocuments(objs)
+	if err != nil {
+		return nil, err
+	}
 
-	reader, err := pot.NewReader(ctx)
-	// return an error if an unexpected error occurred
-	if err != nil && err != storage.ErrObjectNotExist {
+	if err := s.limits.checkWrite(docs, opts.batch); err != nil {
 		return nil, err
 	}
 
-	// decode the content if the object exists, otherwise the content will be empty
-	if err != storage.ErrObjectNotExist {
-		defer reader.Close()
+	write := &pendingWrite{
+		objs: objs,
+		docs: docs,
+		opts: opts,
+	}
 
-		if err := json.NewDecoder(reader).Decode(&content); err != nil {
-			return nil, err
+	if s.groupCommit != nil {
+		s.submitWrite(ctx, dir, write)
+	} else {
+		s.commitWrites(ctx, dir, []*pendingWrite{write})
+	}
+
+	if write.err == nil {
+		s.recordAudit(ctx, &AuditEvent{
+			Action:     AuditCreate,
+			Path:       dir,
+			Keys:       sortedKeys(docs),
+			Before:     write.before,
+			After:      auditHashes(docs),
+			Generation: write.res.Generation,
+		})
+	}
+
+	return write.res, write.err
+}
+
+// keepPrevious reports whether the previous content of the written documents
+// is needed, either by the indexes or the audit.
+func (s *Server) keepPrevious() bool {
+	return len(s.indexes) > 0 || s.audit != nil
+}
+
+// commitWrites merges the writes into the pot in a single read-write cycle.
+// Writes are applied in order and each of them either succeeds or fails as a
+// whole, the results are stored on the writes.
+func (s *Server) commitWrites(ctx context.Context, dir string, batch []*pendingWrite) {
+	fail := func(err error) {
+		for _, w := range batch {
+			if w.err == nil {
+				w.err = err
+			}
 		}
 	}
 
-	objs := map[string]any{}
-	// if the batch option is set, decode the content as a batch request
-	if opts.batch {
-		objs, err = decodeBatchContent(r)
+	unlock, err := s.lockPath(ctx, dir, "create")
+	if err != nil {
+		fail(err)
+		return
+	}
+	defer unlock()
+
+	ctx, end := s.trace(ctx, "read-write", attribute.String("path", dir), attribute.Int("writes", len(batch)))
+	defer end()
+
+	reader, err := s.openPot(ctx, dir)
+	if err != nil {
+		fail(err)
+		return
+	}
+
+	// assert whether rewrites of the stored keys are allowed for each of the
+	// writes. If the reader is nil, it means that the pot doesn't exist yet and
+	// therefore the no-rewrite rule doesn't apply
+	now := time.Now()
+	allowStored := make([]bool, len(batch))
+	restricted := false
+	for i, w := range batch {
+		allowStored[i] = reader == nil || allowRewrite(reader.Attrs, w.opts, now)
+		restricted = restricted || !allowStored[i]
+	}
+
+	// the no-rewrite rule of a single write is asserted while merging. Batches
+	// need to know the stored keys upfront, so that a violating write can be
+	// left out without failing the others.
+	var stored map[string]bool
+	if restricted && len(batch) > 1 {
+		stored, err = storedKeys(reader)
+		reader.Close()
 		if err != nil {
-			return nil, err
+			fail(err)
+			return
 		}
-	} else {
-		// decode the new object so it can be added to the content
-		obj := map[string]any{}
-		if err := json.NewDecoder(r).Decode(&obj); err != nil {
-			return nil, err
+
+		reader, err = s.openPotGeneration(ctx, dir, reader.Attrs.Generation)
+		if err != nil {
+			fail(err)
+			return
 		}
+	}
+	if reader != nil {
+		defer reader.Close()
+	}
 
-		// check whether either "id" or "name" is set and use the value as key
-		var key string
-		if name, ok := obj["name"]; ok {
-			key = name.(string)
+	docs := map[string]json.RawMessage{}
+	accepted := []*pendingWrite{}
+	for i, w := range batch {
+		if key, ok := violatedKey(w, allowStored[i], stored, docs); ok {
+			w.err = fmt.Errorf("%w: %s", ErrNoRewriteViolated, key)
+			continue
 		}
-		if id, ok := obj["id"]; ok {
-			key = id.(string)
+
+		for key, doc := range w.docs {
+			docs[key] = doc
 		}
+		accepted = append(accepted, w)
+	}
+	if len(accepted) == 0 {
+		return
+	}
 
-		// add the new object to the content
-		objs[key] = obj
+	// stream the current content into the new pot, replacing the documents that
+	// are part of the writes. The upload is aborted if any of the keys violates
+	// the no-rewrite rule, so the stored pot stays untouched.
+	writer, err := s.newPotWriter(ctx, dir)
+	if err != nil {
+		fail(err)
+		return
 	}
+	writer.limit = s.potLimiter()
+	replaced := map[string]bool{}
+	assertStored := stored == nil && !allowStored[0]
 
-	// assert whether rewrites of existing keys are allowed. By default, clients
-	// can overwrite any keys at any time. However if the no-rewrite option is
-	// set, the server will only allow the write if the key doesn't exist, is owned
-	// by the current server or the last modification of the key is older than the
-	// provided duration.
-	allowRewrite := true
+	// previous content of the replaced documents used to update the indexes
+	previous := map[string]json.RawMessage{}
 
-	// if the reader is nil, it means that the pot doesn't exist yet and therefore
-	// the no-rewrite rule doesn't apply
 	if reader != nil {
-		// check whether the no-rewrite rule contains duration and if so, check whether
-		// the duration has passed since the last modification of the pot
-		if opts.norewrite {
-			if opts.norewriteDuration > 0 && !canRewrite(reader.Attrs.LastModified, time.Now(), opts.norewriteDuration) {
-				allowRewrite = false
+		err := reader.Each(func(key string, doc json.RawMessage) error {
+			next, ok := docs[key]
+			if !ok {
+				return writer.Encode(key, doc)
+			}
+
+			if assertStored {
+				return fmt.Errorf("%w: %s", ErrNoRewriteViolated, key)
 			}
 
-			// check if the last cached generation doesn't correspond to the current one
-			// and if so, enable the rewrite anyway
-			if reader.Attrs.Generation == opts.lastKnownGeneration {
-				allowRewrite = true
+			replaced[key] = true
+			if s.keepPrevious() {
+				previous[key] = doc
 			}
+			return writer.Encode(key, next)
+		})
+		if err != nil {
+			writer.Abort()
+			fail(err)
+			return
+		}
+	}
+
+	// append documents that didn't exist in the pot yet
+	for _, key := range sortedKeys(docs) {
+		if replaced[key] {
+			continue
+		}
+
+		if err := writer.Encode(key, docs[key]); err != nil {
+			writer.Abort()
+			fail(err)
+			return
 		}
 	}
 
-	for k, v := range objs {
-		if _, ok := content[k]; ok {
-			if !allowRewrite {
-				return nil, fmt.Errorf("%w: %s", ErrNoRewriteViolated, k)
+	if err := writer.Close(); err != nil {
+		fail(err)
+		return
+	}
+
+	s.updateIndexes(ctx, dir, previous, docs)
+	s.updateCache(dir, reader, writer, docs, nil)
+	s.watchers.notify(dir)
+
+	// documents written by the preceding writes of the batch are the previous
+	// content of the following ones
+	current := maps.Clone(previous)
+	for _, w := range accepted {
+		w.res = &CreateResponse{
+			Content:    w.objs,
+			Generation: writer.Attrs().Generation,
+		}
+
+		if s.audit != nil {
+			w.before = map[string]string{}
+			for key, doc := range w.docs {
+				if prev, ok := current[key]; ok {
+					w.before[key] = auditHash(prev)
+				}
+				current[key] = doc
 			}
 		}
+	}
+}
 
-		content[k] = v
+// allowRewrite asserts whether the write may rewrite documents of the stored
+// pot. By default, clients can overwrite any keys at any time. However if the
+// no-rewrite option is set, the server will only allow the write if the key
+// doesn't exist, is owned by the current server or the last modification of
+// the key is older than the provided duration.
+func allowRewrite(attrs storage.ReaderObjectAttrs, opts *CallOpts, now time.Time) bool {
+	if !opts.norewrite {
+		return true
 	}
 
-	// encode the content to the pot
-	writer := pot.NewWriter(ctx)
-	if err := json.NewEncoder(writer).Encode(content); err != nil {
-		return nil, err
+	// check if the last cached generation corresponds to the current one and if
+	// so, enable the rewrite anyway
+	if attrs.Generation == opts.lastKnownGeneration {
+		return true
 	}
-	writer.Close()
-	end()
 
-	return &CreateResponse{
-		Content:    objs,
-		Generation: writer.Attrs().Generation,
-	}, nil
+	// check whether the no-rewrite rule contains duration and if so, check whether
+	// the duration has passed since the last modification of the pot
+	return opts.norewriteDuration <= 0 || canRewrite(attrs.LastModified, now, opts.norewriteDuration)
+}
+
+// violatedKey returns the first key of the write that violates its no-rewrite
+// rule. Stored are the keys of the stored pot, or nil if they are not known,
+// and written are the documents of the preceding writes of the same batch.
+func violatedKey(w *pendingWrite, allowStored bool, stored map[string]bool, written map[string]json.RawMessage) (string, bool) {
+	for _, key := range sortedKeys(w.docs) {
+		if stored[key] && !allowStored {
+			return key, true
+		}
+
+		// documents written by the preceding writes were modified just now and
+		// under a generation the client can't know yet
+		if _, ok := written[key]; ok && w.opts.norewrite && w.opts.norewriteDuration > 0 {
+			return key, true
+		}
+	}
+
+	return "", false
 }
 
 // decodeBatchContent decodes the content of a batch request. The batch request
 // is a 2-level map instead of a single-level map like with non-batch requests.
-func decodeBatchContent(r io.Reader) (map[string]any, error) {
+// documentKey returns the key of the document, the value of its "id" or else
+// its "name" field. Both fields must be strings if set.
+func documentKey(obj map[string]any) (string, error) {
+	var key string
+	for _, field := range []string{"name", "id"} {
+		value, ok := obj[field]
+		if !ok {
+			continue
+		}
+
+		str, ok := value.(string)
+		if !ok {
+			return "", fmt.Errorf("%w: %s must be a string", ErrInvalidDocument, field)
+		}
+		key = str
+	}
+
+	return key, nil
+}
+
+func decodeBatchContent(r io.Reader, codec Codec) (map[string]any, error) {
 	batch := map[string]map[string]any{}
-	if err := json.NewDecoder(r).Decode(&batch); err != nil {
+	if err := codec.Decode(r, &batch); err != nil {
 		return nil, err
 	}
 
@@ -465,96 +832,167 @@ func (c *Server) ListPaths(ctx context.Context, subdir string) (*ListPathsRespon
 	return res, nil
 }
 
+// Get returns the content of the pot on the given directory path. If the cache
+// is enabled, the documents of the returned map are shared with the cache and
+// must not be modified.
 func (c *Server) Get(ctx context.Context, dir string) (map[string]interface{}, error) {
 	c.localRLock(ctx, dir)
 	defer c.localRUnlock(dir)
 
+	if c.cache != nil {
+		content, ok, err := c.getCached(ctx, dir)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return content, nil
+		}
+	}
+
 	content := map[string]interface{}{}
-	pot := c.bucket.Object(c.potPath(dir))
 
-	reader, err := pot.NewReader(ctx)
-	// return an error if an unexpected error occurred
-	if err != nil && err != storage.ErrObjectNotExist {
+	reader, err := c.openPot(ctx, dir)
+	if err != nil {
 		return nil, err
 	}
 
+	// pots that don't exist yet are cached with the zero generation
+	var generation int64
+
 	// decode the content if the object exists, otherwise the content will be empty
-	if err != storage.ErrObjectNotExist {
+	if reader != nil {
+		generation = reader.Attrs.Generation
+
 		defer reader.Close()
 
-		if err := json.NewDecoder(reader).Decode(&content); err != nil {
+		err := reader.Each(func(key string, doc json.RawMessage) error {
+			var obj any
+			if err := json.Unmarshal(doc, &obj); err != nil {
+				return err
+			}
+
+			content[key] = obj
+			return nil
+		})
+		if err != nil {
 			return nil, err
 		}
 	}
 
+	if c.cache != nil {
+		c.cache.put(dir, content, generation, time.Now())
+		return maps.Clone(content), nil
+	}
+
 	return content, nil
 }
 
-// Remove removes the provided keys from the pot on the given directory path.
-func (c *Server) Remove(ctx context.Context, dir string, keys ...string) error {
-	slog.Debug("acquiring lock", slog.String("dir", dir), slog.String("method", "remove"))
-	defer slog.Debug("releasing lock", slog.String("dir", dir), slog.String("method", "remove"))
+// Stream writes the content of the pot on the given directory path to the writer
+// as a JSON object. Unlike Get, the pot is never fully decoded, documents are copied
+// one by one instead, so it is suitable for pots of any size.
+func (c *Server) Stream(ctx context.Context, dir string, w io.Writer) error {
+	c.localRLock(ctx, dir)
+	defer c.localRUnlock(dir)
 
-	c.localLock(ctx, dir)
-	defer c.localUnlock(dir)
+	reader, err := c.openPot(ctx, dir)
+	if err != nil {
+		return err
+	}
 
-	if c.distributedLock {
-		slog.Debug("acquiring distributed lock", slog.String("dir", dir), slog.String("method", "remove"))
-		defer slog.Debug("removing distributed lock", slog.String("dir", dir), slog.String("method", "remove"))
+	enc := newDocEncoder(w)
+	if reader != nil {
+		defer reader.Close()
 
-		id, err := c.lockSharedPath(ctx, dir)
-		if err != nil {
+		if err := reader.Each(enc.Encode); err != nil {
 			return err
 		}
-		defer func(id string) {
-			err := c.unlockSharedPath(ctx, dir, id)
-			if err != nil {
-				slog.Error("failed to unlock path", slog.String("dir", dir), slog.String("method", "remove"), slog.String("error", err.Error()))
-			}
-		}(id)
 	}
 
-	content := map[string]interface{}{}
-	pot := c.bucket.Object(c.potPath(dir))
+	return enc.Close()
+}
 
-	reader, err := pot.NewReader(ctx)
-	// return an error if an unexpected error occurred
-	if err != nil && err != storage.ErrObjectNotExist {
+// Remove removes the provided keys from the pot on the given directory path.
+func (c *Server) Remove(ctx context.Context, dir string, keys ...string) error {
+	unlock, err := c.lockPath(ctx, dir, "remove")
+	if err != nil {
 		return err
 	}
+	defer unlock()
 
-	// decode the content if the object exists, otherwise the content will be empty
-	if err != storage.ErrObjectNotExist {
+	reader, err := c.openPot(ctx, dir)
+	if err != nil {
+		return err
+	}
+
+	removed := map[string]bool{}
+	for _, key := range keys {
+		removed[key] = true
+	}
+
+	// stream the content into the new pot, skipping the removed keys
+	writer, err := c.newPotWriter(ctx, dir)
+	if err != nil {
+		return err
+	}
+
+	// previous content of the removed documents used to update the indexes
+	previous := map[string]json.RawMessage{}
+
+	if reader != nil {
 		defer reader.Close()
 
-		if err := json.NewDecoder(reader).Decode(&content); err != nil {
+		err := reader.Each(func(key string, doc json.RawMessage) error {
+			if removed[key] {
+				if c.keepPrevious() {
+					previous[key] = doc
+				}
+				return nil
+			}
+
+			return writer.Encode(key, doc)
+		})
+		if err != nil {
+			writer.Abort()
 			return err
 		}
 	}
 
-	// delete the object from the content
-	for _, key := range keys {
-		delete(content, key)
-	}
-
-	// encode the content to the pot
-	writer := pot.NewWriter(ctx)
-	defer writer.Close()
-	if err := json.NewEncoder(writer).Encode(content); err != nil {
+	if err := writer.Close(); err != nil {
 		return err
 	}
 
+	c.updateIndexes(ctx, dir, previous, nil)
+	c.updateCache(dir, reader, writer, nil, keys)
+	c.watchers.notify(dir)
+
+	c.recordAudit(ctx, &AuditEvent{
+		Action:     AuditRemove,
+		Path:       dir,
+		Keys:       keys,
+		Before:     auditHashes(previous),
+		Generation: writer.Attrs().Generation,
+	})
 	return nil
 }
 
+// Zip bundles all objects on the bucket into a tar.gz file stored in the given
+// directory. The bundle is streamed directly to the bucket, so only a small
+// buffer is held in memory regardless of the bundle size.
 func (c *Server) Zip(ctx context.Context, dir string) error {
 	c.localLock(ctx, dir)
 	defer c.localUnlock(dir)
 
-	var buf strings.Builder
-	gzw := gzip.NewWriter(&buf)
+	writeCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	writer := c.bucket.Object(path.Join(dir, "bundle.tar.gz")).NewWriter(writeCtx)
+	writer.ContentType = "application/gzip"
+
+	gzw := gzip.NewWriter(writer)
 	tw := tar.NewWriter(gzw)
 
+	// returning before the writer is closed aborts the upload through the
+	// cancelled context, leaving the previous bundle in place
 	objList := c.bucket.Objects(ctx, &storage.Query{})
 	for {
 		obj, err := objList.Next()
@@ -575,21 +1013,23 @@ func (c *Server) Zip(ctx context.Context, dir string) error {
 			continue
 		}
 
-		objReader, err := c.bucket.Object(obj.Name).NewReader(ctx)
-		if err != nil {
-			return err
+		// ignore the index objects
+		if strings.HasPrefix(obj.Name, indexDir+"/") {
+			continue
 		}
-		defer objReader.Close()
 
-		hdr := &tar.Header{
-			Name: obj.Name,
-			Size: obj.Size,
+		// ignore the audit events, they are not part of the content
+		if c.isAuditObject(obj.Name) {
+			continue
 		}
-		if err := tw.WriteHeader(hdr); err != nil {
-			return err
+
+		// ignore pots encrypted as a whole, their content must never be readable
+		// without the key source
+		if obj.ContentType == contentTypeEncrypted {
+			continue
 		}
 
-		if _, err := io.Copy(tw, objReader); err != nil {
+		if err := c.zipObject(ctx, tw, obj); err != nil {
 			return err
 		}
 	}
@@ -602,15 +1042,100 @@ func (c *Server) Zip(ctx context.Context, dir string) error {
 		return err
 	}
 
-	dst := c.bucket.Object(path.Join(dir, "bundle.tar.gz"))
-	writer := dst.NewWriter(ctx)
-	defer writer.Close()
+	return writer.Close()
+}
 
-	if _, err := io.Copy(writer, strings.NewReader(buf.String())); err != nil {
+// zipObject copies a single object from the bucket into the tar archive. Objects
+// stored with a Content-Encoding are decoded first, which requires spooling them
+// to a temporary file as the tar header must contain the decoded size.
+func (c *Server) zipObject(ctx context.Context, tw *tar.Writer, obj *storage.ObjectAttrs) error {
+	objReader, err := c.bucket.Object(obj.Name).ReadCompressed(true).NewReader(ctx)
+	if err != nil {
 		return err
 	}
+	defer objReader.Close()
 
-	return nil
+	var content io.Reader = objReader
+	size := obj.Size
+
+	if obj.ContentEncoding != "" {
+		dec, err := decompressReader(objReader, obj.ContentEncoding)
+		if err != nil {
+			return err
+		}
+		defer dec.Close()
+
+		tmp, err := os.CreateTemp("", "pot-zip-*")
+		if err != nil {
+			return err
+		}
+		defer os.Remove(tmp.Name())
+		defer tmp.Close()
+
+		size, err = io.Copy(tmp, dec)
+		if err != nil {
+			return err
+		}
+
+		if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		content = tmp
+	}
+
+	hdr := &tar.Header{
+		Name: obj.Name,
+		Size: size,
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+
+	_, err = io.Copy(tw, content)
+	return err
+}
+
+// lockPath acquires the lock for the given path on the current server and, if
+// distributed locking is enabled, the distributed lock. The returned function
+// releases the acquired locks.
+func (s *Server) lockPath(ctx context.Context, dir, method string) (func(), error) {
+	slog.Debug("acquiring lock", slog.String("dir", dir), slog.String("method", method))
+
+	ctx, end := s.trace(ctx, "local-lock", attribute.String("path", dir))
+	s.localLock(ctx, dir)
+	end()
+
+	unlock := func() {
+		s.localUnlock(dir)
+		slog.Debug("releasing lock", slog.String("dir", dir), slog.String("method", method))
+	}
+
+	if !s.distributedLock {
+		return unlock, nil
+	}
+
+	slog.Debug("acquiring distributed lock", slog.String("dir", dir), slog.String("method", method))
+
+	ctx, end = s.trace(ctx, "distributed-lock", attribute.String("path", dir))
+	defer end()
+
+	id, err := s.lockSharedPath(ctx, dir)
+	if err != nil {
+		unlock()
+		return nil, err
+	}
+
+	return func() {
+		slog.Debug("removing distributed lock", slog.String("dir", dir), slog.String("method", method))
+
+		// the lock must be released even if the request context was cancelled
+		err := s.unlockSharedPath(context.WithoutCancel(ctx), dir, id)
+		if err != nil {
+			slog.Error("failed to unlock path", slog.String("dir", dir), slog.String("method", method), slog.String("error", err.Error()))
+		}
+
+		unlock()
+	}, nil
 }
 
 // localLock locks the given path on the current server.
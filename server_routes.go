@@ -2,9 +2,13 @@ package pot
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
+	"fmt"
+	"log/slog"
+	"math"
 	"net/http"
+	"path"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
@@ -22,6 +26,52 @@ func (s *Server) Routes() http.Handler {
 		mux.Use(otelmux.Middleware("pot-server"))
 	}
 
+	mux.Use(s.requestID)
+	mux.Use(s.authenticate)
+	mux.Use(s.rateLimit)
+	mux.Use(s.authorize)
+	mux.Use(s.evaluatePolicy)
+
+	mux.
+		Methods(http.MethodGet, http.MethodHead).
+		Path("/:healthz").
+		HandlerFunc(s.routeHealthFunc)
+
+	mux.
+		Methods(http.MethodGet, http.MethodHead).
+		Path("/:readyz").
+		HandlerFunc(s.routeReadyFunc)
+
+	mux.
+		Methods(http.MethodGet).
+		Path("/:openapi").
+		HandlerFunc(s.routeOpenAPIFunc)
+
+	mux.
+		Methods(http.MethodGet).
+		Path("/:admin/permissions").
+		HandlerFunc(s.routePermissionsFunc)
+
+	mux.
+		Methods(http.MethodGet).
+		Path("/:index/{name}").
+		HandlerFunc(s.routeIndexFunc)
+
+	mux.
+		Methods(http.MethodPost).
+		Path("/:index/{name}").
+		HandlerFunc(s.routeRebuildIndexFunc)
+
+	mux.
+		Methods(http.MethodGet).
+		Path("/:snapshot").
+		HandlerFunc(s.routeSnapshotFunc)
+
+	mux.
+		Methods(http.MethodPost).
+		Path("/:snapshot").
+		HandlerFunc(s.routeRestoreFunc)
+
 	mux.
 		Methods(http.MethodGet).
 		PathPrefix("/").
@@ -37,30 +87,71 @@ func (s *Server) Routes() http.Handler {
 		PathPrefix("/").
 		HandlerFunc(s.routeDeleteFunc)
 
-	return mux
+	return s.handleCORS(mux)
 }
 
 func (s *Server) routeGetFunc(w http.ResponseWriter, r *http.Request) {
-	var err error
-	var content any
-
 	relPath := strings.TrimPrefix(r.URL.Path, "/")
 
-	// if the path has a :list suffix then we want to list the keys
-	if strings.HasSuffix(relPath, ":list") {
-		content, err = s.ListPaths(r.Context(), strings.TrimSuffix(relPath, ":list"))
-	} else {
-		content, err = s.Get(r.Context(), relPath)
+	// if the path has an :export suffix then we want to export the documents
+	if strings.HasSuffix(relPath, ":export") {
+		s.routeExportFunc(w, r)
+		return
+	}
+
+	// if the path has an :audit suffix then we want the audit trail
+	if strings.HasSuffix(relPath, ":audit") {
+		s.routeAuditFunc(w, r)
+		return
+	}
+
+	if err := validatePath(strings.TrimSuffix(relPath, ":list")); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
 
+	codec, err := negotiateCodec(r.Header.Get("Accept"))
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusNotAcceptable)
 		return
 	}
 
-	// encode the content to the response
-	if err := json.NewEncoder(w).Encode(content); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	// if the path has a :list suffix then we want to list the keys
+	if strings.HasSuffix(relPath, ":list") {
+		content, err := s.ListPaths(r.Context(), strings.TrimSuffix(relPath, ":list"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		// only the paths the caller may list are returned
+		content.Paths = slices.DeleteFunc(content.Paths, func(dir string) bool {
+			return !s.permitted(r.Context(), PermissionList, dir)
+		})
+
+		writeContent(w, codec, http.StatusOK, content)
+	} else if codec == CodecJSON && s.cache == nil {
+		// the pot is streamed to the response, so once the first bytes are sent
+		// the status can't be changed anymore and the error can only be logged
+		w.Header().Set("Content-Type", codec.ContentType())
+		rw := &responseTracker{ResponseWriter: w}
+		if err := s.Stream(r.Context(), relPath, rw); err != nil {
+			if !rw.written {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			slog.Error("failed to stream pot", slog.String("path", relPath), slog.String("error", err.Error()))
+			return
+		}
+	} else {
+		content, err := s.Get(r.Context(), relPath)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		writeContent(w, codec, http.StatusOK, content)
 	}
 
 	if s.MetricsOptions.Enabled {
@@ -73,12 +164,36 @@ func (s *Server) routeGetFunc(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *Server) routePostFunc(w http.ResponseWriter, r *http.Request) {
-	var err error
-	var content any
-
 	relPath := strings.TrimPrefix(r.URL.Path, "/")
 
-	callOpts := []CallOpt{}
+	// if the path has an :increment suffix then we want to increment a field
+	if strings.HasSuffix(relPath, ":increment") {
+		s.routeIncrementFunc(w, r)
+		return
+	}
+
+	// if the path has an :import suffix then we want to import the documents
+	if strings.HasSuffix(relPath, ":import") {
+		s.routeImportFunc(w, r)
+		return
+	}
+
+	if err := validatePath(relPath); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	reqCodec := codecForContentType(r.Header.Get("Content-Type"))
+
+	// the response codec is negotiated before the write, so clients that can't
+	// read the response don't modify the pot
+	respCodec, err := negotiateCodec(r.Header.Get("Accept"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotAcceptable)
+		return
+	}
+
+	callOpts := []CallOpt{WithRequestCodec(reqCodec)}
 	if r.URL.Query().Has("batch") {
 		callOpts = append(callOpts, WithBatch())
 	}
@@ -103,8 +218,9 @@ func (s *Server) routePostFunc(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	content, err = s.Create(r.Context(), relPath, r.Body, callOpts...)
+	content, err := s.Create(r.Context(), relPath, r.Body, callOpts...)
 	if err == nil {
+		w.Header().Set("Content-Type", respCodec.ContentType())
 		w.WriteHeader(http.StatusCreated)
 	}
 	if err != nil {
@@ -112,6 +228,12 @@ func (s *Server) routePostFunc(w http.ResponseWriter, r *http.Request) {
 		if errors.Is(err, ErrNoRewriteViolated) {
 			w.WriteHeader(http.StatusLocked)
 			return
+		} else if errors.Is(err, ErrInvalidDocument) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		} else if status, ok := limitStatus(err); ok {
+			http.Error(w, err.Error(), status)
+			return
 		} else {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
@@ -125,7 +247,7 @@ func (s *Server) routePostFunc(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// encode the content to the response
-	if err := json.NewEncoder(w).Encode(content); err != nil {
+	if err := respCodec.Encode(w, content); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -140,6 +262,11 @@ func (s *Server) routeDeleteFunc(w http.ResponseWriter, r *http.Request) {
 
 	relPath := strings.TrimPrefix(r.URL.Path, "/")
 
+	if err := validatePath(relPath); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	err = s.Remove(r.Context(), relPath, r.URL.Query()["key"]...)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -157,6 +284,266 @@ func (s *Server) routeDeleteFunc(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+func (s *Server) routeIncrementFunc(w http.ResponseWriter, r *http.Request) {
+	relPath := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/"), ":increment")
+	dir, key := path.Split(relPath)
+	dir = strings.TrimSuffix(dir, "/")
+
+	if err := validatePath(dir); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	codec, err := negotiateCodec(r.Header.Get("Accept"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotAcceptable)
+		return
+	}
+
+	q := r.URL.Query()
+	if key == "" || q.Get("field") == "" {
+		http.Error(w, "increment requires a key and the field query parameter", http.StatusBadRequest)
+		return
+	}
+
+	by := 1.0
+	if q.Has("by") {
+		by, err = parseFinite(q.Get("by"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	callOpts := []CallOpt{}
+	if q.Has("min") {
+		min, err := parseFinite(q.Get("min"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		callOpts = append(callOpts, WithMin(min))
+	}
+	if q.Has("max") {
+		max, err := parseFinite(q.Get("max"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		callOpts = append(callOpts, WithMax(max))
+	}
+
+	content, err := s.Increment(r.Context(), dir, key, q.Get("field"), by, callOpts...)
+	if err != nil {
+		if errors.Is(err, ErrNotNumeric) {
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	err = s.triggerZip(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeContent(w, codec, http.StatusOK, content)
+
+	if s.MetricsOptions.Enabled {
+		s.MetricsOptions.PotWrites.Add(r.Context(), 1, metric.WithAttributes(attribute.String("path", dir)))
+	}
+}
+
+func (s *Server) routeIndexFunc(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+
+	codec, err := negotiateCodec(r.Header.Get("Accept"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotAcceptable)
+		return
+	}
+
+	if !r.URL.Query().Has("value") {
+		http.Error(w, "missing value query parameter", http.StatusBadRequest)
+		return
+	}
+
+	content, err := s.Query(r.Context(), name, r.URL.Query().Get("value"))
+	if err != nil {
+		if errors.Is(err, ErrUnknownIndex) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// only the matches the caller may read are returned
+	content.Matches = slices.DeleteFunc(content.Matches, func(m IndexMatch) bool {
+		return !s.permitted(r.Context(), PermissionRead, m.Path)
+	})
+
+	writeContent(w, codec, http.StatusOK, content)
+}
+
+// parseFinite parses a number of the query. Infinities and NaN are rejected,
+// since they can't be stored in JSON documents.
+func parseFinite(value string) (float64, error) {
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, err
+	}
+
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		return 0, fmt.Errorf("%s is not a finite number", value)
+	}
+
+	return f, nil
+}
+
+func (s *Server) routeRebuildIndexFunc(w http.ResponseWriter, r *http.Request) {
+	codec, err := negotiateCodec(r.Header.Get("Accept"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotAcceptable)
+		return
+	}
+
+	content, err := s.RebuildIndex(r.Context(), mux.Vars(r)["name"])
+	if err != nil {
+		if errors.Is(err, ErrUnknownIndex) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeContent(w, codec, http.StatusOK, content)
+}
+
+func (s *Server) routeImportFunc(w http.ResponseWriter, r *http.Request) {
+	prefix := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/"), ":import")
+
+	if err := validatePath(prefix); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	codec, err := negotiateCodec(r.Header.Get("Accept"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotAcceptable)
+		return
+	}
+
+	policy := ConflictOverwrite
+	if r.URL.Query().Has("conflict") {
+		policy = ConflictPolicy(r.URL.Query().Get("conflict"))
+	}
+	if err := policy.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	content, err := s.Import(r.Context(), prefix, r.Body, policy)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrInvalidRecord):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, ErrImportConflict):
+			http.Error(w, err.Error(), http.StatusConflict)
+		case errors.Is(err, ErrForbidden):
+			http.Error(w, err.Error(), http.StatusForbidden)
+		default:
+			if status, ok := limitStatus(err); ok {
+				http.Error(w, err.Error(), status)
+				return
+			}
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	err = s.triggerZip(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeContent(w, codec, http.StatusOK, content)
+
+	if s.MetricsOptions.Enabled {
+		s.MetricsOptions.PotWrites.Add(r.Context(), int64(content.Imported), metric.WithAttributes(attribute.String("path", prefix)))
+	}
+}
+
+func (s *Server) routeExportFunc(w http.ResponseWriter, r *http.Request) {
+	prefix := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/"), ":export")
+
+	if err := validatePath(prefix); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// the export is streamed to the response, so once the first bytes are sent
+	// the status can't be changed anymore and the error can only be logged
+	w.Header().Set("Content-Type", contentTypeNDJSON)
+	rw := &responseTracker{ResponseWriter: w}
+	if err := s.Export(r.Context(), prefix, rw); err != nil {
+		if !rw.written {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		slog.Error("failed to export pots", slog.String("path", prefix), slog.String("error", err.Error()))
+		return
+	}
+
+	if s.MetricsOptions.Enabled {
+		s.MetricsOptions.PotReads.Add(r.Context(), 1, metric.WithAttributes(attribute.String("path", prefix)))
+	}
+}
+
+func (s *Server) routeSnapshotFunc(w http.ResponseWriter, r *http.Request) {
+	// the snapshot is streamed to the response, so once the first bytes are sent
+	// the status can't be changed anymore and the error can only be logged
+	w.Header().Set("Content-Type", "application/gzip")
+	rw := &responseTracker{ResponseWriter: w}
+	if _, err := s.Snapshot(r.Context(), rw); err != nil {
+		if !rw.written {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		slog.Error("failed to snapshot pots", slog.String("error", err.Error()))
+	}
+}
+
+func (s *Server) routeRestoreFunc(w http.ResponseWriter, r *http.Request) {
+	codec, err := negotiateCodec(r.Header.Get("Accept"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotAcceptable)
+		return
+	}
+
+	content, err := s.Restore(r.Context(), r.Body, r.URL.Query().Has("dryrun"))
+	if err != nil {
+		if errors.Is(err, ErrInvalidSnapshot) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeContent(w, codec, http.StatusOK, content)
+}
+
 func (s *Server) triggerZip(ctx context.Context) error {
 	if s.zip != "" {
 		return s.Zip(ctx, s.zip)
@@ -164,3 +551,25 @@ func (s *Server) triggerZip(ctx context.Context) error {
 
 	return nil
 }
+
+// writeContent encodes the content to the response using the given codec.
+func writeContent(w http.ResponseWriter, codec Codec, status int, content any) {
+	w.Header().Set("Content-Type", codec.ContentType())
+	w.WriteHeader(status)
+
+	if err := codec.Encode(w, content); err != nil {
+		slog.Error("failed to encode response", slog.String("error", err.Error()))
+	}
+}
+
+// responseTracker records whether any part of the response was already sent.
+type responseTracker struct {
+	http.ResponseWriter
+
+	written bool
+}
+
+func (t *responseTracker) Write(b []byte) (int, error) {
+	t.written = true
+	return t.ResponseWriter.Write(b)
+}
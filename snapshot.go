@@ -0,0 +1,599 @@
+package pot
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"go.opentelemetry.io/otel/attribute"
+	"google.golang.org/api/iterator"
+)
+
+var (
+	ErrInvalidSnapshot = errors.New("invalid snapshot")
+)
+
+const (
+	// snapshotVersion is the version of the snapshot format
+	snapshotVersion = 1
+
+	// snapshotManifest is the name of the archive entry holding the manifest.
+	// It is the last entry of the archive, since the checksums are known only
+	// after all objects are written.
+	snapshotManifest = "manifest.json"
+
+	// snapshotObjects is the archive directory holding the stored objects
+	snapshotObjects = "objects/"
+)
+
+var crc32cTable = crc32.MakeTable(crc32.Castagnoli)
+
+// SnapshotManifest describes the objects captured by a snapshot.
+type SnapshotManifest struct {
+	Version int             `json:"version"`
+	Created time.Time       `json:"created"`
+	Objects []SnapshotEntry `json:"objects"`
+}
+
+// SnapshotEntry is a single object captured by a snapshot. Objects are captured
+// exactly as stored, so compressed and encrypted pots stay that way and their
+// metadata is needed to read them after a restore.
+type SnapshotEntry struct {
+	Name            string            `json:"name"`
+	Generation      int64             `json:"generation"`
+	Size            int64             `json:"size"`
+	SHA256          string            `json:"sha256"`
+	CRC32C          uint32            `json:"crc32c"`
+	ContentType     string            `json:"contentType,omitempty"`
+	ContentEncoding string            `json:"contentEncoding,omitempty"`
+	Metadata        map[string]string `json:"metadata,omitempty"`
+}
+
+// Restore actions.
+const (
+	RestoreCreate    = "create"
+	RestoreUpdate    = "update"
+	RestoreDelete    = "delete"
+	RestoreUnchanged = "unchanged"
+)
+
+// RestoreChange is the change of a single object made by a restore.
+type RestoreChange struct {
+	Name string `json:"name"`
+
+	// Action is either create, update, delete or unchanged
+	Action string `json:"action"`
+}
+
+// RestoreResponse is the response returned by the Restore method.
+type RestoreResponse struct {
+	DryRun  bool            `json:"dryRun"`
+	Changes []RestoreChange `json:"changes"`
+}
+
+// isSnapshotObject checks whether the object is captured by snapshots. Only the
+// pots and the index objects are captured, locks, bundles, audit events and
+// the pots under the other .pot directories of the server are not. Restores
+// only write and delete these objects, whatever the archive lists.
+func isSnapshotObject(name string) bool {
+	if path.Clean(name) != name || strings.HasPrefix(name, "/") {
+		return false
+	}
+
+	if rest, ok := strings.CutPrefix(name, indexDir+"/"); ok {
+		index, value, ok := strings.Cut(rest, "/")
+		return ok && indexNamePattern.MatchString(index) && !strings.Contains(value, "/") && strings.HasSuffix(value, ".json")
+	}
+
+	if name != "data.json" && !strings.HasSuffix(name, "/data.json") {
+		return false
+	}
+
+	for _, elem := range strings.Split(path.Dir(name), "/") {
+		if elem == ".." || strings.HasPrefix(elem, ".pot") {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Snapshot writes a tar.gz archive of all pots and indexes to the writer. Each
+// pot is captured while holding its read lock, and the archive ends with a
+// manifest recording the generation and checksums of every captured object.
+func (s *Server) Snapshot(ctx context.Context, w io.Writer) (*SnapshotManifest, error) {
+	ctx, fullEnd := s.trace(ctx, "snapshot")
+	defer fullEnd()
+
+	manifest := &SnapshotManifest{
+		Version: snapshotVersion,
+		Created: time.Now().UTC(),
+		Objects: []SnapshotEntry{},
+	}
+
+	gzw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gzw)
+
+	names := []string{}
+	objList := s.bucket.Objects(ctx, &storage.Query{})
+	for {
+		obj, err := objList.Next()
+		if errors.Is(err, iterator.Done) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if isSnapshotObject(obj.Name) {
+			names = append(names, obj.Name)
+		}
+	}
+
+	for _, name := range names {
+		entry, err := s.snapshotObject(ctx, tw, name)
+		if err != nil {
+			return nil, err
+		}
+		if entry != nil {
+			manifest.Objects = append(manifest.Objects, *entry)
+		}
+	}
+
+	b, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	hdr := &tar.Header{
+		Name:    snapshotManifest,
+		Mode:    0o644,
+		Size:    int64(len(b)),
+		ModTime: manifest.Created,
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return nil, err
+	}
+	if _, err := tw.Write(b); err != nil {
+		return nil, err
+	}
+
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+
+	if err := gzw.Close(); err != nil {
+		return nil, err
+	}
+
+	s.recordAudit(ctx, &AuditEvent{Action: AuditSnapshot})
+	return manifest, nil
+}
+
+// snapshotObject copies the stored object into the archive. Pots are spooled to
+// a temporary file while holding their read lock, so the lock isn't held while
+// the archive is being sent. A nil entry is returned if the object was removed
+// since it was listed.
+func (s *Server) snapshotObject(ctx context.Context, tw *tar.Writer, name string) (*SnapshotEntry, error) {
+	tmp, err := os.CreateTemp("", "pot-snapshot-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	entry, err := s.spoolObject(ctx, tmp, name)
+	if err != nil || entry == nil {
+		return nil, err
+	}
+
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	hdr := &tar.Header{
+		Name:    snapshotObjects + name,
+		Mode:    0o644,
+		Size:    entry.Size,
+		ModTime: time.Now().UTC(),
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(tw, tmp); err != nil {
+		return nil, err
+	}
+
+	return entry, nil
+}
+
+// spoolObject copies the object content as stored to the writer while holding
+// the read lock of its pot, and returns its snapshot entry.
+func (s *Server) spoolObject(ctx context.Context, w io.Writer, name string) (*SnapshotEntry, error) {
+	if dir, isPot := snapshotPotDir(name); isPot {
+		s.localRLock(ctx, dir)
+		defer s.localRUnlock(dir)
+	}
+
+	obj := s.bucket.Object(name)
+	attrs, err := obj.Attrs(ctx)
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// the content is read as stored and pinned to the generation the metadata
+	// belongs to
+	reader, err := obj.Generation(attrs.Generation).ReadCompressed(true).NewReader(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	sha := sha256.New()
+	crc := crc32.New(crc32cTable)
+	size, err := io.Copy(io.MultiWriter(w, sha, crc), reader)
+	if err != nil {
+		return nil, err
+	}
+
+	if crc.Sum32() != attrs.CRC32C {
+		return nil, fmt.Errorf("checksum mismatch of %s", name)
+	}
+
+	return &SnapshotEntry{
+		Name:            name,
+		Generation:      attrs.Generation,
+		Size:            size,
+		SHA256:          hex.EncodeToString(sha.Sum(nil)),
+		CRC32C:          attrs.CRC32C,
+		ContentType:     attrs.ContentType,
+		ContentEncoding: attrs.ContentEncoding,
+		Metadata:        attrs.Metadata,
+	}, nil
+}
+
+// Restore replays the snapshot archive read from r into the bucket. The whole
+// archive is verified against its manifest before any object is written, and
+// only the objects that differ from the stored ones are written. Pots and
+// index objects missing from the snapshot are deleted, so the bucket matches
+// the snapshot afterwards. If dryRun is set, the changes are only reported.
+func (s *Server) Restore(ctx context.Context, r io.Reader, dryRun bool) (*RestoreResponse, error) {
+	ctx, fullEnd := s.trace(ctx, "restore", attribute.Bool("dryrun", dryRun))
+	defer fullEnd()
+
+	tmp, err := os.CreateTemp("", "pot-restore-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		return nil, err
+	}
+
+	manifest, err := verifySnapshot(tmp)
+	if err != nil {
+		return nil, err
+	}
+
+	stored, err := s.snapshotObjects(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &RestoreResponse{
+		DryRun:  dryRun,
+		Changes: restoreChanges(manifest, stored),
+	}
+
+	if dryRun {
+		return res, nil
+	}
+
+	entries := map[string]SnapshotEntry{}
+	for _, entry := range manifest.Objects {
+		entries[entry.Name] = entry
+	}
+
+	writes := map[string]bool{}
+	for _, change := range res.Changes {
+		if change.Action == RestoreCreate || change.Action == RestoreUpdate {
+			writes[change.Name] = true
+		}
+	}
+
+	if len(writes) > 0 {
+		err = eachSnapshotObject(tmp, func(name string, content io.Reader) error {
+			if !writes[name] {
+				return nil
+			}
+
+			return s.restoreObject(ctx, entries[name], content)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, change := range res.Changes {
+		if change.Action != RestoreDelete {
+			continue
+		}
+
+		if err := s.restoreDelete(ctx, change.Name); err != nil {
+			return nil, err
+		}
+	}
+
+	return res, nil
+}
+
+// snapshotObjects returns the attributes of the stored objects captured by
+// snapshots by their names.
+func (s *Server) snapshotObjects(ctx context.Context) (map[string]*storage.ObjectAttrs, error) {
+	stored := map[string]*storage.ObjectAttrs{}
+
+	objList := s.bucket.Objects(ctx, &storage.Query{})
+	for {
+		attrs, err := objList.Next()
+		if errors.Is(err, iterator.Done) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if isSnapshotObject(attrs.Name) {
+			stored[attrs.Name] = attrs
+		}
+	}
+
+	return stored, nil
+}
+
+// restoreChanges compares the snapshot with the stored objects. Objects of the
+// snapshot are created or updated, and the stored objects missing from the
+// snapshot, e.g. pots created after it was taken, are deleted.
+func restoreChanges(manifest *SnapshotManifest, stored map[string]*storage.ObjectAttrs) []RestoreChange {
+	changes := []RestoreChange{}
+
+	captured := map[string]bool{}
+	for _, entry := range manifest.Objects {
+		captured[entry.Name] = true
+
+		attrs, ok := stored[entry.Name]
+		switch {
+		case !ok:
+			changes = append(changes, RestoreChange{Name: entry.Name, Action: RestoreCreate})
+		case attrs.CRC32C == entry.CRC32C && attrs.Size == entry.Size:
+			changes = append(changes, RestoreChange{Name: entry.Name, Action: RestoreUnchanged})
+		default:
+			changes = append(changes, RestoreChange{Name: entry.Name, Action: RestoreUpdate})
+		}
+	}
+
+	for _, name := range sortedKeys(stored) {
+		if !captured[name] {
+			changes = append(changes, RestoreChange{Name: name, Action: RestoreDelete})
+		}
+	}
+
+	return changes
+}
+
+// snapshotPotDir returns the path of the pot stored in the snapshot object,
+// false for index objects.
+func snapshotPotDir(name string) (string, bool) {
+	if strings.HasPrefix(name, indexDir+"/") {
+		return "", false
+	}
+
+	dir := path.Dir(name)
+	if dir == "." {
+		dir = ""
+	}
+
+	return dir, true
+}
+
+// restoreDelete deletes the object missing from the snapshot. Pots are deleted
+// while holding their lock and dropped from the cache.
+func (s *Server) restoreDelete(ctx context.Context, name string) error {
+	dir, isPot := snapshotPotDir(name)
+	if isPot {
+		unlock, err := s.lockPath(ctx, dir, "restore")
+		if err != nil {
+			return err
+		}
+		defer unlock()
+
+		if s.cache != nil {
+			s.cache.remove(dir)
+		}
+	}
+
+	err := s.bucket.Object(name).Delete(ctx)
+	if err != nil && !errors.Is(err, storage.ErrObjectNotExist) {
+		return err
+	}
+
+	// the pot doesn't exist after the restore, so the event has no hashes
+	if isPot {
+		s.watchers.notify(dir)
+		s.recordAudit(ctx, &AuditEvent{Action: AuditRestore, Path: dir})
+	}
+
+	return nil
+}
+
+// restoreObject writes the captured object as it was stored. Pots are written
+// while holding their lock and dropped from the cache.
+func (s *Server) restoreObject(ctx context.Context, entry SnapshotEntry, content io.Reader) error {
+	dir, isPot := snapshotPotDir(entry.Name)
+	if isPot {
+		unlock, err := s.lockPath(ctx, dir, "restore")
+		if err != nil {
+			return err
+		}
+		defer unlock()
+
+		if s.cache != nil {
+			s.cache.remove(dir)
+		}
+	}
+
+	writeCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	w := s.bucket.Object(entry.Name).NewWriter(writeCtx)
+	w.ContentType = entry.ContentType
+	w.ContentEncoding = entry.ContentEncoding
+	w.Metadata = entry.Metadata
+	w.CRC32C = entry.CRC32C
+	w.SendCRC32C = true
+
+	if _, err := io.Copy(w, content); err != nil {
+		return err
+	}
+
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	// the pot is recorded as a whole, its documents may be encrypted
+	if isPot {
+		s.watchers.notify(dir)
+		s.recordAudit(ctx, &AuditEvent{
+			Action:     AuditRestore,
+			Path:       dir,
+			After:      map[string]string{path.Base(entry.Name): entry.SHA256},
+			Generation: w.Attrs().Generation,
+		})
+	}
+
+	return nil
+}
+
+// verifySnapshot checks that the archive holds exactly the objects listed in
+// its manifest with matching checksums, and returns the manifest.
+func verifySnapshot(r io.ReadSeeker) (*SnapshotManifest, error) {
+	var manifest *SnapshotManifest
+	sums := map[string]string{}
+
+	err := eachSnapshotEntry(r, func(hdr *tar.Header, content io.Reader) error {
+		if hdr.Name == snapshotManifest {
+			manifest = &SnapshotManifest{}
+			if err := json.NewDecoder(content).Decode(manifest); err != nil {
+				return fmt.Errorf("%w: %s", ErrInvalidSnapshot, err)
+			}
+			return nil
+		}
+
+		name, ok := strings.CutPrefix(hdr.Name, snapshotObjects)
+		if !ok || !isSnapshotObject(name) {
+			return fmt.Errorf("%w: unexpected entry %s", ErrInvalidSnapshot, hdr.Name)
+		}
+
+		sha := sha256.New()
+		if _, err := io.Copy(sha, content); err != nil {
+			return fmt.Errorf("%w: %s", ErrInvalidSnapshot, err)
+		}
+		sums[name] = hex.EncodeToString(sha.Sum(nil))
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if manifest == nil {
+		return nil, fmt.Errorf("%w: missing manifest", ErrInvalidSnapshot)
+	}
+	if manifest.Version != snapshotVersion {
+		return nil, fmt.Errorf("%w: unsupported version %d", ErrInvalidSnapshot, manifest.Version)
+	}
+
+	listed := map[string]bool{}
+	for _, entry := range manifest.Objects {
+		if !isSnapshotObject(entry.Name) {
+			return nil, fmt.Errorf("%w: %s is not a pot or an index object", ErrInvalidSnapshot, entry.Name)
+		}
+		if sums[entry.Name] != entry.SHA256 {
+			return nil, fmt.Errorf("%w: checksum mismatch of %s", ErrInvalidSnapshot, entry.Name)
+		}
+		listed[entry.Name] = true
+	}
+	for name := range sums {
+		if !listed[name] {
+			return nil, fmt.Errorf("%w: %s is not in the manifest", ErrInvalidSnapshot, name)
+		}
+	}
+
+	sort.Slice(manifest.Objects, func(i, j int) bool {
+		return manifest.Objects[i].Name < manifest.Objects[j].Name
+	})
+
+	return manifest, nil
+}
+
+// eachSnapshotObject calls fn with the name and content of every object in
+// the archive.
+func eachSnapshotObject(r io.ReadSeeker, fn func(name string, content io.Reader) error) error {
+	return eachSnapshotEntry(r, func(hdr *tar.Header, content io.Reader) error {
+		name, ok := strings.CutPrefix(hdr.Name, snapshotObjects)
+		if !ok {
+			return nil
+		}
+
+		return fn(name, content)
+	})
+}
+
+// eachSnapshotEntry reads the archive from its start and calls fn for every
+// regular file in it.
+func eachSnapshotEntry(r io.ReadSeeker, fn func(hdr *tar.Header, content io.Reader) error) error {
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	gzr, err := gzip.NewReader(r)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidSnapshot, err)
+	}
+	defer gzr.Close()
+
+	tr := tar.NewReader(gzr)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%w: %s", ErrInvalidSnapshot, err)
+		}
+
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		if err := fn(hdr, tr); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package pot
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"testing"
+
+	"cloud.google.com/go/storage"
+	"github.com/stretchr/testify/suite"
+)
+
+type SnapshotSuite struct {
+	suite.Suite
+}
+
+// archive builds a snapshot archive of the objects with the given manifest.
+func (s *SnapshotSuite) archive(objects map[string]string, manifest *SnapshotManifest) *bytes.Reader {
+	var buf bytes.Buffer
+	gzw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gzw)
+
+	write := func(name string, content []byte) {
+		s.Require().NoError(tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(content))}))
+		_, err := tw.Write(content)
+		s.Require().NoError(err)
+	}
+
+	for _, name := range sortedKeys(objects) {
+		write(snapshotObjects+name, []byte(objects[name]))
+	}
+	if manifest != nil {
+		b, err := json.Marshal(manifest)
+		s.Require().NoError(err)
+		write(snapshotManifest, b)
+	}
+
+	s.Require().NoError(tw.Close())
+	s.Require().NoError(gzw.Close())
+
+	return bytes.NewReader(buf.Bytes())
+}
+
+func (s *SnapshotSuite) manifest(objects map[string]string) *SnapshotManifest {
+	manifest := &SnapshotManifest{Version: snapshotVersion}
+	for _, name := range sortedKeys(objects) {
+		sum := sha256.Sum256([]byte(objects[name]))
+		manifest.Objects = append(manifest.Objects, SnapshotEntry{
+			Name:   name,
+			Size:   int64(len(objects[name])),
+			SHA256: hex.EncodeToString(sum[:]),
+		})
+	}
+	return manifest
+}
+
+func (s *SnapshotSuite) TestVerify() {
+	objects := map[string]string{
+		"users/data.json":         `{"1":{"id":"1"}}`,
+		".potindex/name/bob.json": `{"users":["1"]}`,
+	}
+
+	manifest, err := verifySnapshot(s.archive(objects, s.manifest(objects)))
+	s.Require().NoError(err)
+	s.Len(manifest.Objects, 2)
+
+	read := map[string]string{}
+	err = eachSnapshotObject(s.archive(objects, manifest), func(name string, content io.Reader) error {
+		b, err := io.ReadAll(content)
+		read[name] = string(b)
+		return err
+	})
+	s.Require().NoError(err)
+	s.Equal(objects, read)
+}
+
+func (s *SnapshotSuite) TestVerifyRejectsInvalid() {
+	objects := map[string]string{"users/data.json": `{"1":{"id":"1"}}`}
+
+	s.Run("missing manifest", func() {
+		_, err := verifySnapshot(s.archive(objects, nil))
+		s.ErrorIs(err, ErrInvalidSnapshot)
+	})
+
+	s.Run("modified object", func() {
+		modified := map[string]string{"users/data.json": `{"1":{"id":"2"}}`}
+		_, err := verifySnapshot(s.archive(modified, s.manifest(objects)))
+		s.ErrorIs(err, ErrInvalidSnapshot)
+	})
+
+	s.Run("missing object", func() {
+		_, err := verifySnapshot(s.archive(map[string]string{}, s.manifest(objects)))
+		s.ErrorIs(err, ErrInvalidSnapshot)
+	})
+
+	s.Run("unlisted object", func() {
+		extra := map[string]string{"users/data.json": objects["users/data.json"], "other/data.json": `{}`}
+		_, err := verifySnapshot(s.archive(extra, s.manifest(objects)))
+		s.ErrorIs(err, ErrInvalidSnapshot)
+	})
+
+	s.Run("unknown version", func() {
+		manifest := s.manifest(objects)
+		manifest.Version = 2
+		_, err := verifySnapshot(s.archive(objects, manifest))
+		s.ErrorIs(err, ErrInvalidSnapshot)
+	})
+
+	s.Run("not an archive", func() {
+		_, err := verifySnapshot(bytes.NewReader([]byte("data")))
+		s.ErrorIs(err, ErrInvalidSnapshot)
+	})
+}
+
+func (s *SnapshotSuite) TestVerifyRejectsHostile() {
+	// the archives are consistent, only the names of the objects are hostile
+	cases := []struct {
+		caseName string
+		name     string
+	}{
+		{"audit event", ".potaudit/users/0000000000000000001-ab.json"},
+		{"audit pot", ".potaudit/data.json"},
+		{"lock", "users/.potlock"},
+		{"bundle", "bundle.zip"},
+		{"policy", "policies/pot.rego"},
+		{"parent directory", "../data.json"},
+		{"unclean path", "users/../../data.json"},
+		{"absolute path", "/users/data.json"},
+		{"index escape", ".potindex/../users/data.json"},
+		{"nested index object", ".potindex/name/a/b.json"},
+	}
+
+	for _, c := range cases {
+		s.Run(c.caseName, func() {
+			objects := map[string]string{"users/data.json": `{}`, c.name: `{}`}
+			_, err := verifySnapshot(s.archive(objects, s.manifest(objects)))
+			s.ErrorIs(err, ErrInvalidSnapshot)
+		})
+
+		s.Run(c.caseName+" in manifest", func() {
+			// the manifest lists the object without the archive holding it
+			manifest := s.manifest(map[string]string{"users/data.json": `{}`, c.name: `{}`})
+			_, err := verifySnapshot(s.archive(map[string]string{"users/data.json": `{}`}, manifest))
+			s.ErrorIs(err, ErrInvalidSnapshot)
+			s.ErrorContains(err, "not a pot or an index object")
+		})
+	}
+}
+
+func (s *SnapshotSuite) TestRestoreChanges() {
+	manifest := &SnapshotManifest{
+		Version: snapshotVersion,
+		Objects: []SnapshotEntry{
+			{Name: "teams/red/data.json", Size: 10, CRC32C: 1},
+			{Name: "teams/blue/data.json", Size: 10, CRC32C: 2},
+			{Name: "users/data.json", Size: 10, CRC32C: 3},
+			{Name: ".potindex/owner/alice.json", Size: 5, CRC32C: 4},
+		},
+	}
+
+	// teams/green and its index entry were created after the snapshot was taken
+	stored := map[string]*storage.ObjectAttrs{
+		"teams/red/data.json":        {Name: "teams/red/data.json", Size: 10, CRC32C: 1},
+		"teams/blue/data.json":       {Name: "teams/blue/data.json", Size: 12, CRC32C: 5},
+		"teams/green/data.json":      {Name: "teams/green/data.json", Size: 10, CRC32C: 6},
+		".potindex/owner/alice.json": {Name: ".potindex/owner/alice.json", Size: 5, CRC32C: 4},
+		".potindex/owner/bob.json":   {Name: ".potindex/owner/bob.json", Size: 5, CRC32C: 7},
+	}
+
+	s.Equal([]RestoreChange{
+		{Name: "teams/red/data.json", Action: RestoreUnchanged},
+		{Name: "teams/blue/data.json", Action: RestoreUpdate},
+		{Name: "users/data.json", Action: RestoreCreate},
+		{Name: ".potindex/owner/alice.json", Action: RestoreUnchanged},
+		{Name: ".potindex/owner/bob.json", Action: RestoreDelete},
+		{Name: "teams/green/data.json", Action: RestoreDelete},
+	}, restoreChanges(manifest, stored))
+}
+
+func (s *SnapshotSuite) TestSnapshotPotDir() {
+	dir, ok := snapshotPotDir("teams/red/data.json")
+	s.True(ok)
+	s.Equal("teams/red", dir)
+
+	dir, ok = snapshotPotDir("data.json")
+	s.True(ok)
+	s.Equal("", dir)
+
+	_, ok = snapshotPotDir(".potindex/owner/alice.json")
+	s.False(ok)
+}
+
+func (s *SnapshotSuite) TestIsSnapshotObject() {
+	s.True(isSnapshotObject("data.json"))
+	s.True(isSnapshotObject("users/eu/data.json"))
+	s.True(isSnapshotObject(".potindex/name/bob.json"))
+	s.False(isSnapshotObject("users/.potlock"))
+	s.False(isSnapshotObject("users/.potlock/data.json"))
+	s.False(isSnapshotObject("bundle/bundle.tar.gz"))
+	s.False(isSnapshotObject(".potaudit/data.json"))
+	s.False(isSnapshotObject(".potindex/name/a/b.json"))
+	s.False(isSnapshotObject("users//data.json"))
+	s.False(isSnapshotObject("../data.json"))
+}
+
+func TestSnapshotSuite(t *testing.T) {
+	suite.Run(t, new(SnapshotSuite))
+}
@@ -0,0 +1,366 @@
+package pot
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	"cloud.google.com/go/storage"
+)
+
+var (
+	ErrMalformedPot = errors.New("pot is not a valid JSON object")
+)
+
+// eachDocument walks the top-level object of a pot and calls fn for every key
+// with the raw encoded document. Only a single document is held in memory at
+// a time, which keeps the memory usage flat regardless of the pot size.
+func eachDocument(r io.Reader, fn func(key string, doc json.RawMessage) error) error {
+	dec := json.NewDecoder(r)
+
+	tok, err := dec.Token()
+	// an empty object file is treated the same way as an empty pot
+	if errors.Is(err, io.EOF) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if delim, ok := tok.(json.Delim); !ok || delim != '{' {
+		return ErrMalformedPot
+	}
+
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+
+		key, ok := tok.(string)
+		if !ok {
+			return ErrMalformedPot
+		}
+
+		var doc json.RawMessage
+		if err := dec.Decode(&doc); err != nil {
+			return err
+		}
+
+		if err := fn(key, doc); err != nil {
+			return err
+		}
+	}
+
+	// consume the closing delimiter of the object
+	if _, err := dec.Token(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// docEncoder writes documents one by one as a single JSON object, producing
+// the same format as encoding the whole pot map at once.
+type docEncoder struct {
+	w io.Writer
+	n int
+}
+
+func newDocEncoder(w io.Writer) *docEncoder {
+	return &docEncoder{w: w}
+}
+
+// Encode writes a single key and its raw encoded document.
+func (e *docEncoder) Encode(key string, doc json.RawMessage) error {
+	k, err := json.Marshal(key)
+	if err != nil {
+		return err
+	}
+
+	sep := ","
+	if e.n == 0 {
+		sep = "{"
+	}
+	e.n++
+
+	if _, err := io.WriteString(e.w, sep); err != nil {
+		return err
+	}
+	if _, err := e.w.Write(k); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(e.w, ":"); err != nil {
+		return err
+	}
+	_, err = e.w.Write(doc)
+	return err
+}
+
+// Close terminates the object. An encoder that didn't write any document
+// produces an empty object.
+func (e *docEncoder) Close() error {
+	if e.n == 0 {
+		_, err := io.WriteString(e.w, "{}\n")
+		return err
+	}
+
+	_, err := io.WriteString(e.w, "}\n")
+	return err
+}
+
+// marshalDocuments encodes every document of the given map so it can be
+// written by the docEncoder.
+func marshalDocuments(objs map[string]any) (map[string]json.RawMessage, error) {
+	docs := make(map[string]json.RawMessage, len(objs))
+	for k, v := range objs {
+		b, err := json.Marshal(v)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode %s: %w", k, err)
+		}
+		docs[k] = b
+	}
+
+	return docs, nil
+}
+
+// sortedKeys returns keys of the map in a stable order so new documents are
+// always appended to the pot deterministically.
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// potReader reads the decoded content of a pot.
+type potReader struct {
+	io.Reader
+
+	// Attrs are the attributes of the stored pot object
+	Attrs storage.ReaderObjectAttrs
+
+	// fields is the envelope of pots with encrypted fields, nil otherwise
+	fields *envelope
+
+	closers []io.Closer
+}
+
+// Each calls fn for every document of the pot, see eachDocument.
+func (r *potReader) Each(fn func(key string, doc json.RawMessage) error) error {
+	if r.fields == nil {
+		return eachDocument(r, fn)
+	}
+
+	return eachDocument(r, func(key string, doc json.RawMessage) error {
+		doc, err := r.fields.openFields(key, doc)
+		if err != nil {
+			return err
+		}
+
+		return fn(key, doc)
+	})
+}
+
+// Close releases the decoders and the underlying object reader.
+func (r *potReader) Close() error {
+	var errs []error
+	for i := len(r.closers) - 1; i >= 0; i-- {
+		errs = append(errs, r.closers[i].Close())
+	}
+
+	return errors.Join(errs...)
+}
+
+// openPot opens the pot on the given path for reading. A nil reader is returned
+// when the pot doesn't exist yet. Pots are read as stored and decrypted and
+// decompressed based on their metadata.
+func (s *Server) openPot(ctx context.Context, dir string) (*potReader, error) {
+	return s.openPotGeneration(ctx, dir, 0)
+}
+
+// openPotGeneration opens the given generation of the pot for reading, or the
+// latest one if the generation is zero.
+func (s *Server) openPotGeneration(ctx context.Context, dir string, generation int64) (*potReader, error) {
+	obj := s.bucket.Object(s.potPath(dir))
+	if generation > 0 {
+		obj = obj.Generation(generation)
+	}
+
+	reader, err := obj.ReadCompressed(true).NewReader(ctx)
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	pr := &potReader{
+		Attrs:   reader.Attrs,
+		closers: []io.Closer{reader},
+	}
+
+	var r io.Reader = reader
+	contentEncoding := reader.Attrs.ContentEncoding
+
+	// the metadata of encrypted pots is fetched separately, since it is not part
+	// of the reader attributes. The generation is pinned to the one being read.
+	if isEncrypted(reader.Attrs.ContentType) {
+		attrs, err := obj.Generation(reader.Attrs.Generation).Attrs(ctx)
+		if err != nil {
+			pr.Close()
+			return nil, err
+		}
+
+		env, err := openEnvelope(ctx, s.encryption.keys, obj.ObjectName(), attrs.Metadata)
+		if err != nil {
+			pr.Close()
+			return nil, err
+		}
+
+		if reader.Attrs.ContentType == contentTypeEncrypted {
+			r = env.newOpenReader(r)
+			contentEncoding = attrs.Metadata[metadataCompression]
+		} else {
+			pr.fields = env
+		}
+	}
+
+	dec, err := decompressReader(r, contentEncoding)
+	if err != nil {
+		pr.Close()
+		return nil, err
+	}
+
+	pr.Reader = dec
+	pr.closers = append(pr.closers, dec)
+	return pr, nil
+}
+
+// potWriter streams the new content of a pot to the bucket document by document.
+// The previous content stays untouched until the writer is successfully closed.
+type potWriter struct {
+	obj  *storage.Writer
+	docs *docEncoder
+
+	// fields is the envelope used to encrypt the document fields, nil if the
+	// fields are stored as is
+	fields  *envelope
+	closers []io.Closer
+	cancel  context.CancelFunc
+
+	// limit fails the write once the pot exceeds the limits, nil if the pot
+	// is not limited
+	limit *potLimiter
+}
+
+func (s *Server) newPotWriter(ctx context.Context, dir string) (*potWriter, error) {
+	ctx, cancel := context.WithCancel(ctx)
+
+	obj := s.bucket.Object(s.potPath(dir))
+	w := obj.NewWriter(ctx)
+	w.ContentType = "application/json"
+	w.ContentEncoding = string(s.compression)
+
+	pw := &potWriter{
+		obj:    w,
+		cancel: cancel,
+	}
+
+	var out io.Writer = w
+
+	if s.encryption.keys != nil {
+		env, metadata, err := newEnvelope(ctx, s.encryption.keys, obj.ObjectName())
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		w.Metadata = metadata
+
+		if len(s.encryption.fields) == 0 {
+			// encrypted bytes can't be served with a content encoding, so the
+			// compression is recorded in metadata instead
+			w.ContentType = contentTypeEncrypted
+			w.ContentEncoding = ""
+			w.Metadata[metadataCompression] = string(s.compression)
+
+			sw := env.newSealWriter(out)
+			pw.closers = append(pw.closers, sw)
+			out = sw
+		} else {
+			if err := env.encryptFields(s.encryption.fields, w.Metadata); err != nil {
+				cancel()
+				return nil, err
+			}
+
+			w.ContentType = contentTypeEncryptedFields
+			pw.fields = env
+		}
+	}
+
+	enc, err := compressWriter(out, s.compression)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	if enc != nil {
+		pw.closers = append(pw.closers, enc)
+		out = enc
+	}
+
+	pw.docs = newDocEncoder(out)
+	return pw, nil
+}
+
+// Encode writes a single document to the pot.
+func (w *potWriter) Encode(key string, doc json.RawMessage) error {
+	if w.limit != nil {
+		if err := w.limit.add(key, doc); err != nil {
+			return err
+		}
+	}
+
+	if w.fields != nil {
+		var err error
+		doc, err = w.fields.sealFields(key, doc)
+		if err != nil {
+			return err
+		}
+	}
+
+	return w.docs.Encode(key, doc)
+}
+
+// Abort discards everything written so far.
+func (w *potWriter) Abort() {
+	w.cancel()
+}
+
+// Close finishes the upload and replaces the pot.
+func (w *potWriter) Close() error {
+	defer w.cancel()
+
+	if err := w.docs.Close(); err != nil {
+		return err
+	}
+
+	for i := len(w.closers) - 1; i >= 0; i-- {
+		if err := w.closers[i].Close(); err != nil {
+			return err
+		}
+	}
+
+	return w.obj.Close()
+}
+
+// Attrs returns the attributes of the written pot. It is only valid after
+// the writer was successfully closed.
+func (w *potWriter) Attrs() *storage.ObjectAttrs {
+	return w.obj.Attrs()
+}
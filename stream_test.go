@@ -0,0 +1,77 @@
+package pot
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type StreamSuite struct {
+	suite.Suite
+}
+
+func (s *StreamSuite) TestEachDocument() {
+	cases := []struct {
+		caseName string
+		input    string
+		expected map[string]string
+		err      bool
+	}{
+		{"empty file", "", map[string]string{}, false},
+		{"empty object", "{}\n", map[string]string{}, false},
+		{"documents", `{"a":{"id":"a"},"b":{"id":"b","n":[1,2]}}`, map[string]string{"a": `{"id":"a"}`, "b": `{"id":"b","n":[1,2]}`}, false},
+		{"not an object", `[1,2]`, nil, true},
+		{"truncated", `{"a":{"id":"a"}`, nil, true},
+	}
+
+	for _, c := range cases {
+		s.Run(c.caseName, func() {
+			docs := map[string]string{}
+			err := eachDocument(strings.NewReader(c.input), func(key string, doc json.RawMessage) error {
+				docs[key] = string(doc)
+				return nil
+			})
+
+			if c.err {
+				s.Error(err)
+				return
+			}
+
+			s.NoError(err)
+			s.Equal(c.expected, docs)
+		})
+	}
+}
+
+func (s *StreamSuite) TestDocEncoderMatchesMapEncoding() {
+	content := map[string]any{
+		"b": map[string]any{"id": "b", "age": 42.0},
+		"a": map[string]any{"id": "a", "tags": []any{"x", "y"}},
+	}
+
+	docs, err := marshalDocuments(content)
+	s.Require().NoError(err)
+
+	var buf strings.Builder
+	enc := newDocEncoder(&buf)
+	for _, key := range sortedKeys(docs) {
+		s.Require().NoError(enc.Encode(key, docs[key]))
+	}
+	s.Require().NoError(enc.Close())
+
+	expected, err := json.Marshal(content)
+	s.Require().NoError(err)
+	s.Equal(string(expected)+"\n", buf.String())
+}
+
+func (s *StreamSuite) TestDocEncoderEmpty() {
+	var buf strings.Builder
+	s.Require().NoError(newDocEncoder(&buf).Close())
+	s.Equal("{}\n", buf.String())
+}
+
+func TestStreamSuite(t *testing.T) {
+	suite.Run(t, new(StreamSuite))
+}
@@ -0,0 +1,201 @@
+package pot
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/storage"
+)
+
+const (
+	// defaultWatchInterval is the interval between polls of a watched pot
+	defaultWatchInterval = 2 * time.Second
+
+	// minWatchInterval keeps watches from flooding the bucket with requests
+	minWatchInterval = 100 * time.Millisecond
+)
+
+// Watch actions.
+const (
+	WatchAdded    = "added"
+	WatchModified = "modified"
+	WatchRemoved  = "removed"
+)
+
+// WatchEvent is a change of a single document of a watched pot.
+type WatchEvent struct {
+	Action string `json:"action"`
+	Key    string `json:"key"`
+
+	// Document is the document after the change, nil if it was removed
+	Document json.RawMessage `json:"document,omitempty"`
+}
+
+// Watch calls fn with the changes of the pot until the context is done or fn
+// fails. The current documents are reported as added first. The generation of
+// the pot is polled every interval to observe the writes of other instances,
+// writes of this server are observed immediately.
+func (s *Server) Watch(ctx context.Context, dir string, interval time.Duration, fn func(events []WatchEvent, generation int64) error) error {
+	if interval <= 0 {
+		interval = defaultWatchInterval
+	}
+	interval = max(interval, minWatchInterval)
+
+	wake, unsubscribe := s.watchers.subscribe(dir)
+	defer unsubscribe()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	previous := map[string]json.RawMessage{}
+	generation := int64(-1)
+	for {
+		current, err := s.potGeneration(ctx, dir)
+		if err != nil {
+			return err
+		}
+
+		if current != generation {
+			docs, read, err := s.readDocuments(ctx, dir)
+			if err != nil {
+				return err
+			}
+
+			if events := WatchEvents(previous, docs); len(events) > 0 {
+				if err := fn(events, read); err != nil {
+					return err
+				}
+			}
+
+			// the generation read along with the documents is kept, so writes
+			// in between the two requests are not missed
+			previous, generation = docs, read
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		case <-wake:
+		}
+	}
+}
+
+// potGeneration returns the generation of the stored pot, zero if it doesn't
+// exist. Only the metadata of the pot is requested.
+func (s *Server) potGeneration(ctx context.Context, dir string) (int64, error) {
+	attrs, err := s.bucket.Object(s.potPath(dir)).Attrs(ctx)
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return attrs.Generation, nil
+}
+
+// readDocuments returns the documents of the pot as stored along with its
+// generation.
+func (s *Server) readDocuments(ctx context.Context, dir string) (map[string]json.RawMessage, int64, error) {
+	s.localRLock(ctx, dir)
+	defer s.localRUnlock(dir)
+
+	docs := map[string]json.RawMessage{}
+
+	reader, err := s.openPot(ctx, dir)
+	if err != nil || reader == nil {
+		return docs, 0, err
+	}
+	defer reader.Close()
+
+	err = reader.Each(func(key string, doc json.RawMessage) error {
+		docs[key] = bytes.Clone(doc)
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return docs, reader.Attrs.Generation, nil
+}
+
+// WatchEvents returns the events turning the previous documents into the
+// current ones, ordered by the document keys.
+func WatchEvents(previous, current map[string]json.RawMessage) []WatchEvent {
+	keys := map[string]bool{}
+	for key := range previous {
+		keys[key] = true
+	}
+	for key := range current {
+		keys[key] = true
+	}
+
+	events := []WatchEvent{}
+	for _, key := range sortedKeys(keys) {
+		before, existed := previous[key]
+		after, exists := current[key]
+
+		switch {
+		case !existed && exists:
+			events = append(events, WatchEvent{Action: WatchAdded, Key: key, Document: after})
+		case existed && !exists:
+			events = append(events, WatchEvent{Action: WatchRemoved, Key: key})
+		case existed && exists && !bytes.Equal(before, after):
+			events = append(events, WatchEvent{Action: WatchModified, Key: key, Document: after})
+		}
+	}
+
+	return events
+}
+
+// watchHub wakes up the watches of the pots written by the server.
+type watchHub struct {
+	mux  sync.Mutex
+	subs map[string]map[chan struct{}]bool
+}
+
+// subscribe returns the channel signalled on writes of the pot and the
+// function ending the subscription.
+func (h *watchHub) subscribe(dir string) (<-chan struct{}, func()) {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+
+	if h.subs == nil {
+		h.subs = map[string]map[chan struct{}]bool{}
+	}
+	if h.subs[dir] == nil {
+		h.subs[dir] = map[chan struct{}]bool{}
+	}
+
+	// a single pending signal is enough, the watch reads the latest pot anyway
+	ch := make(chan struct{}, 1)
+	h.subs[dir][ch] = true
+
+	return ch, func() {
+		h.mux.Lock()
+		defer h.mux.Unlock()
+
+		delete(h.subs[dir], ch)
+		if len(h.subs[dir]) == 0 {
+			delete(h.subs, dir)
+		}
+	}
+}
+
+// notify wakes up the watches of the pot without blocking the write.
+func (h *watchHub) notify(dir string) {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+
+	for ch := range h.subs[dir] {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}